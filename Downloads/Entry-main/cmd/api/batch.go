@@ -0,0 +1,233 @@
+// Filename: cmd/api/batch.go
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"kriol.camerontillett.net/internal/data"
+	"kriol.camerontillett.net/internal/validator"
+)
+
+// The most operations a single batch may hold
+const maxBatchOperations = 500
+
+// errBatchFailed rolls the batch back when one of the operations failed
+var errBatchFailed = errors.New("batch failed")
+
+// A batchOperation is one step of a batch. Updates and deletes carry the
+// version the client expects the entry to be at
+type batchOperation struct {
+	Op      string           `json:"op"`
+	ID      int64            `json:"id"`
+	Version int32            `json:"version"`
+	Entry   data.EntryFields `json:"entry"`
+}
+
+// A batchResult reports what happened to one operation
+type batchResult struct {
+	Index  int               `json:"index"`
+	Op     string            `json:"op"`
+	ID     int64             `json:"id,omitempty"`
+	Entry  *data.Entry       `json:"entry,omitempty"`
+	Error  string            `json:"error,omitempty"`
+	Errors map[string]string `json:"errors,omitempty"`
+	status int
+}
+
+// fail() marks the operation as failed with the given status and message
+func (result *batchResult) fail(status int, message string) {
+	result.status = status
+	result.Error = message
+}
+
+// batchEntryHandler for the "POST /v1/entries/batch" endpoint
+// Runs every operation in one transaction. If any of them fails nothing is
+// written and each operation's outcome is reported back
+func (app *application) batchEntryHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Operations []batchOperation `json:"operations"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	v.Check(len(input.Operations) > 0, "operations", "must contain at least one operation")
+	v.Check(len(input.Operations) <= maxBatchOperations, "operations", "must not contain more than 500 operations")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	vocabulary, err := app.models.Vocabularies.Load()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	user := app.contextGetUser(r)
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	admin := permissions.Include("entries:admin")
+
+	// Batches get a longer deadline than a single write
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	results := make([]*batchResult, len(input.Operations))
+	err = app.models.Entry.WithTx(ctx, func(tx *sql.Tx) error {
+		failed := false
+		for i, operation := range input.Operations {
+			result := &batchResult{Index: i, Op: operation.Op, ID: operation.ID, status: http.StatusOK}
+			err := app.runBatchOperation(ctx, tx, operation, result, vocabulary, user.ID, admin)
+			if err != nil {
+				return err
+			}
+			if result.status != http.StatusOK {
+				failed = true
+			}
+			results[i] = result
+		}
+		if failed {
+			return errBatchFailed
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errBatchFailed) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if errors.Is(err, errBatchFailed) {
+		// Use the most serious failure as the status for the whole batch
+		status := http.StatusConflict
+		for _, result := range results {
+			if result.status == http.StatusUnprocessableEntity {
+				status = http.StatusUnprocessableEntity
+				break
+			}
+			if result.status == http.StatusForbidden {
+				status = http.StatusForbidden
+			}
+		}
+		env := envelope{"error": "the batch was not applied because one or more operations failed", "operations": results}
+		err = app.writeJSON(w, status, env, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	// Only tell the webhooks once everything has been written
+	for _, result := range results {
+		switch result.Op {
+		case "create":
+			err = app.emitEvent(data.EventEntryCreated, result.Entry)
+		case "update":
+			err = app.emitEvent(data.EventEntryUpdated, result.Entry)
+		case "delete":
+			err = app.emitEvent(data.EventEntryDeleted, envelope{"id": result.ID})
+		}
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"operations": results}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The runBatchOperation() method carries out one operation inside the batch
+// transaction. Problems with the operation are recorded on the result, only
+// unexpected errors are returned
+func (app *application) runBatchOperation(ctx context.Context, tx *sql.Tx, operation batchOperation, result *batchResult, vocabulary *data.Vocabulary, userID int64, admin bool) error {
+	v := validator.New()
+	switch operation.Op {
+	case "create":
+		entries := &data.Entry{}
+		operation.Entry.Apply(entries)
+		if data.ValidateEntries(v, entries, vocabulary); !v.Valid() {
+			result.status = http.StatusUnprocessableEntity
+			result.Errors = v.Errors
+			return nil
+		}
+		err := app.models.Entry.InsertTx(ctx, tx, entries, userID)
+		if err != nil {
+			return err
+		}
+		result.ID = entries.ID
+		result.Entry = entries
+		return nil
+	case "update", "delete":
+	default:
+		result.status = http.StatusUnprocessableEntity
+		result.Errors = map[string]string{"op": "must be create, update or delete"}
+		return nil
+	}
+
+	// Updates and deletes name an existing entry at a known version
+	v.Check(operation.ID > 0, "id", "must be provided")
+	v.Check(operation.Version > 0, "version", "must be provided")
+	if !v.Valid() {
+		result.status = http.StatusUnprocessableEntity
+		result.Errors = v.Errors
+		return nil
+	}
+	entries, err := app.models.Entry.GetTx(ctx, tx, operation.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			result.fail(http.StatusNotFound, "the requested resource could not be found")
+			return nil
+		default:
+			return err
+		}
+	}
+	if !admin {
+		ok, err := app.models.Entry.IsMaintainerTx(ctx, tx, entries.ID, userID)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			result.fail(http.StatusForbidden, "your user account does not maintain this entry")
+			return nil
+		}
+	}
+	if entries.Version != operation.Version {
+		result.fail(http.StatusConflict, "the entry is not at the expected version")
+		return nil
+	}
+
+	if operation.Op == "delete" {
+		err = app.models.Entry.DeleteTx(ctx, tx, entries.ID, entries.Version)
+	} else {
+		operation.Entry.Apply(entries)
+		if data.ValidateEntries(v, entries, vocabulary); !v.Valid() {
+			result.status = http.StatusUnprocessableEntity
+			result.Errors = v.Errors
+			return nil
+		}
+		err = app.models.Entry.UpdateTx(ctx, tx, entries, userID)
+		result.Entry = entries
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			result.fail(http.StatusConflict, "the entry is not at the expected version")
+			return nil
+		default:
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+// Filename: cmd/api/client_test.go
+
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"golang.org/x/crypto/bcrypt"
+	"kriol.camerontillett.net/internal/data"
+	"kriol.camerontillett.net/internal/jsonlog"
+	"kriol.camerontillett.net/pkg/client"
+)
+
+// A token of the right length. The database decides whether it is valid
+const testToken = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+var userColumns = []string{"id", "created_at", "name", "email", "password_hash", "activated", "version"}
+
+var entryColumnNames = []string{"id", "created_at", "name", "level", "contact", "phone", "phone_e164", "email",
+	"website", "address", "district", "mode", "version", "latitude", "longitude", "created_by", "website_checked_at",
+	"website_status", "website_redirect", "website_error"}
+
+// newTestServer() starts the API's routes in front of a mocked database
+func newTestServer(t *testing.T, configure func(*config)) (*httptest.Server, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cfg config
+	if configure != nil {
+		configure(&cfg)
+	}
+	app := &application{
+		config:      cfg,
+		logger:      jsonlog.New(io.Discard, jsonlog.LevelOff),
+		models:      data.NewModels(db),
+		webhookWake: make(chan struct{}, 1),
+		entryEvents: newEventHub(),
+	}
+	srv := httptest.NewServer(app.routes())
+	t.Cleanup(func() {
+		srv.Close()
+		db.Close()
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+	return srv, mock
+}
+
+// newTestClient() returns a client for a server started by newTestServer()
+func newTestClient(t *testing.T, configure func(*config)) (*client.Client, sqlmock.Sqlmock) {
+	t.Helper()
+	srv, mock := newTestServer(t, configure)
+	return client.New(srv.URL, client.WithHTTPClient(srv.Client())), mock
+}
+
+// expectUser() answers the token lookup done by authenticate() and the
+// permission lookups done by requirePermission() and requireMaintainer()
+func expectUser(mock sqlmock.Sqlmock, lookups int, permissions ...string) {
+	mock.ExpectQuery("FROM users\\s+INNER JOIN tokens").
+		WithArgs(sqlmock.AnyArg(), data.ScopeAuthentication, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows(userColumns).
+			AddRow(1, time.Now(), "Alice", "alice@example.com", []byte{}, true, 1))
+	for i := 0; i < lookups; i++ {
+		rows := sqlmock.NewRows([]string{"code"})
+		for _, code := range permissions {
+			rows.AddRow(code)
+		}
+		mock.ExpectQuery("FROM permissions").WithArgs(1).WillReturnRows(rows)
+	}
+}
+
+func entryRow(id int64, name string) []driver.Value {
+	return []driver.Value{id, time.Now(), name, "primary", "Ms Young", "223-4567", "+5012234567",
+		"office@example.com", "https://example.com", "Belmopan", "", "{in-person}", 3, nil, nil, 0, nil, 0, "", ""}
+}
+
+func TestClientAuthenticate(t *testing.T) {
+	c, mock := newTestClient(t, nil)
+	hash, err := bcrypt.GenerateFromPassword([]byte("pa55word"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock.ExpectQuery("FROM users\\s+WHERE email = \\$1").
+		WithArgs("alice@example.com").
+		WillReturnRows(sqlmock.NewRows(userColumns).
+			AddRow(1, time.Now(), "Alice", "alice@example.com", hash, true, 1))
+	mock.ExpectExec("INSERT INTO tokens").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err = c.Authenticate(context.Background(), "alice@example.com", "pa55word")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Token()) != 26 {
+		t.Fatalf("got token %q; want 26 characters", c.Token())
+	}
+
+	// The token is sent with the next request
+	expectUser(mock, 1, "entries:read")
+	mock.ExpectQuery("FROM entries\\s+WHERE id = \\$1").
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows(entryColumnNames).AddRow(entryRow(7, "Belmopan Primary")...))
+
+	entry, err := c.GetEntry(context.Background(), 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.ID != 7 || entry.Name != "Belmopan Primary" || entry.Mode[0] != "in-person" {
+		t.Errorf("got entry %+v", entry)
+	}
+	if entry.ETag != `"3"` {
+		t.Errorf("got ETag %q; want %q", entry.ETag, `"3"`)
+	}
+}
+
+func TestClientUnauthorized(t *testing.T) {
+	c, _ := newTestClient(t, nil)
+
+	_, err := c.ListEntries(context.Background(), client.EntryFilter{})
+	if !errors.Is(err, client.ErrUnauthorized) {
+		t.Fatalf("got %v; want ErrUnauthorized", err)
+	}
+}
+
+func TestClientNotFound(t *testing.T) {
+	c, mock := newTestClient(t, nil)
+	c.SetToken(testToken)
+	expectUser(mock, 1, "entries:read")
+	mock.ExpectQuery("FROM entries\\s+WHERE id = \\$1").WithArgs(99).WillReturnRows(sqlmock.NewRows(entryColumnNames))
+	mock.ExpectQuery("FROM entry_redirects").WithArgs(99).WillReturnRows(sqlmock.NewRows([]string{"to_id"}))
+
+	_, err := c.GetEntry(context.Background(), 99)
+	if !errors.Is(err, client.ErrNotFound) {
+		t.Fatalf("got %v; want ErrNotFound", err)
+	}
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != 404 || apiErr.Message == "" {
+		t.Errorf("got %#v; want a 404 with a message", err)
+	}
+}
+
+func TestClientEditConflict(t *testing.T) {
+	c, mock := newTestClient(t, nil)
+	c.SetToken(testToken)
+	expectUser(mock, 2, "entries:write", "entries:admin")
+	mock.ExpectQuery("FROM entries\\s+WHERE id = \\$1").
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows(entryColumnNames).AddRow(entryRow(7, "Belmopan Primary")...))
+	mock.ExpectQuery("FROM vocabularies").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "kind", "code", "label", "aliases", "version"}).
+			AddRow(1, data.VocabularyLevel, "primary", "Primary", "{}", 1).
+			AddRow(2, data.VocabularyMode, "in-person", "In person", "{}", 1))
+	// Someone else saved a new version first
+	mock.ExpectBegin()
+	mock.ExpectQuery("UPDATE entries").WillReturnRows(sqlmock.NewRows([]string{"version"}))
+	mock.ExpectRollback()
+
+	name := "Belmopan Primary School"
+	_, err := c.UpdateEntry(context.Background(), 7, client.EntryUpdate{Name: &name})
+	if !errors.Is(err, client.ErrConflict) {
+		t.Fatalf("got %v; want ErrConflict", err)
+	}
+}
+
+func TestClientFailedValidation(t *testing.T) {
+	c, _ := newTestClient(t, nil)
+
+	_, err := c.RegisterUser(context.Background(), "Alice", "not an email", "short")
+	if !errors.Is(err, client.ErrFailedValidation) {
+		t.Fatalf("got %v; want ErrFailedValidation", err)
+	}
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("got %T; want *client.Error", err)
+	}
+	for _, field := range []string{"email", "password"} {
+		if apiErr.Fields[field] == "" {
+			t.Errorf("no validation error for %s in %v", field, apiErr.Fields)
+		}
+	}
+}
+
+func TestClientRateLimited(t *testing.T) {
+	c, _ := newTestClient(t, func(cfg *config) {
+		cfg.limiter.enabled = true
+		cfg.limiter.rps = 0.001
+		cfg.limiter.burst = 1
+	})
+
+	_, err := c.ActivateUser(context.Background(), "")
+	if !errors.Is(err, client.ErrFailedValidation) {
+		t.Fatalf("got %v; want ErrFailedValidation", err)
+	}
+	_, err = c.ActivateUser(context.Background(), "")
+	if !errors.Is(err, client.ErrRateLimited) {
+		t.Fatalf("got %v; want ErrRateLimited", err)
+	}
+}
+
+func TestClientEntriesIterator(t *testing.T) {
+	c, mock := newTestClient(t, nil)
+	c.SetToken(testToken)
+	columns := append(append([]string{}, entryColumnNames...), "distance")
+	row := func(id int64) []driver.Value {
+		return append(entryRow(id, "School "+string(rune('A'+id-1))), nil)
+	}
+	// Two rows fit on a page. The third one tells the API there is more
+	expectUser(mock, 1, "entries:read")
+	mock.ExpectQuery("FROM entries").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(row(1)...).AddRow(row(2)...).AddRow(row(3)...))
+	expectUser(mock, 1, "entries:read")
+	mock.ExpectQuery("FROM entries").
+		WithArgs(int64(2), int64(2), 3).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(row(3)...))
+
+	it := c.Entries(context.Background(), client.EntryFilter{PageSize: 2})
+	var ids []int64
+	for it.Next() {
+		ids = append(ids, it.Entry().ID)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 3 || ids[0] != 1 || ids[1] != 2 || ids[2] != 3 {
+		t.Errorf("got ids %v; want [1 2 3]", ids)
+	}
+}
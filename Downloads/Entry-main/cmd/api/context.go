@@ -4,7 +4,9 @@ package main
 
 import (
 	"context"
+	"net"
 	"net/http"
+	"time"
 
 	"kriol.camerontillett.net/internal/data"
 )
@@ -15,12 +17,32 @@ type contextKey string
 // make user a key
 const userContextKey = contextKey("user")
 
+// The connection a request came in on. Set by the server's ConnContext
+const connContextKey = contextKey("conn")
+
 // Method to add user to the context
 func (app *application) contextSetUser(r *http.Request, user *data.User) *http.Request {
 	ctx := context.WithValue(r.Context(), userContextKey, user)
 	return r.WithContext(ctx)
 }
 
+// connContext() keeps the connection in the context of its requests so a
+// handler can change its deadlines
+func connContext(ctx context.Context, conn net.Conn) context.Context {
+	return context.WithValue(ctx, connContextKey, conn)
+}
+
+// extendWriteDeadline() gives the response to a request longer to be written
+// than the server's write timeout allows. It does nothing for requests that
+// did not come through serve()
+func extendWriteDeadline(r *http.Request, d time.Duration) error {
+	conn, ok := r.Context().Value(connContextKey).(net.Conn)
+	if !ok {
+		return nil
+	}
+	return conn.SetWriteDeadline(time.Now().Add(d))
+}
+
 // Retreive the User struct
 func (app *application) contextGetUser(r *http.Request) *data.User {
 	user, ok := r.Context().Value(userContextKey).(*data.User)
@@ -0,0 +1,50 @@
+// Filename: cmd/api/context_test.go
+
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// getAfterWriteTimeout() fetches the body of a server that writes it after its write timeout,
+// extending the deadline first if extend is set
+func getAfterWriteTimeout(t *testing.T, extend bool) (string, error) {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if extend {
+			if err := extendWriteDeadline(r, time.Second); err != nil {
+				t.Error(err)
+			}
+		}
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("done"))
+	}))
+	srv.Config.WriteTimeout = 50 * time.Millisecond
+	srv.Config.ConnContext = connContext
+	srv.Start()
+	defer srv.Close()
+
+	res, err := srv.Client().Get(srv.URL)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	return string(body), err
+}
+
+func TestExtendWriteDeadline(t *testing.T) {
+	body, err := getAfterWriteTimeout(t, true)
+	if err != nil || body != "done" {
+		t.Errorf("got %q, %v; want the whole body", body, err)
+	}
+	// Without it the server's write timeout cuts the response off
+	body, err = getAfterWriteTimeout(t, false)
+	if err == nil && body == "done" {
+		t.Error("got the whole body; want the write timeout to cut it off")
+	}
+}
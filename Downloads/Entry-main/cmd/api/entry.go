@@ -5,9 +5,11 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"net/url"
 	"errors"
 
 	"kriol.camerontillett.net/internal/data"
+	"kriol.camerontillett.net/internal/jsonpatch"
 	"kriol.camerontillett.net/internal/validator"
 )
 
@@ -23,7 +25,10 @@ func (app *application) createEntryHandler(w http.ResponseWriter, r *http.Reques
 		Email string `json:"email"`
 		Website string `json:"website"`
 		Address string `json:"address"`
+		District string `json:"district"`
 		Mode []string `json:"mode"`
+		Latitude *float64 `json:"latitude"`
+		Longitude *float64 `json:"longitude"`
 	}
 	// Initialize a new json.
 	err := app.readJSON(w, r, &input)
@@ -41,26 +46,57 @@ func (app *application) createEntryHandler(w http.ResponseWriter, r *http.Reques
 		Email: input.Email,
 		Website: input.Website,
 		Address: input.Address,
+		District: input.District,
 		Mode: input.Mode,
+		Latitude: input.Latitude,
+		Longitude: input.Longitude,
+	}
+
+	// Fetch the allowed levels and modes
+	vocabulary, err := app.models.Vocabularies.Load()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
 	}
 
 	// Initialize a new Validator instance
 	v := validator.New()
+	// force=true skips the duplicate check
+	force := app.readBool(r.URL.Query(), "force", false, v)
 
 	// check the map to see if there were validation errors
-	if data.ValidateEntries(v, entries); !v.Valid() {
+	if data.ValidateEntries(v, entries, vocabulary); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
-	// Create an entry
-	err = app.models.Entry.Insert(entries)
+	// Look for entries that are probably the same school
+	if !force {
+		candidates, err := app.models.Entry.FindDuplicates(entries)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if len(candidates) > 0 {
+			app.duplicateEntryResponse(w, r, candidates)
+			return
+		}
+	}
+	// Create an entry and record who created it
+	user := app.contextGetUser(r)
+	err = app.models.Entry.Insert(entries, user.ID)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if err := app.emitEvent(data.EventEntryCreated, entries); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
 	}
 
 	// Create a Location header for the newly created resource/school
 	headers := make(http.Header)
 	headers.Set("Location", fmt.Sprintf("/v1/entries/%d", entries.ID))
+	headers.Set("ETag", entryETag(entries))
 	// Write the JSON response with 201 - Created status code with the body
 	// being the entry data and the header being the header map
 	err = app.writeJSON(w, http.StatusCreated, envelope{"entries":entries}, headers)
@@ -78,21 +114,44 @@ func (app *application) showEntryHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// Read the fields and relations the client wants
+	v := validator.New()
+	view := app.readEntryView(r.URL.Query(), v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
 	// Fetch the specific entry
-	entries, err := app.models.Entry.Get(id)
+	entries, err := app.models.Entry.Get(id, view.columns()...)
 	// Handle Errors
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
-			app.notFoundResponse(w, r)
+			// The entry may have been merged into another one
+			app.redirectMergedEntry(w, r, id)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return 
 	}
 
+	// Embedded relations and the website check can change without the
+	// entry's version changing. The check is only shown when it is asked for
+	// by name, and the tag is then made from the body instead
+	etag := entryETag(entries)
+	if len(view.Include) > 0 || view.showsAny(websiteCheckFields) {
+		etag = ""
+	} else {
+		hideWebsiteCheck(entries)
+	}
+	output, err := app.renderEntry(view, entries)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
 	// Write the data returned by Get()
-	err = app.writeJSON(w, http.StatusOK, envelope{"entries": entries}, nil)
+	err = app.writeCacheableJSON(w, r, etag, envelope{"entries": output}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -118,75 +177,63 @@ func (app *application) updateEntryHandler(w http.ResponseWriter, r *http.Reques
 		}
 		return 
 	}
-	// Create an input struct to hold data read from the Client
-	// Update the input struct to use pointers for default value of nil
-	// If field remains nil we know it wasnt updated
-	var input struct {
-		Name 	*string  `json:"name"`
-		Level 	*string  `json:"level"`
-		Contact *string  `json:"contact"`
-		Phone 	*string  `json:"phone"`
-		Email 	*string  `json:"email"`
-		Website *string  `json:"website"`
-		Address *string  `json:"address"`
-		Mode 	[]string `json:"mode"`
+	// The client's copy has to be current if it sent If-Match
+	if !app.checkIfMatch(w, r, entries) {
+		return
 	}
-	
-	// Initialize a new json.
-	err = app.readJSON(w, r, &input)
+	// Apply the changes in whichever patch format the client sent
+	err = app.readEntryPatch(w, r, entries)
 	if err != nil {
-		app.badRequestResponse(w, r, err)
+		switch {
+		case errors.Is(err, errUnsupportedPatchType):
+			app.unsupportedMediaTypeResponse(w, r, r.Header.Get("Content-Type"))
+		case errors.Is(err, jsonpatch.ErrTestFailed):
+			app.patchTestFailedResponse(w, r, err)
+		default:
+			app.badRequestResponse(w, r, err)
+		}
 		return
 	}
 
-	// Check for updates
-	if input.Name != nil {
-		entries.Name = *input.Name
-	}
-	if input.Level != nil {
-		entries.Level = *input.Level
-	}
-	if input.Contact != nil {
-		entries.Contact = *input.Contact
-	}
-	if input.Phone != nil {
-		entries.Phone = *input.Phone
-	}
-	if input.Email != nil {
-		entries.Email = *input.Email
-	}
-	if input.Website != nil {
-		entries.Website = *input.Website
-	}
-	if input.Address != nil {
-		entries.Address = *input.Address
-	}
-	if input.Mode != nil {
-		entries.Mode = input.Mode
-	}
-
 	// Perform validation on the updated entry. If fails the we send a 422 - unprocessable response
+	// Fetch the allowed levels and modes
+	vocabulary, err := app.models.Vocabularies.Load()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
 	// Initialize validator instance
 	v := validator.New()
 
 	// check the map to see if there were validation errors
-	if data.ValidateEntries(v, entries); !v.Valid() {
+	if data.ValidateEntries(v, entries, vocabulary); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 	
 	// Pass the Updated Entry record to the Update () method
-	err = app.models.Entry.Update(entries)
+	user := app.contextGetUser(r)
+	err = app.models.Entry.Update(entries, user.ID)
 	if err != nil {
 		switch {
+		case errors.Is(err, data.ErrEditConflict) && r.Header.Get("If-Match") != "":
+			app.preconditionFailedResponse(w, r)
 		case errors.Is(err, data.ErrEditConflict):
 			app.editConflictResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
+		return
+	}
+	if err := app.emitEvent(data.EventEntryUpdated, entries); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
 	}
 	// Write the data returned by Get()
-	err = app.writeJSON(w, http.StatusOK, envelope{"entries": entries}, nil)
+	headers := make(http.Header)
+	headers.Set("ETag", entryETag(entries))
+	hideWebsiteCheck(entries)
+	err = app.writeJSON(w, http.StatusOK, envelope{"entries": entries}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -199,19 +246,43 @@ func (app *application) deleteEntryHandler(w http.ResponseWriter, r *http.Reques
 		app.notFoundResponse(w, r)
 		return
 	}
+	// With If-Match the entry is only deleted if it is still at that version
+	var version int32
+	if r.Header.Get("If-Match") != "" {
+		entries, err := app.models.Entry.Get(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		if !app.checkIfMatch(w, r, entries) {
+			return
+		}
+		version = entries.Version
+	}
 	// Delete the School from the database. Send a 404 Not Found status code to the
 	// client if there is no matching record
-	err = app.models.Entry.Delete(id)
+	err = app.models.Entry.Delete(id, version)
 	// Handle errors
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
 			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.preconditionFailedResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
+	if err := app.emitEvent(data.EventEntryDeleted, envelope{"id": id}); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
 	// Return 200 Status OK to the client with a success message
 	err = app.writeJSON(w, http.StatusOK, envelope{"message": "entry successfully deleted"}, nil)
 	if err != nil {
@@ -222,9 +293,9 @@ func (app *application) deleteEntryHandler(w http.ResponseWriter, r *http.Reques
 func (app *application) listEntryHandler(w http.ResponseWriter, r *http.Request) {
 	// Create an input struct to hold our query parameter
 	var input struct {
-		Name string
-		Level string
-		Mode []string
+		data.EntryFilter
+		Query string
+		Lang string
 		data.Filters
 	}
 
@@ -233,16 +304,31 @@ func (app *application) listEntryHandler(w http.ResponseWriter, r *http.Request)
 	// Get the URL values map
 	qs := r.URL.Query()
 	// Use the helper methods to extract the values
-	input.Name = app.readString(qs, "name", "")
-	input.Level = app.readString(qs, "level", "")
-	input.Mode = app.readCSV(qs, "mode", []string{})
+	input.EntryFilter = app.readEntryFilter(qs, v)
+	// Get the full-text search information
+	input.Query = app.readString(qs, "q", "")
+	input.Lang = app.readString(qs, "lang", "english")
 	// Get the page information
 	input.Filters.Page = app.readInt(qs, "page", 1, v)
 	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
 	// Get the sort information
 	input.Filters.Sort = app.readString(qs, "sort", "id")
 	// Specific the allowed sort values
-	input.Filters.SortList = []string{"id", "name", "level", "-id", "-name", "-level"}
+	input.Filters.SortList = entrySortList(input.EntryFilter)
+	// Searches are ordered by rank unless the client asks otherwise
+	if input.Query != "" {
+		input.Filters.Sort = app.readString(qs, "sort", "-rank")
+		input.Filters.SortList = append(input.Filters.SortList, "rank", "-rank")
+		_, ok := data.SearchLanguages[input.Lang]
+		v.Check(ok, "lang", "must be one of simple, english or spanish")
+	}
+	// Sending a cursor, even an empty one, switches to keyset pagination. It
+	// works with every sort, including rank and distance
+	useCursor := qs.Has("cursor")
+	input.Filters.Cursor = qs.Get("cursor")
+	// Get the fields and relations to show
+	view := app.readEntryView(qs, v)
+	input.Filters.Fields = view.columns()
 	// Check for validation errors
 	if data.ValidateFilters(v, input.Filters);!v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
@@ -250,19 +336,84 @@ func (app *application) listEntryHandler(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Get a listing of all the entries
-	entries, metadata, err := app.models.Entry.GetAll(input.Name, input.Level, input.Mode, input.Filters)
+	var entries []*data.Entry
+	var metadata data.Metadata
+	var err error
+	switch {
+	case input.Query != "" && useCursor:
+		entries, metadata, err = app.models.Entry.SearchByCursor(input.Query, input.Lang, input.EntryFilter, input.Filters)
+	case input.Query != "":
+		entries, metadata, err = app.models.Entry.Search(input.Query, input.Lang, input.EntryFilter, input.Filters)
+	case useCursor:
+		entries, metadata, err = app.models.Entry.GetAllByCursor(input.EntryFilter, input.Filters)
+	default:
+		entries, metadata, err = app.models.Entry.GetAll(input.EntryFilter, input.Filters)
+	}
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	// Point to the neighbouring pages with a Link header
+	headers := make(http.Header)
+	if links := app.pageLinks(r, metadata); links != "" {
+		headers.Set("Link", links)
+	}
+	output, err := app.renderEntries(view, entries)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 	// Send a JSN response contain all the entries
-	err = app.writeJSON(w, http.StatusOK, envelope{"entries": entries, "metadata": metadata}, nil)
+	err = app.writeCacheableJSON(w, r, "", envelope{"entries": output, "metadata": metadata}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 }
 
+// The readEntryFilter() method reads the filter parameters shared by the entry
+// listings: name, level, mode, near=lat,lng with radius_km, and
+// bbox=min_lng,min_lat,max_lng,max_lat
+func (app *application) readEntryFilter(qs url.Values, v *validator.Validator) data.EntryFilter {
+	var filter data.EntryFilter
+	filter.Name = app.readString(qs, "name", "")
+	filter.Level = app.readString(qs, "level", "")
+	filter.Mode = app.readCSV(qs, "mode", []string{})
+	filter.District = app.readString(qs, "district", "")
+	filter.WebsiteStatus = app.readString(qs, "website_status", "")
+	// Phone numbers are matched however they were written
+	if raw := app.readString(qs, "phone", ""); raw != "" {
+		number, ok := data.NormalizePhone(raw)
+		v.Check(ok, "phone", "must be a valid phone number")
+		filter.Phone = number
+	}
+	// Get the location information
+	if near := app.readFloatCSV(qs, "near", 2, v); near != nil {
+		filter.Near = &data.GeoPoint{Latitude: near[0], Longitude: near[1]}
+	}
+	filter.RadiusKm = app.readFloat(qs, "radius_km", 0, v)
+	if bbox := app.readFloatCSV(qs, "bbox", 4, v); bbox != nil {
+		filter.BBox = &data.BoundingBox{
+			MinLongitude: bbox[0],
+			MinLatitude:  bbox[1],
+			MaxLongitude: bbox[2],
+			MaxLatitude:  bbox[3],
+		}
+	}
+	data.ValidateEntryFilter(v, filter)
+	return filter
+}
+
+// entrySortList() returns the allowed sort values for an entry listing.
+// Sorting by distance needs a point to measure from
+func entrySortList(filter data.EntryFilter) []string {
+	sortList := []string{"id", "name", "level", "-id", "-name", "-level"}
+	if filter.Near != nil {
+		sortList = append(sortList, "distance", "-distance")
+	}
+	return sortList
+}
+
 // func (app *application) showRandomString (w http.ResponseWriter, r *http.Request) {
 
 // 	id, err := app.readIDParam(r)
@@ -3,6 +3,8 @@ package main
 import (
 	"fmt"
 	"net/http"
+
+	"kriol.camerontillett.net/internal/data"
 )
 
 func (app *application) logError(r *http.Request, err error) {
@@ -97,4 +99,51 @@ func (app *application) inactiveAccountResponse(w http.ResponseWriter, r *http.R
 func (app *application) notPermittedResponse(w http.ResponseWriter, r *http.Request) {
 	message := "your user account does not have the necessary permissions to access this resource"
 	app.errorResponse(w, r, http.StatusForbidden, message)
-}
\ No newline at end of file
+}
+
+// The request body was sent in a format we do not accept
+func (app *application) unsupportedMediaTypeResponse(w http.ResponseWriter, r *http.Request, contentType string) {
+	message := fmt.Sprintf("the %q content type is not supported for this resource", contentType)
+	app.errorResponse(w, r, http.StatusUnsupportedMediaType, message)
+}
+// A vocabulary term that entries still use
+func (app *application) termInUseResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the term is still used by one or more entries"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+// The new entry looks like one or more existing entries
+func (app *application) duplicateEntryResponse(w http.ResponseWriter, r *http.Request, candidates []*data.DuplicateCandidate) {
+	env := envelope{
+		"error":      "the entry looks like an existing entry, send force=true to create it anyway",
+		"candidates": candidates,
+	}
+	err := app.writeJSON(w, http.StatusConflict, env, nil)
+	if err != nil {
+		app.logError(r, err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// The submission has already been approved or rejected
+func (app *application) submissionDecidedResponse(w http.ResponseWriter, r *http.Request, status string) {
+	message := fmt.Sprintf("the submission has already been %s", status)
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+// The suggestion has already been applied or dismissed
+func (app *application) suggestionClosedResponse(w http.ResponseWriter, r *http.Request, status string) {
+	message := fmt.Sprintf("the suggestion has already been %s", status)
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+// The If-Match header does not match the current version
+func (app *application) preconditionFailedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the record has changed since it was last fetched, please fetch it again"
+	app.errorResponse(w, r, http.StatusPreconditionFailed, message)
+}
+
+// A JSON Patch "test" operation did not match the entry
+func (app *application) patchTestFailedResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.errorResponse(w, r, http.StatusConflict, err.Error())
+}
@@ -0,0 +1,94 @@
+// Filename: cmd/api/etag.go
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"kriol.camerontillett.net/internal/data"
+)
+
+// entryETag() maps an entry's version onto a strong entity tag
+func entryETag(entries *data.Entry) string {
+	return strconv.Quote(strconv.FormatInt(int64(entries.Version), 10))
+}
+
+// The fields the link checker writes without bumping the version
+var websiteCheckFields = []string{"website_checked_at", "website_status", "website_redirect", "website_error"}
+
+// hideWebsiteCheck() clears the website check fields so they are left out of
+// a response tagged with entryETag(). They change without the version
+// changing, so a strong tag made from the version cannot cover them
+func hideWebsiteCheck(entries *data.Entry) {
+	entries.WebsiteCheckedAt = nil
+	entries.WebsiteStatus = 0
+	entries.WebsiteRedirect = ""
+	entries.WebsiteError = ""
+}
+
+// etagMatches() reports whether a tag appears in an If-Match or If-None-Match
+// header. "*" matches anything. The weak flag allows W/ tags to match, as
+// If-None-Match does
+func etagMatches(header, etag string, weak bool) bool {
+	if weak {
+		etag = strings.TrimPrefix(etag, "W/")
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+		if weak {
+			tag = strings.TrimPrefix(tag, "W/")
+		}
+		if tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// The checkIfMatch() method compares the If-Match header, when one was sent,
+// with the entry's current version. It writes a 412 response and returns false
+// if the client's copy is out of date
+func (app *application) checkIfMatch(w http.ResponseWriter, r *http.Request, entries *data.Entry) bool {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" || etagMatches(ifMatch, entryETag(entries), false) {
+		return true
+	}
+	app.preconditionFailedResponse(w, r)
+	return false
+}
+
+// The writeCacheableJSON() method works like writeJSON() but sends an ETag and
+// answers a matching If-None-Match with 304 Not Modified. If no tag is given a
+// weak one is made from a hash of the body
+func (app *application) writeCacheableJSON(w http.ResponseWriter, r *http.Request, etag string, data envelope, headers http.Header) error {
+	js, err := json.MarshalIndent(data, "", "\t")
+	if err != nil {
+		return err
+	}
+	js = append(js, '\n')
+	if etag == "" {
+		sum := sha256.Sum256(js)
+		etag = `W/"` + hex.EncodeToString(sum[:16]) + `"`
+	}
+	for key, value := range headers {
+		w.Header()[key] = value
+	}
+	w.Header().Set("ETag", etag)
+	// The client already has this representation
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" && etagMatches(ifNoneMatch, etag, true) {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(js)
+	return nil
+}
@@ -0,0 +1,94 @@
+// Filename: cmd/api/etag_test.go
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestShowEntryHidesWebsiteCheck(t *testing.T) {
+	srv, mock := newTestServer(t, nil)
+	get := func(path, ifNoneMatch string) (*http.Response, map[string]interface{}) {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		res, err := srv.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		var body struct {
+			Entries map[string]interface{} `json:"entries"`
+		}
+		if res.StatusCode == http.StatusOK {
+			if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return res, body.Entries
+	}
+
+	// The checker has been by, but the version still says 3
+	row := entryRow(7, "Belmopan Primary")
+	row[len(row)-4], row[len(row)-3], row[len(row)-1] = time.Now(), 0, "timed out"
+	expectUser(mock, 1, "entries:read")
+	mock.ExpectQuery("FROM entries\\s+WHERE id = \\$1").WithArgs(7).
+		WillReturnRows(sqlmock.NewRows(entryColumnNames).AddRow(row...))
+	res, entry := get("/v1/entries/7", "")
+	if res.Header.Get("ETag") != `"3"` {
+		t.Errorf("got ETag %q; want %q", res.Header.Get("ETag"), `"3"`)
+	}
+	for _, field := range websiteCheckFields {
+		if _, ok := entry[field]; ok {
+			t.Errorf("got %s in a response with a strong ETag", field)
+		}
+	}
+
+	// Asking for the check by name shows it under a tag made from the body
+	expectUser(mock, 1, "entries:read")
+	mock.ExpectQuery("SELECT id, version, website_checked_at, website_error\\s+FROM entries").WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "version", "website_checked_at", "website_error"}).
+			AddRow(7, 3, time.Now(), "timed out"))
+	res, entry = get("/v1/entries/7?fields=website_checked_at,website_error", `"3"`)
+	if res.StatusCode != http.StatusOK || !strings.HasPrefix(res.Header.Get("ETag"), "W/") {
+		t.Errorf("got %d with ETag %q; want 200 and a weak tag", res.StatusCode, res.Header.Get("ETag"))
+	}
+	if entry["website_error"] != "timed out" {
+		t.Errorf("got entry %v; want the website error", entry)
+	}
+}
+
+func TestRevertChecksIfMatch(t *testing.T) {
+	srv, mock := newTestServer(t, nil)
+	expectUser(mock, 2, "entries:write", "entries:admin")
+	mock.ExpectQuery("FROM entries\\s+WHERE id = \\$1").WithArgs(7).
+		WillReturnRows(sqlmock.NewRows(entryColumnNames).AddRow(entryRow(7, "Belmopan Primary")...))
+
+	// The revert was based on version 2 but the entry is at version 3
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/v1/entries/7/revert?to=1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	req.Header.Set("If-Match", `"2"`)
+	res, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("got %d; want 412", res.StatusCode)
+	}
+}
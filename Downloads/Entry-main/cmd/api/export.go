@@ -0,0 +1,227 @@
+// Filename: cmd/api/export.go
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"kriol.camerontillett.net/internal/data"
+	"kriol.camerontillett.net/internal/validator"
+	"kriol.camerontillett.net/internal/xlsx"
+)
+
+// How many rows are written between flushes to the client
+const exportFlushEvery = 100
+
+// The columns written by the tabular export formats
+var exportColumns = []string{"id", "name", "level", "contact", "phone", "email", "website", "address", "district", "mode", "latitude", "longitude", "version"}
+
+// An entryExporter writes entries out in one of the export formats
+type entryExporter interface {
+	WriteEntry(entry *data.Entry) error
+	Flush() error
+	Close() error
+}
+
+// exportRecord() flattens an entry into the export columns. The mode list is
+// joined with ";" which is also the default delimiter for imports
+func exportRecord(entry *data.Entry) []string {
+	return []string{
+		strconv.FormatInt(entry.ID, 10),
+		entry.Name,
+		entry.Level,
+		entry.Contact,
+		entry.Phone,
+		entry.Email,
+		entry.Website,
+		entry.Address,
+		entry.District,
+		strings.Join(entry.Mode, ";"),
+		formatCoordinate(entry.Latitude),
+		formatCoordinate(entry.Longitude),
+		strconv.FormatInt(int64(entry.Version), 10),
+	}
+}
+
+// formatCoordinate() writes an optional coordinate, leaving the cell empty if unset
+func formatCoordinate(value *float64) string {
+	if value == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*value, 'f', -1, 64)
+}
+
+// csvExporter writes a header row followed by one row per entry
+type csvExporter struct {
+	w *csv.Writer
+}
+
+func newCSVExporter(w http.ResponseWriter) (entryExporter, error) {
+	e := &csvExporter{w: csv.NewWriter(w)}
+	return e, e.w.Write(exportColumns)
+}
+
+func (e *csvExporter) WriteEntry(entry *data.Entry) error {
+	return e.w.Write(exportRecord(entry))
+}
+
+func (e *csvExporter) Flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+func (e *csvExporter) Close() error {
+	return e.Flush()
+}
+
+// ndjsonExporter writes one JSON object per line
+type ndjsonExporter struct {
+	enc *json.Encoder
+}
+
+func newNDJSONExporter(w http.ResponseWriter) (entryExporter, error) {
+	return &ndjsonExporter{enc: json.NewEncoder(w)}, nil
+}
+
+func (e *ndjsonExporter) WriteEntry(entry *data.Entry) error {
+	return e.enc.Encode(entry)
+}
+
+func (e *ndjsonExporter) Flush() error {
+	return nil
+}
+
+func (e *ndjsonExporter) Close() error {
+	return nil
+}
+
+// xlsxExporter writes a workbook with a single "entries" sheet
+type xlsxExporter struct {
+	w *xlsx.Writer
+}
+
+func newXLSXExporter(w http.ResponseWriter) (entryExporter, error) {
+	xw, err := xlsx.NewWriter(w, "entries")
+	if err != nil {
+		return nil, err
+	}
+	e := &xlsxExporter{w: xw}
+	return e, e.w.WriteRow(exportColumns)
+}
+
+func (e *xlsxExporter) WriteEntry(entry *data.Entry) error {
+	return e.w.WriteRow(exportRecord(entry))
+}
+
+func (e *xlsxExporter) Flush() error {
+	return e.w.Flush()
+}
+
+func (e *xlsxExporter) Close() error {
+	return e.w.Close()
+}
+
+// The export formats along with their content type and constructor
+var exportFormats = map[string]struct {
+	contentType string
+	extension   string
+	new         func(w http.ResponseWriter) (entryExporter, error)
+}{
+	"csv":    {"text/csv; charset=utf-8", "csv", newCSVExporter},
+	"ndjson": {"application/x-ndjson", "ndjson", newNDJSONExporter},
+	"xlsx":   {"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", "xlsx", newXLSXExporter},
+}
+
+// exportEntryHandler for the "GET /v1/entries/export" endpoint
+// Takes the same filters as the listing but streams every matching row. The
+// export has until the -export-timeout limit to finish instead of the server's
+// write timeout. An export still going by then is cut off, so very large ones
+// should be narrowed with the filters
+func (app *application) exportEntryHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.EntryFilter
+		Format string
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+	input.EntryFilter = app.readEntryFilter(qs, v)
+	input.Format = app.readString(qs, "format", "csv")
+	// Exports are not paged but the sort is still checked
+	input.Filters.Page = 1
+	input.Filters.PageSize = 1
+	input.Filters.Sort = app.readString(qs, "sort", "id")
+	input.Filters.SortList = entrySortList(input.EntryFilter)
+	data.ValidateFilters(v, input.Filters)
+	format, ok := exportFormats[input.Format]
+	v.Check(ok, "format", "must be one of csv, ndjson or xlsx")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	flusher, _ := w.(http.Flusher)
+	var exporter entryExporter
+	started := false
+	// start() sends the headers and sets up the exporter. It is called once the
+	// query has succeeded so a failing query can still get a JSON error
+	start := func() error {
+		started = true
+		if err := extendWriteDeadline(r, app.config.export.timeout); err != nil {
+			return err
+		}
+		w.Header().Set("Content-Type", format.contentType)
+		w.Header().Set("Content-Disposition", `attachment; filename="entries.`+format.extension+`"`)
+		w.WriteHeader(http.StatusOK)
+		var err error
+		exporter, err = format.new(w)
+		return err
+	}
+
+	written := 0
+	err := app.models.Entry.Export(r.Context(), input.EntryFilter, input.Filters, func(entry *data.Entry) error {
+		if !started {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		if err := exporter.WriteEntry(entry); err != nil {
+			return err
+		}
+		// Push what we have to the client every so often
+		written++
+		if written%exportFlushEvery == 0 {
+			if err := exporter.Flush(); err != nil {
+				return err
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		// Once the body has started the status can no longer be changed
+		if !started {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		app.logError(r, err)
+		return
+	}
+	// No rows matched so the headers still need to be sent
+	if !started {
+		if err = start(); err != nil {
+			app.logError(r, err)
+			return
+		}
+	}
+	if err = exporter.Close(); err != nil {
+		app.logError(r, err)
+	}
+}
@@ -0,0 +1,37 @@
+// Filename: cmd/api/facets.go
+
+package main
+
+import (
+	"net/http"
+
+	"kriol.camerontillett.net/internal/data"
+	"kriol.camerontillett.net/internal/validator"
+)
+
+// facetEntryHandler for the "GET /v1/entries/facets" endpoint
+// Takes the same filters as the listing. Facets named in "disjunctive" are
+// counted without their own filter
+func (app *application) facetEntryHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+	filter := app.readEntryFilter(qs, v)
+	disjunctive := app.readCSV(qs, "disjunctive", []string{})
+	for _, name := range disjunctive {
+		v.Check(validator.In(name, data.FacetNames...), "disjunctive", "must only contain level, mode or district")
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	facets, total, err := app.models.Entry.Facets(filter, disjunctive)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"facets": facets, "metadata": envelope{"total_records": total}}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
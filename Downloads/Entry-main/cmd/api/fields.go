@@ -0,0 +1,176 @@
+// Filename: cmd/api/fields.go
+
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+
+	"kriol.camerontillett.net/internal/data"
+	"kriol.camerontillett.net/internal/validator"
+)
+
+// An includer loads a related resource for a set of entries and returns it
+// keyed by entry ID. Entries without one are left out of the map
+type includer func(app *application, entries []*data.Entry) (map[int64]interface{}, error)
+
+// The related resources that can be embedded with include=
+var entryIncludes = map[string]includer{
+	"creator":         includeCreator,
+	"latest_revision": includeLatestRevision,
+}
+
+// The values accepted by include=
+var entryIncludeNames = []string{"creator", "latest_revision"}
+
+// The fields an entry may carry that are worked out rather than read from a
+// column. They are kept when the output is projected
+var computedEntryFields = []string{"distance_km", "rank", "highlights"}
+
+// An entryView describes how the client wants entries shown
+type entryView struct {
+	Fields  []string
+	Include []string
+}
+
+// The readEntryView() method reads the fields and include query parameters
+func (app *application) readEntryView(qs url.Values, v *validator.Validator) entryView {
+	view := entryView{
+		Fields:  app.readCSV(qs, "fields", nil),
+		Include: app.readCSV(qs, "include", nil),
+	}
+	data.ValidateFields(v, view.Fields)
+	for _, name := range view.Include {
+		v.Check(validator.In(name, entryIncludeNames...), "include", "must only contain creator or latest_revision")
+	}
+	return view
+}
+
+// showsAny() reports whether any of the fields were asked for by name
+func (view entryView) showsAny(fields []string) bool {
+	for _, field := range view.Fields {
+		if validator.In(field, fields...) {
+			return true
+		}
+	}
+	return false
+}
+
+// columns() returns the fields to read from the database. The creator is
+// found through created_by so it is read even when it is not shown
+func (view entryView) columns() []string {
+	if len(view.Fields) == 0 {
+		return nil
+	}
+	columns := append([]string{}, view.Fields...)
+	if validator.In("creator", view.Include...) {
+		columns = append(columns, "created_by")
+	}
+	return columns
+}
+
+// The renderEntries() method projects entries onto the requested fields and
+// embeds the requested relations. Without either the entries are returned
+// unchanged
+func (app *application) renderEntries(view entryView, entries []*data.Entry) (interface{}, error) {
+	if len(view.Fields) == 0 && len(view.Include) == 0 {
+		return entries, nil
+	}
+	// Load each relation once for the whole set of entries
+	included := map[string]map[int64]interface{}{}
+	for _, name := range view.Include {
+		related, err := entryIncludes[name](app, entries)
+		if err != nil {
+			return nil, err
+		}
+		included[name] = related
+	}
+
+	keep := map[string]bool{"id": true}
+	for _, field := range view.Fields {
+		keep[field] = true
+	}
+	for _, field := range computedEntryFields {
+		keep[field] = true
+	}
+	rendered := make([]map[string]interface{}, len(entries))
+	for i, e := range entries {
+		js, err := json.Marshal(e)
+		if err != nil {
+			return nil, err
+		}
+		var fields map[string]json.RawMessage
+		err = json.Unmarshal(js, &fields)
+		if err != nil {
+			return nil, err
+		}
+		output := map[string]interface{}{}
+		for name, value := range fields {
+			if len(view.Fields) == 0 || keep[name] {
+				output[name] = value
+			}
+		}
+		// A missing relation is shown as null
+		for name, related := range included {
+			output[name] = related[e.ID]
+		}
+		rendered[i] = output
+	}
+	return rendered, nil
+}
+
+// The renderEntry() method renders a single entry like renderEntries()
+func (app *application) renderEntry(view entryView, entries *data.Entry) (interface{}, error) {
+	rendered, err := app.renderEntries(view, []*data.Entry{entries})
+	if err != nil {
+		return nil, err
+	}
+	if output, ok := rendered.([]map[string]interface{}); ok {
+		return output[0], nil
+	}
+	return entries, nil
+}
+
+// includeCreator() embeds the public details of the user who created each entry
+func includeCreator(app *application, entries []*data.Entry) (map[int64]interface{}, error) {
+	var ids []int64
+	for _, e := range entries {
+		if e.CreatedBy != 0 {
+			ids = append(ids, e.CreatedBy)
+		}
+	}
+	related := map[int64]interface{}{}
+	if len(ids) == 0 {
+		return related, nil
+	}
+	users, err := app.models.Users.GetPublic(ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if user, ok := users[e.CreatedBy]; ok {
+			related[e.ID] = user
+		}
+	}
+	return related, nil
+}
+
+// includeLatestRevision() embeds the newest stored revision of each entry
+func includeLatestRevision(app *application, entries []*data.Entry) (map[int64]interface{}, error) {
+	related := map[int64]interface{}{}
+	if len(entries) == 0 {
+		return related, nil
+	}
+	ids := make([]int64, len(entries))
+	for i, e := range entries {
+		ids[i] = e.ID
+	}
+	revisions, err := app.models.Revisions.GetLatest(ids)
+	if err != nil {
+		return nil, err
+	}
+	for id, revision := range revisions {
+		related[id] = revision
+	}
+	return related, nil
+}
@@ -0,0 +1,819 @@
+// Filename: cmd/api/graphql.go
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/graph-gophers/graphql-go"
+	"kriol.camerontillett.net/internal/data"
+	"kriol.camerontillett.net/internal/validator"
+)
+
+// The GraphQL schema. Fields that read or change entries need the same
+// permission codes as the matching REST endpoints
+const graphqlSchema = `
+schema {
+	query: Query
+	mutation: Mutation
+}
+
+scalar Time
+
+type Query {
+	# The user making the request
+	me: User!
+	# An entry, or null if it does not exist. Needs entries:read
+	entry(id: ID!): Entry
+	# A page of entries, filtered like GET /v1/entries. Sending a cursor, even
+	# an empty one, switches to keyset pagination. Needs entries:read
+	entries(
+		name: String
+		level: String
+		mode: [String!]
+		district: String
+		websiteStatus: String
+		phone: String
+		near: GeoPointInput
+		radiusKm: Float
+		bbox: BoundingBoxInput
+		page: Int = 1
+		pageSize: Int = 20
+		sort: String = "id"
+		cursor: String
+	): EntryPage!
+}
+
+type Mutation {
+	# Needs entries:write. Set force to skip the duplicate check
+	createEntry(input: EntryInput!, force: Boolean = false): Entry!
+	# Needs entries:write and to be a maintainer of the entry. Only the fields
+	# sent are changed. The version must be the one last read
+	updateEntry(id: ID!, version: Int!, input: EntryInput!): Entry!
+	# Needs entries:write and to be a maintainer of the entry. With a version
+	# the entry is only deleted if it is still at that version
+	deleteEntry(id: ID!, version: Int): ID!
+}
+
+type Entry {
+	id: ID!
+	name: String!
+	level: String!
+	contact: String!
+	phone: String!
+	phoneE164: String
+	email: String
+	website: String
+	address: String!
+	district: String
+	mode: [String!]!
+	version: Int!
+	latitude: Float
+	longitude: Float
+	# Only set when the entries are filtered with near
+	distanceKm: Float
+	websiteStatus: Int
+	websiteCheckedAt: Time
+	creator: User
+	maintainers: [Maintainer!]!
+}
+
+type EntryPage {
+	entries: [Entry!]!
+	metadata: Metadata!
+}
+
+type Metadata {
+	currentPage: Int
+	pageSize: Int
+	firstPage: Int
+	lastPage: Int
+	totalRecords: Int
+	nextCursor: String
+	prevCursor: String
+}
+
+type Maintainer {
+	user: User!
+	addedAt: Time!
+}
+
+# The email and permissions are only shown for the user making the request
+type User {
+	id: ID!
+	name: String!
+	email: String
+	permissions: Permissions
+}
+
+type Permissions {
+	codes: [String!]!
+	include(code: String!): Boolean!
+}
+
+input GeoPointInput {
+	latitude: Float!
+	longitude: Float!
+}
+
+input BoundingBoxInput {
+	minLongitude: Float!
+	minLatitude: Float!
+	maxLongitude: Float!
+	maxLatitude: Float!
+}
+
+input EntryInput {
+	name: String
+	level: String
+	contact: String
+	phone: String
+	email: String
+	website: String
+	address: String
+	district: String
+	mode: [String!]
+	latitude: Float
+	longitude: Float
+}
+`
+
+// graphqlHandler for the "POST /v1/graphql" endpoint. The schema is checked
+// against the resolvers once, when the routes are built
+func (app *application) graphqlHandler() http.HandlerFunc {
+	schema := graphql.MustParseSchema(graphqlSchema, &graphqlResolver{app: app},
+		graphql.MaxDepth(10),
+		graphql.MaxParallelism(10),
+	)
+	return func(w http.ResponseWriter, r *http.Request) {
+		var input struct {
+			Query         string                 `json:"query"`
+			OperationName string                 `json:"operationName"`
+			Variables     map[string]interface{} `json:"variables"`
+		}
+		err := app.readJSON(w, r, &input)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		v := validator.New()
+		if v.Check(strings.TrimSpace(input.Query) != "", "query", "must be provided"); !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+		// The permissions are read once and shared by every field
+		user := app.contextGetUser(r)
+		permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		ctx := context.WithValue(r.Context(), graphqlSessionKey, &graphqlSession{user: user, permissions: permissions})
+
+		// Errors in a query are reported alongside whatever data could be
+		// read, so the status is always 200
+		response := schema.Exec(ctx, input.Query, input.OperationName, input.Variables)
+		env := envelope{"data": response.Data}
+		if len(response.Errors) > 0 {
+			env["errors"] = response.Errors
+		}
+		err = app.writeJSON(w, http.StatusOK, env, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+	}
+}
+
+// The context key for the user making a GraphQL request
+const graphqlSessionKey = contextKey("graphql")
+
+// A graphqlSession is the user making a GraphQL request and their permissions
+type graphqlSession struct {
+	user        *data.User
+	permissions data.Permissions
+}
+
+func graphqlSessionFrom(ctx context.Context) *graphqlSession {
+	session, ok := ctx.Value(graphqlSessionKey).(*graphqlSession)
+	if !ok {
+		panic("missing graphql session in request context")
+	}
+	return session
+}
+
+// A graphqlError is shown to the client with its code, and any details, in
+// the error's extensions
+type graphqlError struct {
+	message string
+	code    string
+	details envelope
+}
+
+func (e *graphqlError) Error() string {
+	return e.message
+}
+
+func (e *graphqlError) Extensions() map[string]interface{} {
+	extensions := map[string]interface{}{"code": e.code}
+	for key, value := range e.details {
+		extensions[key] = value
+	}
+	return extensions
+}
+
+// The errors a resolver can return. They match the REST error responses
+var (
+	errGraphQLNotFound = &graphqlError{
+		message: "the requested resource could not be found",
+		code:    "NOT_FOUND",
+	}
+	errGraphQLNotPermitted = &graphqlError{
+		message: "your user account does not have the necessary permissions to access this resource",
+		code:    "FORBIDDEN",
+	}
+	errGraphQLEditConflict = &graphqlError{
+		message: "unable to update the record due to an edit conflict, please try again",
+		code:    "EDIT_CONFLICT",
+	}
+)
+
+func graphqlValidationError(errors map[string]string) error {
+	return &graphqlError{
+		message: "the input failed validation",
+		code:    "FAILED_VALIDATION",
+		details: envelope{"errors": errors},
+	}
+}
+
+// The graphqlServerError() method logs an error and hides it from the client
+func (app *application) graphqlServerError(err error) error {
+	app.logger.PrintError(err, nil)
+	return &graphqlError{
+		message: "the server encounted a problem and could not process the request",
+		code:    "INTERNAL_SERVER_ERROR",
+	}
+}
+
+// parseGraphQLID() turns an ID into a record ID
+func parseGraphQLID(id graphql.ID) (int64, error) {
+	n, err := strconv.ParseInt(string(id), 10, 64)
+	if err != nil || n < 1 {
+		return 0, errGraphQLNotFound
+	}
+	return n, nil
+}
+
+// The graphqlResolver resolves the queries and mutations
+type graphqlResolver struct {
+	app *application
+}
+
+// The require() method checks the user making the request has a permission,
+// as requirePermission() does
+func (res *graphqlResolver) require(ctx context.Context, code string) (*graphqlSession, error) {
+	session := graphqlSessionFrom(ctx)
+	if !session.permissions.Include(code) {
+		return nil, errGraphQLNotPermitted
+	}
+	return session, nil
+}
+
+// The requireMaintainer() method checks the user making the request may edit
+// an entry, as requireMaintainer() does
+func (res *graphqlResolver) requireMaintainer(ctx context.Context, id graphql.ID) (*graphqlSession, int64, error) {
+	session, err := res.require(ctx, "entries:write")
+	if err != nil {
+		return nil, 0, err
+	}
+	entryID, err := parseGraphQLID(id)
+	if err != nil {
+		return nil, 0, err
+	}
+	ok, err := res.app.canMaintain(session.user, entryID)
+	if err != nil {
+		return nil, 0, res.app.graphqlServerError(err)
+	}
+	if !ok {
+		return nil, 0, errGraphQLNotPermitted
+	}
+	return session, entryID, nil
+}
+
+func (res *graphqlResolver) Me(ctx context.Context) *userResolver {
+	session := graphqlSessionFrom(ctx)
+	return newUserResolver(ctx, session.user.ID, session.user.Name)
+}
+
+func (res *graphqlResolver) Entry(ctx context.Context, args struct{ ID graphql.ID }) (*entryResolver, error) {
+	if _, err := res.require(ctx, "entries:read"); err != nil {
+		return nil, err
+	}
+	id, err := parseGraphQLID(args.ID)
+	if err != nil {
+		return nil, nil
+	}
+	entry, err := res.app.models.Entry.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return nil, nil
+		default:
+			return nil, res.app.graphqlServerError(err)
+		}
+	}
+	return newEntryResolvers(res.app, []*data.Entry{entry})[0], nil
+}
+
+// The arguments of the entries query
+type graphqlEntriesArgs struct {
+	Name          *string
+	Level         *string
+	Mode          *[]string
+	District      *string
+	WebsiteStatus *string
+	Phone         *string
+	Near          *struct {
+		Latitude  float64
+		Longitude float64
+	}
+	RadiusKm *float64
+	BBox     *struct {
+		MinLongitude float64
+		MinLatitude  float64
+		MaxLongitude float64
+		MaxLatitude  float64
+	}
+	Page     int32
+	PageSize int32
+	Sort     string
+	Cursor   *string
+}
+
+// Entries() reads a page of entries the same way listEntryHandler does.
+// Validation errors use the names of the REST query parameters
+func (res *graphqlResolver) Entries(ctx context.Context, args graphqlEntriesArgs) (*entryPageResolver, error) {
+	if _, err := res.require(ctx, "entries:read"); err != nil {
+		return nil, err
+	}
+	v := validator.New()
+	var filter data.EntryFilter
+	if args.Name != nil {
+		filter.Name = *args.Name
+	}
+	if args.Level != nil {
+		filter.Level = *args.Level
+	}
+	filter.Mode = []string{}
+	if args.Mode != nil {
+		filter.Mode = *args.Mode
+	}
+	if args.District != nil {
+		filter.District = *args.District
+	}
+	if args.WebsiteStatus != nil {
+		filter.WebsiteStatus = *args.WebsiteStatus
+	}
+	if args.Phone != nil && *args.Phone != "" {
+		number, ok := data.NormalizePhone(*args.Phone)
+		v.Check(ok, "phone", "must be a valid phone number")
+		filter.Phone = number
+	}
+	if args.Near != nil {
+		filter.Near = &data.GeoPoint{Latitude: args.Near.Latitude, Longitude: args.Near.Longitude}
+	}
+	if args.RadiusKm != nil {
+		filter.RadiusKm = *args.RadiusKm
+	}
+	if args.BBox != nil {
+		filter.BBox = &data.BoundingBox{
+			MinLongitude: args.BBox.MinLongitude,
+			MinLatitude:  args.BBox.MinLatitude,
+			MaxLongitude: args.BBox.MaxLongitude,
+			MaxLatitude:  args.BBox.MaxLatitude,
+		}
+	}
+	data.ValidateEntryFilter(v, filter)
+
+	filters := data.Filters{
+		Page:     int(args.Page),
+		PageSize: int(args.PageSize),
+		Sort:     args.Sort,
+		SortList: entrySortList(filter),
+	}
+	useCursor := args.Cursor != nil
+	if useCursor {
+		filters.Cursor = *args.Cursor
+	}
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		return nil, graphqlValidationError(v.Errors)
+	}
+
+	var entries []*data.Entry
+	var metadata data.Metadata
+	var err error
+	if useCursor {
+		entries, metadata, err = res.app.models.Entry.GetAllByCursor(filter, filters)
+	} else {
+		entries, metadata, err = res.app.models.Entry.GetAll(filter, filters)
+	}
+	if err != nil {
+		return nil, res.app.graphqlServerError(err)
+	}
+	return &entryPageResolver{entries: newEntryResolvers(res.app, entries), metadata: metadata}, nil
+}
+
+// A graphqlEntryInput holds the entry fields sent to a mutation. Fields that
+// were not sent are left alone
+type graphqlEntryInput struct {
+	Name      *string
+	Level     *string
+	Contact   *string
+	Phone     *string
+	Email     *string
+	Website   *string
+	Address   *string
+	District  *string
+	Mode      *[]string
+	Latitude  graphql.NullFloat
+	Longitude graphql.NullFloat
+}
+
+// apply() copies the fields that were sent onto an entry. Sending null for the
+// latitude or longitude clears it
+func (input graphqlEntryInput) apply(entry *data.Entry) {
+	fields := []struct {
+		value *string
+		dst   *string
+	}{
+		{input.Name, &entry.Name},
+		{input.Level, &entry.Level},
+		{input.Contact, &entry.Contact},
+		{input.Phone, &entry.Phone},
+		{input.Email, &entry.Email},
+		{input.Website, &entry.Website},
+		{input.Address, &entry.Address},
+		{input.District, &entry.District},
+	}
+	for _, field := range fields {
+		if field.value != nil {
+			*field.dst = *field.value
+		}
+	}
+	if input.Mode != nil {
+		entry.Mode = *input.Mode
+	}
+	if input.Latitude.Set {
+		entry.Latitude = input.Latitude.Value
+	}
+	if input.Longitude.Set {
+		entry.Longitude = input.Longitude.Value
+	}
+}
+
+// The validateEntry() method runs the same checks as the REST endpoints
+func (res *graphqlResolver) validateEntry(entry *data.Entry) error {
+	vocabulary, err := res.app.models.Vocabularies.Load()
+	if err != nil {
+		return res.app.graphqlServerError(err)
+	}
+	v := validator.New()
+	if data.ValidateEntries(v, entry, vocabulary); !v.Valid() {
+		return graphqlValidationError(v.Errors)
+	}
+	return nil
+}
+
+func (res *graphqlResolver) CreateEntry(ctx context.Context, args struct {
+	Input graphqlEntryInput
+	Force bool
+}) (*entryResolver, error) {
+	session, err := res.require(ctx, "entries:write")
+	if err != nil {
+		return nil, err
+	}
+	entry := &data.Entry{Mode: []string{}}
+	args.Input.apply(entry)
+	if err := res.validateEntry(entry); err != nil {
+		return nil, err
+	}
+	// Look for entries that are probably the same school
+	if !args.Force {
+		candidates, err := res.app.models.Entry.FindDuplicates(entry)
+		if err != nil {
+			return nil, res.app.graphqlServerError(err)
+		}
+		if len(candidates) > 0 {
+			return nil, &graphqlError{
+				message: "the entry looks like an existing entry, send force: true to create it anyway",
+				code:    "DUPLICATE_ENTRY",
+				details: envelope{"candidates": candidates},
+			}
+		}
+	}
+	err = res.app.models.Entry.Insert(entry, session.user.ID)
+	if err != nil {
+		return nil, res.app.graphqlServerError(err)
+	}
+	if err := res.app.emitEvent(data.EventEntryCreated, entry); err != nil {
+		return nil, res.app.graphqlServerError(err)
+	}
+	return newEntryResolvers(res.app, []*data.Entry{entry})[0], nil
+}
+
+func (res *graphqlResolver) UpdateEntry(ctx context.Context, args struct {
+	ID      graphql.ID
+	Version int32
+	Input   graphqlEntryInput
+}) (*entryResolver, error) {
+	session, id, err := res.requireMaintainer(ctx, args.ID)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := res.app.models.Entry.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return nil, errGraphQLNotFound
+		default:
+			return nil, res.app.graphqlServerError(err)
+		}
+	}
+	// The client's copy has to be current
+	if entry.Version != args.Version {
+		return nil, errGraphQLEditConflict
+	}
+	args.Input.apply(entry)
+	if err := res.validateEntry(entry); err != nil {
+		return nil, err
+	}
+	err = res.app.models.Entry.Update(entry, session.user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			return nil, errGraphQLEditConflict
+		default:
+			return nil, res.app.graphqlServerError(err)
+		}
+	}
+	if err := res.app.emitEvent(data.EventEntryUpdated, entry); err != nil {
+		return nil, res.app.graphqlServerError(err)
+	}
+	return newEntryResolvers(res.app, []*data.Entry{entry})[0], nil
+}
+
+func (res *graphqlResolver) DeleteEntry(ctx context.Context, args struct {
+	ID      graphql.ID
+	Version *int32
+}) (graphql.ID, error) {
+	_, id, err := res.requireMaintainer(ctx, args.ID)
+	if err != nil {
+		return "", err
+	}
+	var version int32
+	if args.Version != nil {
+		version = *args.Version
+	}
+	err = res.app.models.Entry.Delete(id, version)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return "", errGraphQLNotFound
+		case errors.Is(err, data.ErrEditConflict):
+			return "", errGraphQLEditConflict
+		default:
+			return "", res.app.graphqlServerError(err)
+		}
+	}
+	if err := res.app.emitEvent(data.EventEntryDeleted, envelope{"id": id}); err != nil {
+		return "", res.app.graphqlServerError(err)
+	}
+	return args.ID, nil
+}
+
+// An entryBatch is the entries returned by one query. Their creators and
+// maintainers are each read together the first time one is asked for
+type entryBatch struct {
+	entries         []*data.Entry
+	creatorsOnce    sync.Once
+	creators        map[int64]*data.PublicUser
+	creatorsErr     error
+	maintainersOnce sync.Once
+	maintainers     map[int64][]*data.Maintainer
+	maintainersErr  error
+}
+
+func (b *entryBatch) loadCreators(app *application) (map[int64]*data.PublicUser, error) {
+	b.creatorsOnce.Do(func() {
+		ids := []int64{}
+		for _, e := range b.entries {
+			if e.CreatedBy != 0 {
+				ids = append(ids, e.CreatedBy)
+			}
+		}
+		b.creators, b.creatorsErr = app.models.Users.GetPublic(ids)
+	})
+	return b.creators, b.creatorsErr
+}
+
+func (b *entryBatch) loadMaintainers(app *application) (map[int64][]*data.Maintainer, error) {
+	b.maintainersOnce.Do(func() {
+		ids := make([]int64, len(b.entries))
+		for i, e := range b.entries {
+			ids[i] = e.ID
+		}
+		b.maintainers, b.maintainersErr = app.models.Entry.GetMaintainersForEntries(ids)
+	})
+	return b.maintainers, b.maintainersErr
+}
+
+type entryResolver struct {
+	app   *application
+	entry *data.Entry
+	batch *entryBatch
+}
+
+func newEntryResolvers(app *application, entries []*data.Entry) []*entryResolver {
+	batch := &entryBatch{entries: entries}
+	resolvers := make([]*entryResolver, len(entries))
+	for i, e := range entries {
+		resolvers[i] = &entryResolver{app: app, entry: e, batch: batch}
+	}
+	return resolvers
+}
+
+// optionalString() returns nil for an empty string so it is shown as null
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// optionalInt() returns nil for zero so it is shown as null
+func optionalInt(n int) *int32 {
+	if n == 0 {
+		return nil
+	}
+	i := int32(n)
+	return &i
+}
+
+func (r *entryResolver) ID() graphql.ID {
+	return graphql.ID(strconv.FormatInt(r.entry.ID, 10))
+}
+
+func (r *entryResolver) Name() string         { return r.entry.Name }
+func (r *entryResolver) Level() string        { return r.entry.Level }
+func (r *entryResolver) Contact() string      { return r.entry.Contact }
+func (r *entryResolver) Phone() string        { return r.entry.Phone }
+func (r *entryResolver) PhoneE164() *string   { return optionalString(r.entry.PhoneE164) }
+func (r *entryResolver) Email() *string       { return optionalString(r.entry.Email) }
+func (r *entryResolver) Website() *string     { return optionalString(r.entry.Website) }
+func (r *entryResolver) Address() string      { return r.entry.Address }
+func (r *entryResolver) District() *string    { return optionalString(r.entry.District) }
+func (r *entryResolver) Version() int32       { return r.entry.Version }
+func (r *entryResolver) Latitude() *float64   { return r.entry.Latitude }
+func (r *entryResolver) Longitude() *float64  { return r.entry.Longitude }
+func (r *entryResolver) DistanceKm() *float64 { return r.entry.Distance }
+
+func (r *entryResolver) Mode() []string {
+	if r.entry.Mode == nil {
+		return []string{}
+	}
+	return r.entry.Mode
+}
+
+// WebsiteStatus() is null until the website has been checked
+func (r *entryResolver) WebsiteStatus() *int32 {
+	if r.entry.WebsiteCheckedAt == nil {
+		return nil
+	}
+	status := int32(r.entry.WebsiteStatus)
+	return &status
+}
+
+func (r *entryResolver) WebsiteCheckedAt() *graphql.Time {
+	if r.entry.WebsiteCheckedAt == nil {
+		return nil
+	}
+	return &graphql.Time{Time: *r.entry.WebsiteCheckedAt}
+}
+
+func (r *entryResolver) Creator(ctx context.Context) (*userResolver, error) {
+	if r.entry.CreatedBy == 0 {
+		return nil, nil
+	}
+	creators, err := r.batch.loadCreators(r.app)
+	if err != nil {
+		return nil, r.app.graphqlServerError(err)
+	}
+	creator, ok := creators[r.entry.CreatedBy]
+	if !ok {
+		return nil, nil
+	}
+	return newUserResolver(ctx, creator.ID, creator.Name), nil
+}
+
+func (r *entryResolver) Maintainers(ctx context.Context) ([]*maintainerResolver, error) {
+	batch, err := r.batch.loadMaintainers(r.app)
+	if err != nil {
+		return nil, r.app.graphqlServerError(err)
+	}
+	maintainers := batch[r.entry.ID]
+	resolvers := make([]*maintainerResolver, len(maintainers))
+	for i, maintainer := range maintainers {
+		resolvers[i] = &maintainerResolver{
+			user:    newUserResolver(ctx, maintainer.UserID, maintainer.Name),
+			addedAt: maintainer.AddedAt,
+		}
+	}
+	return resolvers, nil
+}
+
+type entryPageResolver struct {
+	entries  []*entryResolver
+	metadata data.Metadata
+}
+
+func (r *entryPageResolver) Entries() []*entryResolver { return r.entries }
+
+func (r *entryPageResolver) Metadata() *metadataResolver {
+	return &metadataResolver{metadata: r.metadata}
+}
+
+// Fields that are left out of the REST metadata are null
+type metadataResolver struct {
+	metadata data.Metadata
+}
+
+func (r *metadataResolver) CurrentPage() *int32  { return optionalInt(r.metadata.CurrentPage) }
+func (r *metadataResolver) PageSize() *int32     { return optionalInt(r.metadata.PageSize) }
+func (r *metadataResolver) FirstPage() *int32    { return optionalInt(r.metadata.FirstPage) }
+func (r *metadataResolver) LastPage() *int32     { return optionalInt(r.metadata.LastPage) }
+func (r *metadataResolver) TotalRecords() *int32 { return optionalInt(r.metadata.TotalRecords) }
+func (r *metadataResolver) NextCursor() *string  { return optionalString(r.metadata.NextCursor) }
+func (r *metadataResolver) PrevCursor() *string  { return optionalString(r.metadata.PrevCursor) }
+
+type maintainerResolver struct {
+	user    *userResolver
+	addedAt time.Time
+}
+
+func (r *maintainerResolver) User() *userResolver   { return r.user }
+func (r *maintainerResolver) AddedAt() graphql.Time { return graphql.Time{Time: r.addedAt} }
+
+// A userResolver only has a session when it is the user making the request
+type userResolver struct {
+	id      int64
+	name    string
+	session *graphqlSession
+}
+
+func newUserResolver(ctx context.Context, id int64, name string) *userResolver {
+	r := &userResolver{id: id, name: name}
+	if session := graphqlSessionFrom(ctx); session.user.ID == id {
+		r.session = session
+	}
+	return r
+}
+
+func (r *userResolver) ID() graphql.ID {
+	return graphql.ID(strconv.FormatInt(r.id, 10))
+}
+
+func (r *userResolver) Name() string { return r.name }
+
+func (r *userResolver) Email() *string {
+	if r.session == nil {
+		return nil
+	}
+	return &r.session.user.Email
+}
+
+func (r *userResolver) Permissions() *permissionsResolver {
+	if r.session == nil {
+		return nil
+	}
+	return &permissionsResolver{permissions: r.session.permissions}
+}
+
+type permissionsResolver struct {
+	permissions data.Permissions
+}
+
+func (r *permissionsResolver) Codes() []string {
+	if r.permissions == nil {
+		return []string{}
+	}
+	return r.permissions
+}
+
+func (r *permissionsResolver) Include(args struct{ Code string }) bool {
+	return r.permissions.Include(args.Code)
+}
@@ -0,0 +1,71 @@
+// Filename: cmd/api/graphql_test.go
+
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestGraphQLMaintainersBatched(t *testing.T) {
+	srv, mock := newTestServer(t, nil)
+	expectUser(mock, 1, "entries:read")
+	columns := append(append([]string{"total"}, entryColumnNames...), "distance")
+	rows := sqlmock.NewRows(columns)
+	for _, id := range []int64{1, 2, 3} {
+		rows.AddRow(append(append([]driver.Value{3}, entryRow(id, "School")...), nil)...)
+	}
+	mock.ExpectQuery("FROM entries").WillReturnRows(rows)
+	// One query covers every entry on the page
+	mock.ExpectQuery("FROM entry_maintainers(.|\\s)+entry_id = ANY\\(\\$1\\)").
+		WithArgs("{1,2,3}").
+		WillReturnRows(sqlmock.NewRows([]string{"entry_id", "id", "name", "added_at"}).
+			AddRow(1, 1, "Alice", time.Now()).
+			AddRow(3, 1, "Alice", time.Now()).
+			AddRow(3, 2, "Bob", time.Now()))
+
+	body := `{"query": "{ entries { entries { id maintainers { user { name } } } } }"}`
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/v1/graphql", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	res, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	var result struct {
+		Data struct {
+			Entries struct {
+				Entries []struct {
+					ID          string
+					Maintainers []struct {
+						User struct{ Name string }
+					}
+				}
+			}
+		}
+		Errors []interface{}
+	}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Errors) > 0 {
+		t.Fatalf("got errors %v", result.Errors)
+	}
+	got := map[string]int{}
+	for _, entry := range result.Data.Entries.Entries {
+		got[entry.ID] = len(entry.Maintainers)
+	}
+	if len(got) != 3 || got["1"] != 1 || got["2"] != 0 || got["3"] != 2 {
+		t.Errorf("got maintainer counts %v; want 1: 1, 2: 0, 3: 2", got)
+	}
+}
@@ -0,0 +1,520 @@
+// Filename: cmd/api/grpc.go
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"kriol.camerontillett.net/internal/data"
+	"kriol.camerontillett.net/internal/entrypb"
+	"kriol.camerontillett.net/internal/validator"
+)
+
+// The permission each EntryService method needs. Update and Delete also check
+// that the user maintains the entry
+var grpcPermissions = map[string]string{
+	entrypb.EntryService_Get_FullMethodName:    "entries:read",
+	entrypb.EntryService_List_FullMethodName:   "entries:read",
+	entrypb.EntryService_Watch_FullMethodName:  "entries:read",
+	entrypb.EntryService_Create_FullMethodName: "entries:write",
+	entrypb.EntryService_Update_FullMethodName: "entries:write",
+	entrypb.EntryService_Delete_FullMethodName: "entries:write",
+}
+
+// The grpcServer() method returns the gRPC server with the EntryService
+// registered
+func (app *application) grpcServer() *grpc.Server {
+	srv := grpc.NewServer(
+		grpc.UnaryInterceptor(app.grpcUnaryInterceptor),
+		grpc.StreamInterceptor(app.grpcStreamInterceptor),
+	)
+	entrypb.RegisterEntryServiceServer(srv, &entryService{app: app})
+	return srv
+}
+
+// The grpcAuthorize() method does for gRPC what the authenticate(),
+// requireActivatedUser() and requirePermission() middleware do for HTTP. The
+// bearer token comes from the "authorization" metadata
+func (app *application) grpcAuthorize(ctx context.Context, method string) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "you must be authenticated to access this resource")
+	}
+	headerParts := strings.Split(values[0], " ")
+	if len(values) != 1 || len(headerParts) != 2 || headerParts[0] != "Bearer" {
+		return nil, status.Error(codes.Unauthenticated, "invalid or missing authentication token")
+	}
+	token := headerParts[1]
+	v := validator.New()
+	if data.ValidateTokenPlaintext(v, token); !v.Valid() {
+		return nil, status.Error(codes.Unauthenticated, "invalid or missing authentication token")
+	}
+	user, err := app.models.Users.GetForToken(data.ScopeAuthentication, token)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return nil, status.Error(codes.Unauthenticated, "invalid or missing authentication token")
+		default:
+			return nil, app.grpcError(err)
+		}
+	}
+	if !user.Activated {
+		return nil, status.Error(codes.PermissionDenied, "your user account must be activated to access this resource")
+	}
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		return nil, app.grpcError(err)
+	}
+	code, ok := grpcPermissions[method]
+	if !ok || !permissions.Include(code) {
+		return nil, status.Error(codes.PermissionDenied, "your user account does not have the necessary permissions to access this resource")
+	}
+	return context.WithValue(ctx, userContextKey, user), nil
+}
+
+// grpcUser() returns the user added to the context by grpcAuthorize()
+func grpcUser(ctx context.Context) *data.User {
+	user, ok := ctx.Value(userContextKey).(*data.User)
+	if !ok {
+		panic("missing user value in request context")
+	}
+	return user
+}
+
+// The grpcRecover() method turns a panic into an Internal error, as
+// recoverPanic() does for HTTP
+func (app *application) grpcRecover(err *error) {
+	if p := recover(); p != nil {
+		*err = app.grpcError(fmt.Errorf("%v", p))
+	}
+}
+
+func (app *application) grpcUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	defer app.grpcRecover(&err)
+	ctx, err = app.grpcAuthorize(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (app *application) grpcStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer app.grpcRecover(&err)
+	ctx, err := app.grpcAuthorize(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authorizedStream{ServerStream: ss, ctx: ctx})
+}
+
+// An authorizedStream carries the context with the user in it
+type authorizedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authorizedStream) Context() context.Context {
+	return s.ctx
+}
+
+// The grpcError() method maps the model errors to gRPC status codes. Anything
+// else is logged and hidden from the client
+func (app *application) grpcError(err error) error {
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+		return status.Error(codes.NotFound, "the requested resource could not be found")
+	case errors.Is(err, data.ErrEditConflict):
+		return status.Error(codes.Aborted, "unable to update the record due to an edit conflict, please try again")
+	default:
+		app.logger.PrintError(err, nil)
+		return status.Error(codes.Internal, "the server encounted a problem and could not process the request")
+	}
+}
+
+// grpcValidationError() returns an InvalidArgument status with a field
+// violation for each validation error
+func grpcValidationError(errors map[string]string) error {
+	fields := make([]string, 0, len(errors))
+	for field := range errors {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	details := &errdetails.BadRequest{}
+	for _, field := range fields {
+		details.FieldViolations = append(details.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       field,
+			Description: errors[field],
+		})
+	}
+	st := status.New(codes.InvalidArgument, "the input failed validation")
+	if withDetails, err := st.WithDetails(details); err == nil {
+		st = withDetails
+	}
+	return st.Err()
+}
+
+// toProtoEntry() converts an entry for a gRPC response
+func toProtoEntry(e *data.Entry) *entrypb.Entry {
+	return &entrypb.Entry{
+		Id:         e.ID,
+		Name:       e.Name,
+		Level:      e.Level,
+		Contact:    e.Contact,
+		Phone:      e.Phone,
+		PhoneE164:  e.PhoneE164,
+		Email:      e.Email,
+		Website:    e.Website,
+		Address:    e.Address,
+		District:   e.District,
+		Mode:       e.Mode,
+		Version:    e.Version,
+		Latitude:   e.Latitude,
+		Longitude:  e.Longitude,
+		CreatedBy:  e.CreatedBy,
+		DistanceKm: e.Distance,
+	}
+}
+
+// The fields an UpdateRequest's mask may name
+var entryMaskPaths = []string{"name", "level", "contact", "phone", "email", "website", "address", "district", "mode", "latitude", "longitude"}
+
+// applyEntryMask() copies the fields named in an update mask onto an entry.
+// A latitude or longitude that is named but not set is cleared
+func applyEntryMask(e *data.Entry, in *entrypb.Entry, paths []string, v *validator.Validator) {
+	v.Check(len(paths) > 0, "update_mask", "must name at least one field")
+	for _, path := range paths {
+		switch path {
+		case "name":
+			e.Name = in.GetName()
+		case "level":
+			e.Level = in.GetLevel()
+		case "contact":
+			e.Contact = in.GetContact()
+		case "phone":
+			e.Phone = in.GetPhone()
+		case "email":
+			e.Email = in.GetEmail()
+		case "website":
+			e.Website = in.GetWebsite()
+		case "address":
+			e.Address = in.GetAddress()
+		case "district":
+			e.District = in.GetDistrict()
+		case "mode":
+			e.Mode = in.GetMode()
+		case "latitude":
+			e.Latitude = in.Latitude
+		case "longitude":
+			e.Longitude = in.Longitude
+		default:
+			v.AddError("update_mask", "may only contain "+strings.Join(entryMaskPaths, ", "))
+		}
+	}
+}
+
+// The entryService implements the EntryService on top of data.Models
+type entryService struct {
+	entrypb.UnimplementedEntryServiceServer
+	app *application
+}
+
+// The validateEntry() method runs the same checks as the REST endpoints
+func (s *entryService) validateEntry(e *data.Entry) error {
+	vocabulary, err := s.app.models.Vocabularies.Load()
+	if err != nil {
+		return s.app.grpcError(err)
+	}
+	v := validator.New()
+	if data.ValidateEntries(v, e, vocabulary); !v.Valid() {
+		return grpcValidationError(v.Errors)
+	}
+	return nil
+}
+
+// The requireMaintainer() method checks the user may edit an entry, as
+// requireMaintainer() does for HTTP
+func (s *entryService) requireMaintainer(ctx context.Context, id int64) error {
+	if id < 1 {
+		return s.app.grpcError(data.ErrRecordNotFound)
+	}
+	ok, err := s.app.canMaintain(grpcUser(ctx), id)
+	if err != nil {
+		return s.app.grpcError(err)
+	}
+	if !ok {
+		return status.Error(codes.PermissionDenied, "your user account does not have the necessary permissions to access this resource")
+	}
+	return nil
+}
+
+func (s *entryService) Get(ctx context.Context, req *entrypb.GetRequest) (*entrypb.Entry, error) {
+	if req.GetId() < 1 {
+		return nil, s.app.grpcError(data.ErrRecordNotFound)
+	}
+	e, err := s.app.models.Entry.Get(req.GetId())
+	if err != nil {
+		return nil, s.app.grpcError(err)
+	}
+	return toProtoEntry(e), nil
+}
+
+// List() reads a page of entries the same way listEntryHandler does. Field
+// violations use the names of the REST query parameters
+func (s *entryService) List(ctx context.Context, req *entrypb.ListRequest) (*entrypb.ListResponse, error) {
+	v := validator.New()
+	filter := data.EntryFilter{
+		Name:          req.GetName(),
+		Level:         req.GetLevel(),
+		Mode:          req.GetMode(),
+		District:      req.GetDistrict(),
+		WebsiteStatus: req.GetWebsiteStatus(),
+		RadiusKm:      req.GetRadiusKm(),
+	}
+	if filter.Mode == nil {
+		filter.Mode = []string{}
+	}
+	if req.GetPhone() != "" {
+		number, ok := data.NormalizePhone(req.GetPhone())
+		v.Check(ok, "phone", "must be a valid phone number")
+		filter.Phone = number
+	}
+	if near := req.GetNear(); near != nil {
+		filter.Near = &data.GeoPoint{Latitude: near.GetLatitude(), Longitude: near.GetLongitude()}
+	}
+	if bbox := req.GetBbox(); bbox != nil {
+		filter.BBox = &data.BoundingBox{
+			MinLongitude: bbox.GetMinLongitude(),
+			MinLatitude:  bbox.GetMinLatitude(),
+			MaxLongitude: bbox.GetMaxLongitude(),
+			MaxLatitude:  bbox.GetMaxLatitude(),
+		}
+	}
+	data.ValidateEntryFilter(v, filter)
+
+	// Unset paging fields get the REST defaults
+	filters := data.Filters{
+		Page:     int(req.GetPage()),
+		PageSize: int(req.GetPageSize()),
+		Sort:     req.GetSort(),
+		SortList: entrySortList(filter),
+		Cursor:   req.GetCursor(),
+	}
+	if filters.Page == 0 {
+		filters.Page = 1
+	}
+	if filters.PageSize == 0 {
+		filters.PageSize = 20
+	}
+	if filters.Sort == "" {
+		filters.Sort = "id"
+	}
+	useCursor := req.Cursor != nil
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		return nil, grpcValidationError(v.Errors)
+	}
+
+	var entries []*data.Entry
+	var metadata data.Metadata
+	var err error
+	if useCursor {
+		entries, metadata, err = s.app.models.Entry.GetAllByCursor(filter, filters)
+	} else {
+		entries, metadata, err = s.app.models.Entry.GetAll(filter, filters)
+	}
+	if err != nil {
+		return nil, s.app.grpcError(err)
+	}
+	resp := &entrypb.ListResponse{
+		Entries: make([]*entrypb.Entry, len(entries)),
+		Metadata: &entrypb.Metadata{
+			CurrentPage:  int32(metadata.CurrentPage),
+			PageSize:     int32(metadata.PageSize),
+			FirstPage:    int32(metadata.FirstPage),
+			LastPage:     int32(metadata.LastPage),
+			TotalRecords: int32(metadata.TotalRecords),
+			NextCursor:   metadata.NextCursor,
+			PrevCursor:   metadata.PrevCursor,
+		},
+	}
+	for i, e := range entries {
+		resp.Entries[i] = toProtoEntry(e)
+	}
+	return resp, nil
+}
+
+func (s *entryService) Create(ctx context.Context, req *entrypb.CreateRequest) (*entrypb.Entry, error) {
+	in := req.GetEntry()
+	e := &data.Entry{
+		Name:      in.GetName(),
+		Level:     in.GetLevel(),
+		Contact:   in.GetContact(),
+		Phone:     in.GetPhone(),
+		Email:     in.GetEmail(),
+		Website:   in.GetWebsite(),
+		Address:   in.GetAddress(),
+		District:  in.GetDistrict(),
+		Mode:      in.GetMode(),
+		Latitude:  in.Latitude,
+		Longitude: in.Longitude,
+	}
+	if e.Mode == nil {
+		e.Mode = []string{}
+	}
+	if err := s.validateEntry(e); err != nil {
+		return nil, err
+	}
+	// Look for entries that are probably the same school
+	if !req.GetForce() {
+		candidates, err := s.app.models.Entry.FindDuplicates(e)
+		if err != nil {
+			return nil, s.app.grpcError(err)
+		}
+		if len(candidates) > 0 {
+			ids := make([]string, len(candidates))
+			for i, candidate := range candidates {
+				ids[i] = strconv.FormatInt(candidate.ID, 10)
+			}
+			st := status.New(codes.AlreadyExists, "the entry looks like an existing entry, set force to create it anyway")
+			if withDetails, err := st.WithDetails(&errdetails.ErrorInfo{
+				Reason:   "DUPLICATE_ENTRY",
+				Metadata: map[string]string{"candidates": strings.Join(ids, ",")},
+			}); err == nil {
+				st = withDetails
+			}
+			return nil, st.Err()
+		}
+	}
+	err := s.app.models.Entry.Insert(e, grpcUser(ctx).ID)
+	if err != nil {
+		return nil, s.app.grpcError(err)
+	}
+	if err := s.app.emitEvent(data.EventEntryCreated, e); err != nil {
+		return nil, s.app.grpcError(err)
+	}
+	return toProtoEntry(e), nil
+}
+
+func (s *entryService) Update(ctx context.Context, req *entrypb.UpdateRequest) (*entrypb.Entry, error) {
+	in := req.GetEntry()
+	if err := s.requireMaintainer(ctx, in.GetId()); err != nil {
+		return nil, err
+	}
+	e, err := s.app.models.Entry.Get(in.GetId())
+	if err != nil {
+		return nil, s.app.grpcError(err)
+	}
+	// The client's copy has to be current
+	if e.Version != in.GetVersion() {
+		return nil, s.app.grpcError(data.ErrEditConflict)
+	}
+	v := validator.New()
+	if applyEntryMask(e, in, req.GetUpdateMask().GetPaths(), v); !v.Valid() {
+		return nil, grpcValidationError(v.Errors)
+	}
+	if err := s.validateEntry(e); err != nil {
+		return nil, err
+	}
+	err = s.app.models.Entry.Update(e, grpcUser(ctx).ID)
+	if err != nil {
+		return nil, s.app.grpcError(err)
+	}
+	if err := s.app.emitEvent(data.EventEntryUpdated, e); err != nil {
+		return nil, s.app.grpcError(err)
+	}
+	return toProtoEntry(e), nil
+}
+
+func (s *entryService) Delete(ctx context.Context, req *entrypb.DeleteRequest) (*emptypb.Empty, error) {
+	if err := s.requireMaintainer(ctx, req.GetId()); err != nil {
+		return nil, err
+	}
+	err := s.app.models.Entry.Delete(req.GetId(), req.GetVersion())
+	if err != nil {
+		return nil, s.app.grpcError(err)
+	}
+	if err := s.app.emitEvent(data.EventEntryDeleted, envelope{"id": req.GetId()}); err != nil {
+		return nil, s.app.grpcError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// toProtoEvent() converts an entry event for a Watch stream
+func toProtoEvent(event *data.EntryEvent) *entrypb.EntryEvent {
+	return &entrypb.EntryEvent{
+		Id:        event.ID,
+		CreatedAt: timestamppb.New(event.CreatedAt),
+		EntryId:   event.EntryID,
+		Action:    event.Action,
+		Version:   event.Version,
+		Name:      event.Name,
+		Level:     event.Level,
+		Mode:      event.Mode,
+	}
+}
+
+// Watch() sends entry events from the same feed as GET /v1/entries/stream. A
+// client that falls behind gets Unavailable and should resume from the last
+// event it received
+func (s *entryService) Watch(req *entrypb.WatchRequest, stream entrypb.EntryService_WatchServer) error {
+	v := validator.New()
+	v.Check(req.GetLastEventId() >= 0, "last_event_id", "must be a positive integer")
+	filter, err := s.app.readEntryEventFilter(req.GetLevel(), req.GetMode(), v)
+	if err != nil {
+		return s.app.grpcError(err)
+	}
+	if !v.Valid() {
+		return grpcValidationError(v.Errors)
+	}
+
+	// Subscribe before replaying so nothing is missed in between
+	events := s.app.entryEvents.subscribe()
+	defer s.app.entryEvents.unsubscribe(events)
+
+	lastID := req.GetLastEventId()
+	send := func(event *data.EntryEvent) error {
+		lastID = event.ID
+		if !filter.matches(event) {
+			return nil
+		}
+		return stream.Send(toProtoEvent(event))
+	}
+	if lastID > 0 {
+		err := s.app.replayEntryEvents(lastID, send)
+		if err != nil {
+			if _, ok := status.FromError(err); ok {
+				return err
+			}
+			return s.app.grpcError(err)
+		}
+	}
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return status.FromContextError(stream.Context().Err()).Err()
+		case event, ok := <-events:
+			if !ok {
+				return status.Error(codes.Unavailable, "the stream was closed, resume from the last event received")
+			}
+			if event.ID <= lastID {
+				continue
+			}
+			if err := send(event); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"strings"
 
 	"github.com/julienschmidt/httprouter"
+	"kriol.camerontillett.net/internal/data"
 	"kriol.camerontillett.net/internal/validator"
 )
 
@@ -30,6 +31,18 @@ func (app *application) readIDParam(r *http.Request) (int64, error) {
 	return id, nil
 }
 
+// The readVersionParam() method returns the ":v" parameter used by the
+// entry revision routes
+func (app *application) readVersionParam(r *http.Request) (int32, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+	// Versions start at 1 and are stored as integers
+	version, err := strconv.ParseInt(params.ByName("v"), 10, 32)
+	if err != nil || version < 1 {
+		return 0, errors.New("invalid version parameter")
+	}
+	return int32(version), nil
+}
+
 func (app *application) writeJSON(w http.ResponseWriter, status int, data envelope, headers http.Header) error {
 	// Convert our map into a JSON object
 	js, err := json.MarshalIndent(data, "", "\t")
@@ -148,6 +161,95 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 	return intValue
 }
 
+// The readFloat() method converts a string value from the query string to a float
+// value. If the value cannot be converted then a validation error is added to
+// the validation errors map
+func (app *application) readFloat(qs url.Values, key string, defaultValue float64, v *validator.Validator) float64 {
+	// Get the value
+	value := qs.Get(key)
+	if value == "" {
+		return defaultValue
+	}
+	// Perform the conversion to a float
+	floatValue, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		v.AddError(key, "must be a number")
+		return defaultValue
+	}
+	return floatValue
+}
+
+// The readFloatCSV() method splits a comma separated value into exactly n floats.
+// It returns nil if the key is missing or adds a validation error if the value
+// is not made up of n numbers
+func (app *application) readFloatCSV(qs url.Values, key string, n int, v *validator.Validator) []float64 {
+	parts := app.readCSV(qs, key, nil)
+	if parts == nil {
+		return nil
+	}
+	if len(parts) != n {
+		v.AddError(key, fmt.Sprintf("must contain %d comma separated numbers", n))
+		return nil
+	}
+	values := make([]float64, n)
+	for i, part := range parts {
+		value, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			v.AddError(key, fmt.Sprintf("must contain %d comma separated numbers", n))
+			return nil
+		}
+		values[i] = value
+	}
+	return values
+}
+
+// The readBool() method converts a string value from the query string to a boolean
+// value. If the value cannot be converted then a validation error is added to
+// the validation errors map
+func (app *application) readBool(qs url.Values, key string, defaultValue bool, v *validator.Validator) bool {
+	// Get the value
+	value := qs.Get(key)
+	if value == "" {
+		return defaultValue
+	}
+	// Perform the conversion to a boolean
+	boolValue, err := strconv.ParseBool(value)
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return defaultValue
+	}
+	return boolValue
+}
+
+// The pageLinks() method builds an RFC 8288 Link header value pointing at the
+// next and previous pages of a listing. Cursor pages link by cursor and
+// numbered pages link by page number
+func (app *application) pageLinks(r *http.Request, metadata data.Metadata) string {
+	// link() copies the current URL and swaps in a new query value
+	link := func(key, value, rel string) string {
+		u := *r.URL
+		qs := u.Query()
+		qs.Set(key, value)
+		u.RawQuery = qs.Encode()
+		return fmt.Sprintf(`<%s>; rel="%s"`, u.RequestURI(), rel)
+	}
+
+	links := []string{}
+	if metadata.NextCursor != "" {
+		links = append(links, link("cursor", metadata.NextCursor, "next"))
+	}
+	if metadata.PrevCursor != "" {
+		links = append(links, link("cursor", metadata.PrevCursor, "prev"))
+	}
+	if metadata.CurrentPage > 0 && metadata.CurrentPage < metadata.LastPage {
+		links = append(links, link("page", strconv.Itoa(metadata.CurrentPage+1), "next"))
+	}
+	if metadata.CurrentPage > 1 {
+		links = append(links, link("page", strconv.Itoa(metadata.CurrentPage-1), "prev"))
+	}
+	return strings.Join(links, ", ")
+}
+
 // background accepts a function as its parameter
 func (app *application) background(fn func()) {
 	// increment the waitGroup counter
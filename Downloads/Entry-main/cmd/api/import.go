@@ -0,0 +1,250 @@
+// Filename: cmd/api/import.go
+
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"kriol.camerontillett.net/internal/data"
+	"kriol.camerontillett.net/internal/validator"
+)
+
+const (
+	// Uploads are limited to 10 MB 10 * 2^20
+	maxImportBytes = 10_485_760
+	// The most rows a single import may contain
+	maxImportRows = 5000
+)
+
+// errUnsupportedImportType is returned when the upload is neither CSV nor multipart
+var errUnsupportedImportType = errors.New("unsupported import content type")
+
+// importRow is the outcome of validating one row of the uploaded file.
+// Row numbers match the spreadsheet, so the header is row 1
+type importRow struct {
+	Row    int               `json:"row"`
+	ID     int64             `json:"id,omitempty"`
+	Errors map[string]string `json:"errors,omitempty"`
+	// The existing entries a row looks like, unless force=true was sent
+	Candidates []*data.DuplicateCandidate `json:"candidates,omitempty"`
+}
+
+// importEntryHandler for the "POST /v1/entries/import" endpoint
+// With dry_run=true the file is only validated. Otherwise every valid row is
+// inserted in a single transaction and the invalid rows are reported back.
+// Rows that look like an existing entry are invalid unless force=true is sent
+func (app *application) importEntryHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+	dryRun := app.readBool(qs, "dry_run", false, v)
+	// force=true skips the duplicate check
+	force := app.readBool(qs, "force", false, v)
+	delimiter := app.readString(qs, "mode_delimiter", ";")
+	v.Check(len(delimiter) == 1, "mode_delimiter", "must be a single character")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Get the CSV data out of the request
+	body, err := app.readImportBody(w, r)
+	if err != nil {
+		switch {
+		case errors.Is(err, errUnsupportedImportType):
+			app.unsupportedMediaTypeResponse(w, r, r.Header.Get("Content-Type"))
+		default:
+			app.badRequestResponse(w, r, err)
+		}
+		return
+	}
+
+	// Validate every row
+	entries, rows, err := parseImport(body, delimiter)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	vocabulary, err := app.models.Vocabularies.Load()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	valid := []*data.Entry{}
+	validRows := []*importRow{}
+	for i, entry := range entries {
+		rowValidator := validator.New()
+		if data.ValidateEntries(rowValidator, entry, vocabulary); !rowValidator.Valid() {
+			rows[i].Errors = rowValidator.Errors
+			continue
+		}
+		// Look for entries that are probably the same school
+		if !force {
+			candidates, err := app.models.Entry.FindDuplicates(entry)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+			if len(candidates) > 0 {
+				rows[i].Errors = map[string]string{"entry": "looks like an existing entry, send force=true to import it anyway"}
+				rows[i].Candidates = candidates
+				continue
+			}
+		}
+		valid = append(valid, entry)
+		validRows = append(validRows, rows[i])
+	}
+
+	// Write the valid rows unless this is a dry run
+	status := http.StatusOK
+	if !dryRun && len(valid) > 0 {
+		user := app.contextGetUser(r)
+		err = app.models.Entry.InsertMany(valid, user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		for i, entry := range valid {
+			validRows[i].ID = entry.ID
+			if err := app.emitEvent(data.EventEntryCreated, entry); err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+		}
+		status = http.StatusCreated
+	}
+
+	report := envelope{
+		"dry_run":      dryRun,
+		"total_rows":   len(rows),
+		"valid_rows":   len(valid),
+		"invalid_rows": len(rows) - len(valid),
+		"rows":         rows,
+	}
+	err = app.writeJSON(w, status, envelope{"import": report}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The readImportBody() method returns the CSV data from either a text/csv
+// request body or the "file" field of a multipart upload
+func (app *application) readImportBody(w http.ResponseWriter, r *http.Request) (io.Reader, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, errUnsupportedImportType
+	}
+	switch mediaType {
+	case "text/csv":
+		return r.Body, nil
+	case "multipart/form-data":
+		err = r.ParseMultipartForm(maxImportBytes)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read upload: %w", err)
+		}
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			return nil, errors.New("the upload must contain a \"file\" field")
+		}
+		return file, nil
+	default:
+		return nil, errUnsupportedImportType
+	}
+}
+
+// parseImport() reads the CSV data and maps each row onto an Entry using the
+// header row to find the columns
+func parseImport(body io.Reader, modeDelimiter string) ([]*data.Entry, []*importRow, error) {
+	reader := csv.NewReader(body)
+	// Short rows are reported through validation instead of failing the file
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, nil, errors.New("the file must not be empty")
+		}
+		return nil, nil, fmt.Errorf("unable to read the header row: %w", err)
+	}
+	// Map each known column to its position
+	columns := map[string]int{}
+	for i, name := range header {
+		// Spreadsheet programs often start the file with a byte order mark
+		if i == 0 {
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !validator.In(name, "name", "level", "contact", "phone", "email", "website", "address", "district", "mode", "latitude", "longitude") {
+			return nil, nil, fmt.Errorf("the header contains unknown column %q", name)
+		}
+		if _, exists := columns[name]; exists {
+			return nil, nil, fmt.Errorf("the header contains column %q more than once", name)
+		}
+		columns[name] = i
+	}
+
+	entries := []*data.Entry{}
+	rows := []*importRow{}
+	for row := 2; ; row++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to read row %d: %w", row, err)
+		}
+		if len(entries) == maxImportRows {
+			return nil, nil, fmt.Errorf("the file must not contain more than %d rows", maxImportRows)
+		}
+		// Look up a column value, treating a missing cell as empty
+		field := func(name string) string {
+			i, ok := columns[name]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+		entry := &data.Entry{
+			Name:     field("name"),
+			Level:    field("level"),
+			Contact:  field("contact"),
+			Phone:    field("phone"),
+			Email:    field("email"),
+			Website:  field("website"),
+			Address:  field("address"),
+			District: field("district"),
+		}
+		// Split the mode list and drop any blanks
+		if mode := field("mode"); mode != "" {
+			for _, m := range strings.Split(mode, modeDelimiter) {
+				if m = strings.TrimSpace(m); m != "" {
+					entry.Mode = append(entry.Mode, m)
+				}
+			}
+		}
+		// A coordinate that is not a number is stored as NaN so that it
+		// fails the range check in ValidateEntries()
+		for name, dst := range map[string]**float64{"latitude": &entry.Latitude, "longitude": &entry.Longitude} {
+			if value := field(name); value != "" {
+				f, err := strconv.ParseFloat(value, 64)
+				if err != nil {
+					f = math.NaN()
+				}
+				*dst = &f
+			}
+		}
+		entries = append(entries, entry)
+		rows = append(rows, &importRow{Row: row})
+	}
+	return entries, rows, nil
+}
@@ -0,0 +1,64 @@
+// Filename: cmd/api/import_test.go
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"kriol.camerontillett.net/internal/data"
+)
+
+func TestImportReportsDuplicates(t *testing.T) {
+	srv, mock := newTestServer(t, nil)
+	expectUser(mock, 1, "entries:write")
+	mock.ExpectQuery("FROM vocabularies").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "kind", "code", "label", "aliases", "version"}).
+			AddRow(1, data.VocabularyLevel, "primary", "Primary", "{}", 1).
+			AddRow(2, data.VocabularyMode, "in-person", "In person", "{}", 1))
+	duplicateColumns := []string{"id", "name", "similarity", "name_match", "phone_match", "email_match", "website_match"}
+	mock.ExpectQuery("similarity\\(name, \\$1\\)").WithArgs("Belmopan Primary", sqlmock.AnyArg(), sqlmock.AnyArg(),
+		sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows(duplicateColumns).AddRow(7, "Belmopan Primary School", 0.8, true, false, false, false))
+	mock.ExpectQuery("similarity\\(name, \\$1\\)").WithArgs("Cayo Primary", sqlmock.AnyArg(), sqlmock.AnyArg(),
+		sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows(duplicateColumns))
+
+	csv := "name,level,contact,phone,email,website,address,mode\n" +
+		"Belmopan Primary,primary,Ms Young,223-4567,office@bps.edu.bz,https://bps.edu.bz,Belmopan,in-person\n" +
+		"Cayo Primary,primary,Mr Reyes,824-1234,office@cps.edu.bz,https://cps.edu.bz,San Ignacio,in-person\n"
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/v1/entries/import?dry_run=true", strings.NewReader(csv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	req.Header.Set("Content-Type", "text/csv")
+	res, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	var body struct {
+		Import struct {
+			ValidRows int          `json:"valid_rows"`
+			Rows      []*importRow `json:"rows"`
+		} `json:"import"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK || body.Import.ValidRows != 1 || len(body.Import.Rows) != 2 {
+		t.Fatalf("got %d with %+v; want one valid row of two", res.StatusCode, body.Import)
+	}
+	first := body.Import.Rows[0]
+	if first.Errors["entry"] == "" || len(first.Candidates) != 1 || first.Candidates[0].ID != 7 {
+		t.Errorf("got row %+v; want it flagged as a duplicate of entry 7", first)
+	}
+	if second := body.Import.Rows[1]; len(second.Errors) != 0 || len(second.Candidates) != 0 {
+		t.Errorf("got row %+v; want it valid", second)
+	}
+}
@@ -0,0 +1,99 @@
+// Filename: cmd/api/linkcheck.go
+
+package main
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"kriol.camerontillett.net/internal/data"
+)
+
+// checkWebsites() runs until the server shuts down. Every interval it checks a
+// batch of the websites that are due and records what it found
+func (app *application) checkWebsites() {
+	ticker := time.NewTicker(app.config.linkcheck.interval)
+	defer ticker.Stop()
+
+	for {
+		count, broken, err := app.checkWebsiteBatch()
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		} else if count > 0 {
+			app.logger.PrintInfo("checked entry websites", map[string]string{
+				"count":  strconv.Itoa(count),
+				"broken": strconv.Itoa(broken),
+			})
+		}
+		select {
+		case <-ticker.C:
+		case <-app.stopCtx.Done():
+			return
+		}
+	}
+}
+
+// The checkWebsiteBatch() method checks the websites that are due using a few
+// workers. The checker spaces out requests to the same host and its client
+// puts a time limit on each request. A shutdown cuts the batch short and the
+// websites left over are checked on the next run
+func (app *application) checkWebsiteBatch() (int, int, error) {
+	cfg := app.config.linkcheck
+	checks, err := app.models.Entry.GetWebsitesToCheck(time.Now().Add(-cfg.maxAge), cfg.batchSize)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	queue := make(chan *data.WebsiteCheck)
+	var mu sync.Mutex
+	broken := 0
+	workers := cfg.workers
+	if workers < 1 {
+		workers = 1
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for check := range queue {
+				result := app.linkChecker.Check(app.stopCtx, check.Website)
+				// Do not record a check the shutdown interrupted
+				if app.stopCtx.Err() != nil {
+					continue
+				}
+
+				check.CheckedAt = result.CheckedAt
+				check.Status = result.Status
+				check.Redirect = result.Redirect
+				check.Error = result.Err
+				if result.Broken() {
+					mu.Lock()
+					broken++
+					mu.Unlock()
+				}
+				err := app.models.Entry.SetWebsiteCheck(check)
+				if err != nil {
+					app.logger.PrintError(err, map[string]string{
+						"entry_id": strconv.FormatInt(check.EntryID, 10),
+					})
+				}
+			}
+		}()
+	}
+	count := 0
+feed:
+	for _, check := range checks {
+		select {
+		case queue <- check:
+			count++
+		case <-app.stopCtx.Done():
+			break feed
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	return count, broken, nil
+}
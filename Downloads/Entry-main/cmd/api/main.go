@@ -5,6 +5,7 @@ package main
 import (
     "context"
     "database/sql"
+    "errors"
     "flag"
     "strings"
     "os"
@@ -13,7 +14,10 @@ import (
 
     "kriol.camerontillett.net/internal/data"
     "kriol.camerontillett.net/internal/jsonlog"
+    "kriol.camerontillett.net/internal/linkcheck"
     "kriol.camerontillett.net/internal/mailer"
+    "kriol.camerontillett.net/internal/phone"
+    "kriol.camerontillett.net/internal/webhook"
     _ "github.com/lib/pq"
 )
 
@@ -29,6 +33,8 @@ const version = "1.0.0"
 // configuration settings from command-line flags when the application starts.
 type config struct {
     port int
+    // The port for the gRPC server. Zero turns it off
+    grpcPort int
     env  string
     db struct {
         dsn string
@@ -40,6 +46,9 @@ type config struct {
 		rps     float64 // requests/second
 		burst   int
 		enabled bool
+		// the stricter limit for anonymous suggestions
+		suggestionRPS   float64
+		suggestionBurst int
 	}
 
     smtp struct {
@@ -52,6 +61,33 @@ type config struct {
     cors struct {
 		trustedOrigins []string
 	}
+    trash struct {
+        retention time.Duration
+    }
+    phone struct {
+        region string
+    }
+    stream struct {
+        retention time.Duration
+    }
+    export struct {
+        timeout time.Duration
+    }
+    webhooks struct {
+        enabled     bool
+        interval    time.Duration
+        timeout     time.Duration
+        maxAttempts int
+    }
+    linkcheck struct {
+        enabled   bool
+        interval  time.Duration
+        maxAge    time.Duration
+        batchSize int
+        workers   int
+        timeout   time.Duration
+        hostDelay time.Duration
+    }
 }
 
 // Define an application struct to hold the dependencies for our HTTP handlers, helpers,
@@ -63,6 +99,17 @@ type application struct {
     models data.Models
     mailer mailer.Mailer
     wg     sync.WaitGroup
+    // Checks entry websites. Its HTTP client can be swapped out
+    linkChecker *linkcheck.Checker
+    // Sends webhook deliveries and is woken when new ones are queued
+    webhookSender *webhook.Sender
+    webhookWake   chan struct{}
+    // Passes entry events on to the open streams
+    entryEvents *eventHub
+    // Cancelled by serve() when the server shuts down. The background loops
+    // return once it is done
+    stopCtx context.Context
+    stop    context.CancelFunc
 }
 
 func main() {
@@ -73,6 +120,7 @@ func main() {
     // default to using the port number 4000 and the environment "development" if no
     // corresponding flags are provided.
     flag.IntVar(&cfg.port, "port", 4000, "API server port")
+    flag.IntVar(&cfg.grpcPort, "grpc-port", 4001, "gRPC server port (0 to disable)")
     flag.StringVar(&cfg.env, "env", "development", "Environment (development|staging|production)")
     flag.StringVar(&cfg.db.dsn, "db-dsn", os.Getenv("ENTRY_DB_DSN"), "PostgreSQL DSN")
     flag.IntVar(&cfg.db.maxOpenConns, "db-max-open-conns", 25, "PostgreSQL max open connections")
@@ -82,12 +130,35 @@ func main() {
 	flag.Float64Var(&cfg.limiter.rps, "limiter-rps", 2, "Rate limiter maximum requests per second")
 	flag.IntVar(&cfg.limiter.burst, "limiter-burst", 4, "Rate limiter maximum burst")
 	flag.BoolVar(&cfg.limiter.enabled, "limiter-enabled", true, "Enable rate limiter")
+	flag.Float64Var(&cfg.limiter.suggestionRPS, "limiter-suggestion-rps", 1.0/60, "Rate limiter maximum suggestions per second")
+	flag.IntVar(&cfg.limiter.suggestionBurst, "limiter-suggestion-burst", 3, "Rate limiter maximum suggestion burst")
     // These are our flags for the mailer
 	flag.StringVar(&cfg.smtp.host, "smtp-host", "smtp.mailtrap.io", "SMTP host")
 	flag.IntVar(&cfg.smtp.port, "smtp-port", 2525, "SMTP port")
 	flag.StringVar(&cfg.smtp.username, "smtp-username", "c0194294876720", "SMTP username")
 	flag.StringVar(&cfg.smtp.password, "smtp-password", "2d0dd5a84d6aeb", "SMTP password")
 	flag.StringVar(&cfg.smtp.sender, "smtp-sender", "Transit <no-reply@kriol.camerontillett.net>", "SMTP sender")
+    // How long deleted entries stay in the trash before they are purged
+    flag.DurationVar(&cfg.trash.retention, "trash-retention", 30*24*time.Hour, "How long deleted entries are kept before being purged")
+    // The country assumed for phone numbers without a country code
+    flag.StringVar(&cfg.phone.region, "phone-region", "BZ", "Default phone number country (ISO 3166 code)")
+    // These are our flags for the website checker
+    flag.BoolVar(&cfg.linkcheck.enabled, "linkcheck-enabled", true, "Enable the website checker")
+    flag.DurationVar(&cfg.linkcheck.interval, "linkcheck-interval", time.Hour, "How often the website checker runs")
+    flag.DurationVar(&cfg.linkcheck.maxAge, "linkcheck-max-age", 7*24*time.Hour, "How long before a website is checked again")
+    flag.IntVar(&cfg.linkcheck.batchSize, "linkcheck-batch-size", 200, "Websites checked per run")
+    flag.IntVar(&cfg.linkcheck.workers, "linkcheck-workers", 4, "Websites checked at the same time")
+    flag.DurationVar(&cfg.linkcheck.timeout, "linkcheck-timeout", 10*time.Second, "Time limit for each website request")
+    flag.DurationVar(&cfg.linkcheck.hostDelay, "linkcheck-host-delay", 2*time.Second, "Minimum time between requests to the same host")
+    // These are our flags for webhook deliveries
+    flag.BoolVar(&cfg.webhooks.enabled, "webhooks-enabled", true, "Enable sending webhook deliveries")
+    flag.DurationVar(&cfg.webhooks.interval, "webhooks-interval", 5*time.Second, "How often due webhook deliveries are looked for")
+    flag.DurationVar(&cfg.webhooks.timeout, "webhooks-timeout", 10*time.Second, "Time limit for each webhook delivery")
+    flag.IntVar(&cfg.webhooks.maxAttempts, "webhooks-max-attempts", 8, "Attempts before a webhook delivery is marked failed")
+    // This is our flag for the entry event stream
+    flag.DurationVar(&cfg.stream.retention, "stream-retention", 24*time.Hour, "How long entry events are kept for resuming streams")
+    // Exports take longer to write than other responses
+    flag.DurationVar(&cfg.export.timeout, "export-timeout", 10*time.Minute, "Time limit for writing an export")
     //Use the flag.Func() function to parse our trusted origins flag from a string to a slice of string
 	flag.Func("cors-trusted-origin", "Trusted CORS origins (space separated)", func(val string) error {
 		cfg.cors.trustedOrigins = strings.Fields(val)
@@ -101,6 +172,11 @@ func main() {
     // prefixed with the current date and time.
     logger := jsonlog.New(os.Stdout, jsonlog.LevelInfo)
 
+    if !phone.KnownRegion(cfg.phone.region) {
+        logger.PrintFatal(errors.New("unsupported phone region "+cfg.phone.region), nil)
+    }
+    data.PhoneRegion = strings.ToUpper(cfg.phone.region)
+
     // Create a connection pool
     db, err := openDB(cfg)
     if err != nil {
@@ -111,6 +187,9 @@ func main() {
     // Log the successful connection pool
 	logger.PrintInfo("database connection pool established", nil)
 
+    // The background loops run until the server shuts down
+    stopCtx, stop := context.WithCancel(context.Background())
+
     // Declare an instance of the application struct, containing the config struct and 
     // the logger.
     app := &application{
@@ -118,7 +197,25 @@ func main() {
         logger: logger,
         models: data.NewModels(db),
         mailer: mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
+        linkChecker: linkcheck.New(linkcheck.NewClient(cfg.linkcheck.timeout), cfg.linkcheck.hostDelay),
+        webhookSender: webhook.New(webhook.NewClient(cfg.webhooks.timeout)),
+        webhookWake: make(chan struct{}, 1),
+        entryEvents: newEventHub(),
+        stopCtx: stopCtx,
+        stop: stop,
+    }
+    // Purge old entries from the trash in the background
+    app.background(app.purgeTrash)
+    // Look for dead websites in the background
+    if cfg.linkcheck.enabled {
+        app.background(app.checkWebsites)
+    }
+    // Send webhook deliveries in the background
+    if cfg.webhooks.enabled {
+        app.background(app.deliverWebhooks)
     }
+    // Listen for entry events to stream
+    app.background(app.listenEntryEvents)
     // Call app.serve() to start the server
 	err = app.serve()
 	if err != nil {
@@ -0,0 +1,126 @@
+// Filename: cmd/api/merge.go
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"kriol.camerontillett.net/internal/data"
+	"kriol.camerontillett.net/internal/validator"
+)
+
+// mergeEntryHandler for the "POST /v1/entries/:id/merge?into=:other" endpoint
+// The entry is folded into the other one and then redirects to it
+func (app *application) mergeEntryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	// Read the entry we are merging into
+	v := validator.New()
+	into := int64(app.readInt(r.URL.Query(), "into", 0, v))
+	v.Check(into > 0, "into", "must be provided")
+	v.Check(into != id, "into", "must be a different entry")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	// The user has to be able to edit both entries
+	ok, err := app.canMaintain(app.contextGetUser(r), into)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !ok {
+		app.notPermittedResponse(w, r)
+		return
+	}
+	// Fetch both entries
+	from, err := app.models.Entry.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	entries, err := app.models.Entry.Get(into)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("into", "must be an existing entry")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Combine the fields and check the result
+	data.MergeEntries(entries, from)
+	vocabulary, err := app.models.Vocabularies.Load()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if data.ValidateEntries(v, entries, vocabulary); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+	err = app.models.Entry.Merge(from, entries, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	// The old entry is gone and the new one has taken on its details
+	if err := app.emitEvent(data.EventEntryUpdated, entries); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if err := app.emitEvent(data.EventEntryDeleted, envelope{"id": from.ID, "merged_into": entries.ID}); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/entries/%d", entries.ID))
+	err = app.writeJSON(w, http.StatusOK, envelope{"entries": entries}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The redirectMergedEntry() method is used when an entry cannot be found. If it
+// was merged into another entry the client is sent there, otherwise it gets a 404.
+// The redirect is temporary and not cached since restoring the old entry from
+// the trash removes it
+func (app *application) redirectMergedEntry(w http.ResponseWriter, r *http.Request, id int64) {
+	to, err := app.models.Entry.GetRedirect(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/entries/%d", to))
+	headers.Set("Cache-Control", "no-store")
+	err = app.writeJSON(w, http.StatusTemporaryRedirect, envelope{"merged_into": to}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
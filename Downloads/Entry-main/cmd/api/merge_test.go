@@ -0,0 +1,38 @@
+// Filename: cmd/api/merge_test.go
+
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestMergedEntryRedirectIsTemporary(t *testing.T) {
+	srv, mock := newTestServer(t, nil)
+	expectUser(mock, 1, "entries:read")
+	mock.ExpectQuery("FROM entries\\s+WHERE id = \\$1").WithArgs(4).WillReturnRows(sqlmock.NewRows(entryColumnNames))
+	mock.ExpectQuery("FROM entry_redirects").WithArgs(4).WillReturnRows(sqlmock.NewRows([]string{"to_id"}).AddRow(9))
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/v1/entries/4", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	client := srv.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	// Restoring the old entry removes the redirect, so nothing may hold on to it
+	if res.StatusCode != http.StatusTemporaryRedirect || res.Header.Get("Location") != "/v1/entries/9" {
+		t.Errorf("got %d to %q; want 307 to /v1/entries/9", res.StatusCode, res.Header.Get("Location"))
+	}
+	if res.Header.Get("Cache-Control") != "no-store" {
+		t.Errorf("got Cache-Control %q; want no-store", res.Header.Get("Cache-Control"))
+	}
+}
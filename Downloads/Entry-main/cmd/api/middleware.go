@@ -29,6 +29,16 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 }
 
 func (app *application) rateLimit(next http.Handler) http.Handler {
+	return app.limitByIP(app.config.limiter.rps, app.config.limiter.burst, next)
+}
+
+// Rate limit the public suggestion endpoint more tightly than the rest of the API
+func (app *application) suggestionRateLimit(next http.HandlerFunc) http.HandlerFunc {
+	return app.limitByIP(app.config.limiter.suggestionRPS, app.config.limiter.suggestionBurst, next).ServeHTTP
+}
+
+// The limitByIP() method gives every client IP address its own token bucket
+func (app *application) limitByIP(rps float64, burst int, next http.Handler) http.Handler {
 	// Create a client type
 	type client struct {
 		limiter  *rate.Limiter
@@ -66,10 +76,7 @@ func (app *application) rateLimit(next http.Handler) http.Handler {
 			mu.Lock()
 			// Check if the IP address is in the map
 			if _, found := clients[ip]; !found {
-				clients[ip] = &client{limiter: rate.NewLimiter(
-					rate.Limit(app.config.limiter.rps),
-					app.config.limiter.burst,
-				)}
+				clients[ip] = &client{limiter: rate.NewLimiter(rate.Limit(rps), burst)}
 			}
 			// Update the last seen time of the client
 			clients[ip].lastSeen = time.Now()
@@ -195,6 +202,8 @@ func (app *application) enableCORS(next http.Handler) http.Handler {
 			for i := range app.config.cors.trustedOrigins {
 				if origin == app.config.cors.trustedOrigins[i] {
 					w.Header().Set("Access-Control-Allow-Origin", origin)
+					// Let browsers read the caching and paging headers
+					w.Header().Set("Access-Control-Expose-Headers", "ETag, Link, Location")
 					break
 				}
 			}
@@ -202,4 +211,38 @@ func (app *application) enableCORS(next http.Handler) http.Handler {
 
 		next.ServeHTTP(w, r)
 	})
-}
\ No newline at end of file
+}
+
+// Check that the user may edit the entry named by the ":id" parameter. The
+// entry's maintainers and users with the entries:admin permission may edit it
+func (app *application) requireMaintainer(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := app.readIDParam(r)
+		if err != nil {
+			app.notFoundResponse(w, r)
+			return
+		}
+		ok, err := app.canMaintain(app.contextGetUser(r), id)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if !ok {
+			app.notPermittedResponse(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// The canMaintain() method reports whether a user may edit a specific entry
+func (app *application) canMaintain(user *data.User, entryID int64) (bool, error) {
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		return false, err
+	}
+	if permissions.Include("entries:admin") {
+		return true, nil
+	}
+	return app.models.Entry.IsMaintainer(entryID, user.ID)
+}
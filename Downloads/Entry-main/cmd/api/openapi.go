@@ -0,0 +1,24 @@
+// Filename: cmd/api/openapi.go
+
+package main
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// The OpenAPI 3.1 description of every route. openapi_test.go checks it
+// against routes() so a new route cannot be added without it
+//
+//go:embed openapi.json
+var openapiSpec []byte
+
+// openapiHandler for the "GET /v1/openapi.json" endpoint
+// The document is served as is rather than wrapped in an envelope so tools
+// can read it straight away
+func (app *application) openapiHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.WriteHeader(http.StatusOK)
+	w.Write(openapiSpec)
+}
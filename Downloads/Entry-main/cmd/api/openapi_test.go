@@ -0,0 +1,293 @@
+// Filename: cmd/api/openapi_test.go
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// A route as registered in routes() and what it asks of the caller
+type route struct {
+	method     string
+	path       string
+	permission string
+	auth       bool
+	maintainer bool
+}
+
+// An operation as described by openapi.json. Only the parts the tests look
+// at are decoded
+type operation struct {
+	Security    []map[string][]string      `json:"security"`
+	Permission  string                     `json:"x-permission"`
+	Maintainer  bool                       `json:"x-requires-maintainer"`
+	OperationID string                     `json:"operationId"`
+	Responses   map[string]json.RawMessage `json:"responses"`
+}
+
+type spec struct {
+	OpenAPI string                          `json:"openapi"`
+	Paths   map[string]map[string]operation `json:"paths"`
+}
+
+var pathParam = regexp.MustCompile(`:([a-z_]+)`)
+
+// readRoutes() parses routes.go and lists every route it registers. The
+// static names handled by subroutes() are listed as routes of their own
+func readRoutes(t *testing.T) []route {
+	t.Helper()
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "routes.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var routes []route
+	ast.Inspect(file, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || len(call.Args) != 3 || callName(call) != "HandlerFunc" {
+			return true
+		}
+		method, ok := call.Args[0].(*ast.SelectorExpr)
+		if !ok {
+			t.Fatalf("%s: the method is not an http.Method constant", fset.Position(call.Pos()))
+		}
+		path := stringArg(t, call.Args[1])
+		r := route{
+			method: strings.ToLower(strings.TrimPrefix(method.Sel.Name, "Method")),
+			path:   pathParam.ReplaceAllString(path, "{$1}"),
+		}
+
+		handler, ok := call.Args[2].(*ast.CallExpr)
+		if !ok || callName(handler) != "subroutes" {
+			routes = append(routes, describeHandler(t, r, call.Args[2]))
+			return false
+		}
+		static, ok := handler.Args[0].(*ast.CompositeLit)
+		if !ok {
+			t.Fatalf("%s: subroutes() is not given a map literal", fset.Position(handler.Pos()))
+		}
+		for _, elt := range static.Elts {
+			kv := elt.(*ast.KeyValueExpr)
+			sub := r
+			sub.path = strings.Replace(path, ":id", stringArg(t, kv.Key), 1)
+			routes = append(routes, describeHandler(t, sub, kv.Value))
+		}
+		if ident, ok := handler.Args[1].(*ast.Ident); !ok || ident.Name != "nil" {
+			routes = append(routes, describeHandler(t, r, handler.Args[1]))
+		}
+		return false
+	})
+	if len(routes) == 0 {
+		t.Fatal("no routes found in routes.go")
+	}
+	return routes
+}
+
+// describeHandler() fills in the permission a handler is wrapped in
+func describeHandler(t *testing.T, r route, handler ast.Expr) route {
+	ast.Inspect(handler, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		switch callName(call) {
+		case "requirePermission":
+			r.permission = stringArg(t, call.Args[0])
+			r.auth = true
+		case "requireActivatedUser", "requireAuthenticatedUser":
+			r.auth = true
+		case "requireMaintainer":
+			r.maintainer = true
+		}
+		return true
+	})
+	return r
+}
+
+func callName(call *ast.CallExpr) string {
+	if sel, ok := call.Fun.(*ast.SelectorExpr); ok {
+		return sel.Sel.Name
+	}
+	return ""
+}
+
+func stringArg(t *testing.T, expr ast.Expr) string {
+	t.Helper()
+	lit, ok := expr.(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		t.Fatalf("expected a string literal, got %T", expr)
+	}
+	s, err := strconv.Unquote(lit.Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func readSpec(t *testing.T) spec {
+	t.Helper()
+	var doc spec
+	err := json.Unmarshal(openapiSpec, &doc)
+	if err != nil {
+		t.Fatalf("openapi.json is not valid JSON: %v", err)
+	}
+	return doc
+}
+
+func TestOpenAPIVersion(t *testing.T) {
+	doc := readSpec(t)
+	if doc.OpenAPI != "3.1.0" {
+		t.Errorf("got openapi %q; want 3.1.0", doc.OpenAPI)
+	}
+}
+
+// TestOpenAPICoversRoutes fails when a route is added to routes() without
+// being described, or when its permissions are described wrongly
+func TestOpenAPICoversRoutes(t *testing.T) {
+	doc := readSpec(t)
+	routes := readRoutes(t)
+
+	seen := map[string]bool{}
+	for _, r := range routes {
+		name := strings.ToUpper(r.method) + " " + r.path
+		seen[name] = true
+		op, ok := doc.Paths[r.path][r.method]
+		if !ok {
+			t.Errorf("%s is not described in openapi.json", name)
+			continue
+		}
+		if op.Permission != r.permission {
+			t.Errorf("%s: got x-permission %q; want %q", name, op.Permission, r.permission)
+		}
+		if op.Maintainer != r.maintainer {
+			t.Errorf("%s: got x-requires-maintainer %t; want %t", name, op.Maintainer, r.maintainer)
+		}
+		_, bearer := securityScheme(op)["bearerAuth"]
+		if bearer != r.auth {
+			t.Errorf("%s: got bearerAuth security %t; want %t", name, bearer, r.auth)
+		}
+		if r.auth {
+			for _, status := range []string{"401", "403"} {
+				if _, ok := op.Responses[status]; !ok {
+					t.Errorf("%s: the %s response is not described", name, status)
+				}
+			}
+		}
+	}
+
+	var stale []string
+	for path, ops := range doc.Paths {
+		for method := range ops {
+			name := strings.ToUpper(method) + " " + path
+			if !seen[name] {
+				stale = append(stale, name)
+			}
+		}
+	}
+	sort.Strings(stale)
+	for _, name := range stale {
+		t.Errorf("%s is described in openapi.json but not routed", name)
+	}
+}
+
+func securityScheme(op operation) map[string][]string {
+	schemes := map[string][]string{}
+	for _, requirement := range op.Security {
+		for name, scopes := range requirement {
+			schemes[name] = scopes
+		}
+	}
+	return schemes
+}
+
+// TestOpenAPIOperationIDs checks every operation has its own ID, which
+// generated clients use as method names
+func TestOpenAPIOperationIDs(t *testing.T) {
+	doc := readSpec(t)
+	ids := map[string]string{}
+	for path, ops := range doc.Paths {
+		for method, op := range ops {
+			name := strings.ToUpper(method) + " " + path
+			if op.OperationID == "" {
+				t.Errorf("%s has no operationId", name)
+				continue
+			}
+			if other, ok := ids[op.OperationID]; ok {
+				t.Errorf("%s and %s share the operationId %q", name, other, op.OperationID)
+			}
+			ids[op.OperationID] = name
+		}
+	}
+}
+
+// TestOpenAPIReferences checks every $ref points at a component that exists
+func TestOpenAPIReferences(t *testing.T) {
+	var doc map[string]interface{}
+	err := json.Unmarshal(openapiSpec, &doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			if ref, ok := v["$ref"].(string); ok {
+				if resolve(doc, ref) == nil {
+					t.Errorf("%s does not resolve", ref)
+				}
+			}
+			for _, child := range v {
+				walk(child)
+			}
+		case []interface{}:
+			for _, child := range v {
+				walk(child)
+			}
+		}
+	}
+	walk(doc)
+}
+
+func resolve(doc map[string]interface{}, ref string) interface{} {
+	if !strings.HasPrefix(ref, "#/") {
+		return nil
+	}
+	var node interface{} = doc
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		m, ok := node.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		node = m[part]
+	}
+	return node
+}
+
+func TestOpenAPIHandler(t *testing.T) {
+	app := &application{}
+	rr := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/v1/openapi.json", nil)
+	app.routes().ServeHTTP(rr, r)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %d; want %d", rr.Code, http.StatusOK)
+	}
+	if got := rr.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("got Content-Type %q; want application/json", got)
+	}
+	if !bytes.Equal(rr.Body.Bytes(), openapiSpec) {
+		t.Error("the served document does not match openapi.json")
+	}
+}
@@ -0,0 +1,117 @@
+// Filename: cmd/api/patch.go
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	"kriol.camerontillett.net/internal/data"
+	"kriol.camerontillett.net/internal/jsonpatch"
+)
+
+// The largest patch document we accept, the same limit as readJSON()
+const maxPatchBytes = 1_048_576
+
+// errUnsupportedPatchType is returned for a PATCH body in a format we do not read
+var errUnsupportedPatchType = errors.New("unsupported patch content type")
+
+// entryDocument is the part of an entry a patch may change. Unlike Entry it
+// has no omitempty tags so every field can be tested, replaced or removed
+type entryDocument struct {
+	Name      string   `json:"name"`
+	Level     string   `json:"level"`
+	Contact   string   `json:"contact"`
+	Phone     string   `json:"phone"`
+	Email     string   `json:"email"`
+	Website   string   `json:"website"`
+	Address   string   `json:"address"`
+	District  string   `json:"district"`
+	Mode      []string `json:"mode"`
+	Latitude  *float64 `json:"latitude"`
+	Longitude *float64 `json:"longitude"`
+}
+
+// The readEntryPatch() method changes an entry using the request body. A plain
+// JSON body only sets the fields it contains, application/merge-patch+json
+// follows RFC 7396 so fields can be cleared with null, and
+// application/json-patch+json follows RFC 6902 so single mode elements can be
+// added, removed, replaced or tested
+func (app *application) readEntryPatch(w http.ResponseWriter, r *http.Request, entries *data.Entry) error {
+	mediaType := "application/json"
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		var err error
+		mediaType, _, err = mime.ParseMediaType(contentType)
+		if err != nil {
+			return errUnsupportedPatchType
+		}
+	}
+
+	var apply func(doc, patch []byte) ([]byte, error)
+	switch mediaType {
+	case "application/json":
+		var input data.EntryFields
+		err := app.readJSON(w, r, &input)
+		if err != nil {
+			return err
+		}
+		input.Apply(entries)
+		return nil
+	case "application/merge-patch+json":
+		apply = jsonpatch.MergePatch
+	case "application/json-patch+json":
+		apply = jsonpatch.Apply
+	default:
+		return errUnsupportedPatchType
+	}
+
+	patch, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPatchBytes))
+	if err != nil {
+		return fmt.Errorf("body must not be larger than %d bytes", maxPatchBytes)
+	}
+	doc, err := json.Marshal(entryDocument{
+		Name:      entries.Name,
+		Level:     entries.Level,
+		Contact:   entries.Contact,
+		Phone:     entries.Phone,
+		Email:     entries.Email,
+		Website:   entries.Website,
+		Address:   entries.Address,
+		District:  entries.District,
+		Mode:      entries.Mode,
+		Latitude:  entries.Latitude,
+		Longitude: entries.Longitude,
+	})
+	if err != nil {
+		return err
+	}
+	patched, err := apply(doc, patch)
+	if err != nil {
+		return err
+	}
+
+	// Read the result back, rejecting fields that cannot be patched
+	var result entryDocument
+	dec := json.NewDecoder(bytes.NewReader(patched))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&result); err != nil {
+		return fmt.Errorf("the patched entry is not valid: %w", err)
+	}
+	entries.Name = result.Name
+	entries.Level = result.Level
+	entries.Contact = result.Contact
+	entries.Phone = result.Phone
+	entries.Email = result.Email
+	entries.Website = result.Website
+	entries.Address = result.Address
+	entries.District = result.District
+	entries.Mode = result.Mode
+	entries.Latitude = result.Latitude
+	entries.Longitude = result.Longitude
+	return nil
+}
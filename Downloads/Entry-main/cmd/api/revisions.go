@@ -0,0 +1,222 @@
+// Filename: cmd/api/revisions.go
+
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"kriol.camerontillett.net/internal/data"
+	"kriol.camerontillett.net/internal/validator"
+)
+
+// listEntryVersionsHandler for the "GET /v1/entries/:id/versions" endpoint
+func (app *application) listEntryVersionsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	// Fetch the history for the entry
+	revisions, err := app.models.Revisions.GetAllForEntry(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	// An entry with no history does not exist
+	if len(revisions) == 0 {
+		app.notFoundResponse(w, r)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"versions": revisions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showEntryVersionHandler for the "GET /v1/entries/:id/versions/:v" endpoint
+func (app *application) showEntryVersionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	version, err := app.readVersionParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	// Fetch the specific version
+	revision, err := app.models.Revisions.Get(id, version)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"version": revision}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// diffEntryVersionsHandler for the "GET /v1/entries/:id/diff?from=&to=" endpoint
+// If "to" is left out the diff is taken against the latest version
+func (app *application) diffEntryVersionsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	// Read the versions to compare
+	v := validator.New()
+	qs := r.URL.Query()
+	from := app.readInt(qs, "from", 0, v)
+	to := app.readInt(qs, "to", 0, v)
+	v.Check(from > 0, "from", "must be provided")
+	v.Check(to >= 0, "to", "must be greater than zero")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	// Default to the current version of the entry
+	if to == 0 {
+		entries, err := app.models.Entry.Get(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		to = int(entries.Version)
+	}
+	// Fetch both versions
+	fromRevision, err := app.models.Revisions.Get(id, int32(from))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	toRevision, err := app.models.Revisions.Get(id, int32(to))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	diff := envelope{
+		"from":    from,
+		"to":      to,
+		"changes": data.DiffEntries(&fromRevision.Entry, &toRevision.Entry),
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"diff": diff}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// revertEntryHandler for the "POST /v1/entries/:id/revert?to=v" endpoint
+// The old version is written back as a new version so the history is kept.
+// Send If-Match to make sure the entry is still the one the revert was based on
+func (app *application) revertEntryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	// Read the version we are reverting to
+	v := validator.New()
+	to := app.readInt(r.URL.Query(), "to", 0, v)
+	v.Check(to > 0, "to", "must be provided")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	// Fetch the current record from the database
+	entries, err := app.models.Entry.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	// The client's copy has to be current if it sent If-Match
+	if !app.checkIfMatch(w, r, entries) {
+		return
+	}
+	// Fetch the version to restore
+	revision, err := app.models.Revisions.Get(id, int32(to))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	// Copy the old values over the current ones but keep the current version
+	// so Update() can still detect edit conflicts
+	entries.Name = revision.Entry.Name
+	entries.Level = revision.Entry.Level
+	entries.Contact = revision.Entry.Contact
+	entries.Phone = revision.Entry.Phone
+	entries.Email = revision.Entry.Email
+	entries.Website = revision.Entry.Website
+	entries.Address = revision.Entry.Address
+	entries.District = revision.Entry.District
+	entries.Mode = revision.Entry.Mode
+	entries.Latitude = revision.Entry.Latitude
+	entries.Longitude = revision.Entry.Longitude
+
+	// Old revisions may hold free-text levels and modes or phone numbers written
+	// before they were normalized, so they are checked like any other update
+	vocabulary, err := app.models.Vocabularies.Load()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if data.ValidateEntries(v, entries, vocabulary); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+	err = app.models.Entry.Update(entries, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if err := app.emitEvent(data.EventEntryUpdated, entries); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	headers := make(http.Header)
+	headers.Set("ETag", entryETag(entries))
+	hideWebsiteCheck(entries)
+	err = app.writeJSON(w, http.StatusOK, envelope{"entries": entries}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -12,16 +12,77 @@ func (app *application) routes() http.Handler {
 	router.NotFound = http.HandlerFunc(app.notFoundResponse)
 	router.MethodNotAllowed = http.HandlerFunc(app.methodNotAllowedResponse)
 	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/openapi.json", app.openapiHandler)
 	
 	router.HandlerFunc(http.MethodGet, "/v1/entries", app.requirePermission("entries:read", app.listEntryHandler))
 	router.HandlerFunc(http.MethodPost, "/v1/entries", app.requirePermission("entries:write", app.createEntryHandler))
-	router.HandlerFunc(http.MethodGet, "/v1/entries/:id", app.requirePermission("entries:read", app.showEntryHandler))
-	router.HandlerFunc(http.MethodPatch, "/v1/entries/:id", app.requirePermission("entries:write", app.updateEntryHandler))
-	router.HandlerFunc(http.MethodDelete, "/v1/entries/:id", app.requirePermission("entries:write", app.deleteEntryHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/entries/:id", app.subroutes(map[string]http.HandlerFunc{
+		"trash":  app.requirePermission("entries:write", app.listTrashHandler),
+		"export": app.requirePermission("entries:read", app.exportEntryHandler),
+		"facets": app.requirePermission("entries:read", app.facetEntryHandler),
+		"stream": app.requirePermission("entries:read", app.streamEntryHandler),
+	}, app.requirePermission("entries:read", app.showEntryHandler)))
+	router.HandlerFunc(http.MethodPatch, "/v1/entries/:id", app.requirePermission("entries:write", app.requireMaintainer(app.updateEntryHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/entries/:id", app.requirePermission("entries:write", app.requireMaintainer(app.deleteEntryHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/entries/:id/versions", app.requirePermission("entries:read", app.listEntryVersionsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/entries/:id/versions/:v", app.requirePermission("entries:read", app.showEntryVersionHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/entries/:id/diff", app.requirePermission("entries:read", app.diffEntryVersionsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/entries/:id", app.subroutes(map[string]http.HandlerFunc{
+		"import": app.requirePermission("entries:write", app.importEntryHandler),
+		"batch":  app.requirePermission("entries:write", app.batchEntryHandler),
+	}, nil))
+	router.HandlerFunc(http.MethodPost, "/v1/entries/:id/revert", app.requirePermission("entries:write", app.requireMaintainer(app.revertEntryHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/entries/:id/restore", app.requirePermission("entries:write", app.requireMaintainer(app.restoreEntryHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/entries/:id/merge", app.requirePermission("entries:write", app.requireMaintainer(app.mergeEntryHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/entries/:id/suggestions", app.suggestionRateLimit(app.createSuggestionHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/suggestions", app.requirePermission("entries:write", app.listSuggestionsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/suggestions/:id/apply", app.requirePermission("entries:write", app.applySuggestionHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/suggestions/:id/dismiss", app.requirePermission("entries:write", app.dismissSuggestionHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/entries/:id/maintainers", app.requirePermission("entries:read", app.listMaintainersHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/entries/:id/maintainers", app.requirePermission("entries:write", app.requireMaintainer(app.addMaintainerHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/entries/:id/maintainers/:user", app.requirePermission("entries:write", app.requireMaintainer(app.removeMaintainerHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/submissions", app.requirePermission("entries:submit", app.createSubmissionHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/submissions", app.requirePermission("entries:review", app.listSubmissionsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/submissions/:id", app.requirePermission("entries:review", app.showSubmissionHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/submissions/:id/approve", app.requirePermission("entries:review", app.approveSubmissionHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/submissions/:id/reject", app.requirePermission("entries:review", app.rejectSubmissionHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/vocabularies/:kind", app.requirePermission("entries:read", app.listVocabularyHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/vocabularies/:kind", app.requirePermission("vocabularies:write", app.createVocabularyHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/vocabularies/:kind/:id", app.requirePermission("vocabularies:write", app.updateVocabularyHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/vocabularies/:kind/:id", app.requirePermission("vocabularies:write", app.deleteVocabularyHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/webhooks", app.requirePermission("webhooks:manage", app.listWebhooksHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/webhooks", app.requirePermission("webhooks:manage", app.createWebhookHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/webhooks/:id", app.requirePermission("webhooks:manage", app.showWebhookHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/webhooks/:id", app.requirePermission("webhooks:manage", app.updateWebhookHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/webhooks/:id", app.requirePermission("webhooks:manage", app.deleteWebhookHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/webhooks/:id/deliveries", app.requirePermission("webhooks:manage", app.listWebhookDeliveriesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/webhooks/:id/deliveries/:delivery/redeliver", app.requirePermission("webhooks:manage", app.redeliverWebhookHandler))
 	// router.HandlerFunc(http.MethodGet, "/v1/stringrandom/:id", app.showRandomString)
 	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
 	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/entries", app.requirePermission("entries:read", app.listMyEntriesHandler))
 	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
+	// Each GraphQL field checks its own permissions
+	router.HandlerFunc(http.MethodPost, "/v1/graphql", app.requireActivatedUser(app.graphqlHandler()))
 	
 	return app.recoverPanic(app.enableCORS(app.rateLimit(app.authenticate(router))))
-}
\ No newline at end of file
+}
+
+// httprouter does not allow a static segment such as "/v1/entries/trash" to sit
+// next to the ":id" wildcard, so the subroutes() method checks the ":id" value
+// against the static names first and falls back to the wildcard handler
+func (app *application) subroutes(static map[string]http.HandlerFunc, fallback http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := httprouter.ParamsFromContext(r.Context())
+		if next, ok := static[params.ByName("id")]; ok {
+			next(w, r)
+			return
+		}
+		// No fallback means only the static names exist for this method
+		if fallback == nil {
+			app.notFoundResponse(w, r)
+			return
+		}
+		fallback(w, r)
+	}
+}
@@ -7,13 +7,20 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
+
+	"google.golang.org/grpc"
 )
 
+// How long a response may take to write. Exports extend it to the export
+// timeout and streams keep pushing it back for as long as they are open
+const serverWriteTimeout = 30 * time.Second
+
 func (app *application) serve() error {
 	// Create our HTTP server
 	srv := &http.Server{
@@ -22,7 +29,26 @@ func (app *application) serve() error {
 		ErrorLog:     log.New(app.logger, "", 0),
 		IdleTimeout:  time.Minute,
 		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 30 * time.Second,
+		WriteTimeout: serverWriteTimeout,
+		ConnContext:  connContext,
+	}
+	// Serve the gRPC API next to the HTTP one
+	var grpcSrv *grpc.Server
+	if app.config.grpcPort != 0 {
+		listener, err := net.Listen("tcp", fmt.Sprintf(":%d", app.config.grpcPort))
+		if err != nil {
+			return err
+		}
+		grpcSrv = app.grpcServer()
+		go func() {
+			app.logger.PrintInfo("starting grpc server", map[string]string{
+				"addr": listener.Addr().String(),
+			})
+			err := grpcSrv.Serve(listener)
+			if err != nil {
+				app.logger.PrintError(err, nil)
+			}
+		}()
 	}
 	// The Shutdown() function should return its error to this channel
 	shutdownError := make(chan error)
@@ -41,11 +67,18 @@ func (app *application) serve() error {
 		// Create a context with a 20-second timeout
 		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
 		defer cancel()
+		// Stop the background loops and end the open entry streams so their
+		// clients reconnect elsewhere
+		app.stop()
+		app.entryEvents.closeAll()
 		// Call the Shutdown() function
 		err := srv.Shutdown(ctx)
 		if err != nil {
 			shutdownError <- err
 		}
+		if grpcSrv != nil {
+			grpcSrv.GracefulStop()
+		}
 		// log a message about the go routines
 		app.logger.PrintInfo("Completing background tasks", map[string]string{
 			"addr": srv.Addr,
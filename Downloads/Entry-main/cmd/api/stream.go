@@ -0,0 +1,342 @@
+// Filename: cmd/api/stream.go
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+	"kriol.camerontillett.net/internal/data"
+	"kriol.camerontillett.net/internal/validator"
+)
+
+const (
+	// How many events are read at a time when a client resumes
+	replayPageSize = 500
+	// How often a comment is sent so idle connections are not closed
+	streamHeartbeat = 15 * time.Second
+	// How far ahead a stream moves its write deadline each time it writes.
+	// A client that stops reading is cut off once it runs out
+	streamWriteWindow = 2 * streamHeartbeat
+	// How many events can wait for a slow client before it is cut off
+	subscriberBuffer = 64
+	// How often queued events are checked for when no notification says so
+	releaseInterval = time.Second
+)
+
+// An eventHub passes the entry events received by this server on to every
+// open stream
+type eventHub struct {
+	mu          sync.Mutex
+	subscribers map[chan *data.EntryEvent]struct{}
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{subscribers: make(map[chan *data.EntryEvent]struct{})}
+}
+
+// subscribe() returns a channel that receives every event from now on. It is
+// closed if the subscriber falls too far behind
+func (h *eventHub) subscribe() chan *data.EntryEvent {
+	ch := make(chan *data.EntryEvent, subscriberBuffer)
+	h.mu.Lock()
+	h.subscribers[ch] = struct{}{}
+	h.mu.Unlock()
+	return ch
+}
+
+// unsubscribe() stops sending events to a channel
+func (h *eventHub) unsubscribe(ch chan *data.EntryEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subscribers[ch]; ok {
+		delete(h.subscribers, ch)
+		close(ch)
+	}
+}
+
+// publish() sends an event to every subscriber. A subscriber whose buffer is
+// full is dropped rather than holding up everyone else
+func (h *eventHub) publish(event *data.EntryEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subscribers {
+		select {
+		case ch <- event:
+		default:
+			delete(h.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// closeAll() drops every subscriber so their clients reconnect and resume
+func (h *eventHub) closeAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subscribers {
+		delete(h.subscribers, ch)
+		close(ch)
+	}
+}
+
+// listenEntryEvents() runs until the server shuts down. It releases the queued
+// entry events and receives the numbered ones with NOTIFY, so changes
+// made through any API server reach the streams on this one, and prunes old
+// events
+func (app *application) listenEntryEvents() {
+	report := func(_ pq.ListenerEventType, err error) {
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+	}
+	listener := pq.NewListener(app.config.db.dsn, 10*time.Second, time.Minute, report)
+	defer listener.Close()
+
+	// Keep trying rather than leaving the streams with nothing to send
+	for _, channel := range []string{data.EntryEventChannel, data.EntryEventQueuedChannel} {
+		for delay := time.Second; ; delay *= 2 {
+			err := listener.Listen(channel)
+			if err == nil || errors.Is(err, pq.ErrChannelAlreadyOpen) {
+				break
+			}
+			app.logger.PrintError(err, map[string]string{"channel": channel})
+			if delay > time.Minute {
+				delay = time.Minute
+			}
+			select {
+			case <-time.After(delay):
+			case <-app.stopCtx.Done():
+				return
+			}
+		}
+	}
+	// Events held back by a slow transaction are released once it finishes,
+	// which does not send a notification of its own
+	release := time.NewTicker(releaseInterval)
+	defer release.Stop()
+	// Check the listener's connection is still alive
+	ping := time.NewTicker(90 * time.Second)
+	defer ping.Stop()
+	prune := time.NewTicker(time.Hour)
+	defer prune.Stop()
+
+	for {
+		select {
+		case n := <-listener.Notify:
+			switch {
+			// A nil notification means the connection was lost and events may
+			// have been missed. The clients resume from the events table
+			case n == nil:
+				app.entryEvents.closeAll()
+			case n.Channel == data.EntryEventQueuedChannel:
+				app.releaseEntryEvents()
+			default:
+				var event data.EntryEvent
+				err := json.Unmarshal([]byte(n.Extra), &event)
+				if err != nil {
+					app.logger.PrintError(err, nil)
+					continue
+				}
+				app.entryEvents.publish(&event)
+			}
+		case <-release.C:
+			app.releaseEntryEvents()
+		case <-ping.C:
+			go listener.Ping()
+		case <-prune.C:
+			_, err := app.models.EntryEvents.Prune(app.config.stream.retention)
+			if err != nil {
+				app.logger.PrintError(err, nil)
+			}
+		case <-app.stopCtx.Done():
+			return
+		}
+	}
+}
+
+// releaseEntryEvents() numbers the queued events that are ready. They come
+// back to every API server through the listener
+func (app *application) releaseEntryEvents() {
+	_, err := app.models.EntryEvents.Release()
+	if err != nil {
+		app.logger.PrintError(err, nil)
+	}
+}
+
+// An entryEventFilter picks out the events a stream wants
+type entryEventFilter struct {
+	level string
+	mode  []string
+}
+
+// matches() reports whether an event is for an entry with the level and every
+// mode asked for
+func (f entryEventFilter) matches(event *data.EntryEvent) bool {
+	if f.level != "" && event.Level != f.level {
+		return false
+	}
+	for _, mode := range f.mode {
+		if !validator.In(mode, event.Mode...) {
+			return false
+		}
+	}
+	return true
+}
+
+// The readEntryEventFilter() method checks the level and modes a stream is
+// filtered by. They are matched on their codes, as stored
+func (app *application) readEntryEventFilter(level string, modes []string, v *validator.Validator) (entryEventFilter, error) {
+	var filter entryEventFilter
+	if level == "" && len(modes) == 0 {
+		return filter, nil
+	}
+	vocabulary, err := app.models.Vocabularies.Load()
+	if err != nil {
+		return filter, err
+	}
+	if level != "" {
+		var ok bool
+		filter.level, ok = vocabulary.Normalize(data.VocabularyLevel, level)
+		v.Check(ok, "level", "must be a known level")
+	}
+	for _, value := range modes {
+		mode, ok := vocabulary.Normalize(data.VocabularyMode, value)
+		v.Check(ok, "mode", "must only contain known modes")
+		filter.mode = append(filter.mode, mode)
+	}
+	return filter, nil
+}
+
+// The replayEntryEvents() method passes every stored event after the given
+// one to fn, oldest first, so a stream can catch up after reconnecting
+func (app *application) replayEntryEvents(after int64, fn func(*data.EntryEvent) error) error {
+	for {
+		missed, err := app.models.EntryEvents.GetAfter(after, replayPageSize)
+		if err != nil {
+			return err
+		}
+		for _, event := range missed {
+			if err := fn(event); err != nil {
+				return err
+			}
+			after = event.ID
+		}
+		if len(missed) < replayPageSize {
+			return nil
+		}
+	}
+}
+
+// streamEntryHandler for the "GET /v1/entries/stream" endpoint
+// Sends created, updated and deleted events as Server-Sent Events until the
+// client goes away or the server shuts down. A client that sends
+// Last-Event-ID, or the last_event_id parameter, first gets the events it
+// missed
+func (app *application) streamEntryHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		app.serverErrorResponse(w, r, errors.New("streaming is not supported by the response writer"))
+		return
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = qs.Get("last_event_id")
+	}
+	var lastID int64
+	if lastEventID != "" {
+		var err error
+		lastID, err = strconv.ParseInt(lastEventID, 10, 64)
+		v.Check(err == nil && lastID >= 0, "last_event_id", "must be a positive integer")
+	}
+	filter, err := app.readEntryEventFilter(app.readString(qs, "level", ""), app.readCSV(qs, "mode", []string{}), v)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Subscribe before replaying so nothing is missed in between. Events
+	// that were already replayed are skipped
+	events := app.entryEvents.subscribe()
+	defer app.entryEvents.unsubscribe(events)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	// The stream outlives the server's write timeout
+	if err := extendWriteDeadline(r, streamWriteWindow); err != nil {
+		app.logger.PrintError(err, nil)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 2000\n\n")
+	flusher.Flush()
+
+	send := func(event *data.EntryEvent) error {
+		lastID = event.ID
+		if !filter.matches(event) {
+			return nil
+		}
+		js, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		if err := extendWriteDeadline(r, streamWriteWindow); err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Action, js)
+		return err
+	}
+
+	if lastID > 0 {
+		err := app.replayEntryEvents(lastID, send)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+			return
+		}
+		flusher.Flush()
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-events:
+			// The hub dropped us. The client will reconnect and resume
+			if !ok {
+				return
+			}
+			if event.ID <= lastID {
+				continue
+			}
+			if err := send(event); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-heartbeat.C:
+			if err := extendWriteDeadline(r, streamWriteWindow); err != nil {
+				return
+			}
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,47 @@
+// Filename: cmd/api/stream_test.go
+
+package main
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"kriol.camerontillett.net/internal/data"
+	"kriol.camerontillett.net/internal/jsonlog"
+)
+
+func TestStreamOutlivesWriteTimeout(t *testing.T) {
+	app := &application{
+		logger:      jsonlog.New(io.Discard, jsonlog.LevelOff),
+		entryEvents: newEventHub(),
+	}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(app.streamEntryHandler))
+	srv.Config.WriteTimeout = 50 * time.Millisecond
+	srv.Config.ConnContext = connContext
+	srv.Start()
+	defer srv.Close()
+
+	res, err := srv.Client().Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	// Publish well after the server's write timeout has passed
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		app.entryEvents.publish(&data.EntryEvent{ID: 5, Action: "updated", Mode: []string{}})
+	}()
+	lines := bufio.NewScanner(res.Body)
+	for lines.Scan() {
+		if strings.HasPrefix(lines.Text(), "id: 5") {
+			return
+		}
+	}
+	t.Fatalf("the stream ended before the event arrived: %v", lines.Err())
+}
@@ -0,0 +1,231 @@
+// Filename: cmd/api/submissions.go
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"kriol.camerontillett.net/internal/data"
+	"kriol.camerontillett.net/internal/validator"
+)
+
+// createSubmissionHandler for the "POST /v1/submissions" endpoint
+// The proposed entry is checked like a normal entry but waits for a reviewer
+func (app *application) createSubmissionHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name      string   `json:"name"`
+		Level     string   `json:"level"`
+		Contact   string   `json:"contact"`
+		Phone     string   `json:"phone"`
+		Email     string   `json:"email"`
+		Website   string   `json:"website"`
+		Address   string   `json:"address"`
+		District  string   `json:"district"`
+		Mode      []string `json:"mode"`
+		Latitude  *float64 `json:"latitude"`
+		Longitude *float64 `json:"longitude"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	submission := &data.Submission{
+		SubmittedBy: app.contextGetUser(r).ID,
+		Entry: data.Entry{
+			Name:      input.Name,
+			Level:     input.Level,
+			Contact:   input.Contact,
+			Phone:     input.Phone,
+			Email:     input.Email,
+			Website:   input.Website,
+			Address:   input.Address,
+			District:  input.District,
+			Mode:      input.Mode,
+			Latitude:  input.Latitude,
+			Longitude: input.Longitude,
+		},
+	}
+
+	vocabulary, err := app.models.Vocabularies.Load()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if data.ValidateEntries(v, &submission.Entry, vocabulary); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Submissions.Insert(submission)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/submissions/%d", submission.ID))
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"submission": submission}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listSubmissionsHandler for the "GET /v1/submissions" endpoint
+// Shows the pending queue unless another status is asked for
+func (app *application) listSubmissionsHandler(w http.ResponseWriter, r *http.Request) {
+	var filters data.Filters
+	v := validator.New()
+	qs := r.URL.Query()
+	status := app.readString(qs, "status", data.SubmissionPending)
+	filters.Page = app.readInt(qs, "page", 1, v)
+	filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	// The queue is always oldest first
+	filters.Sort = "id"
+	filters.SortList = []string{"id"}
+	v.Check(validator.In(status, data.SubmissionPending, data.SubmissionApproved, data.SubmissionRejected), "status", "must be pending, approved or rejected")
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	submissions, metadata, err := app.models.Submissions.GetAll(status, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"submissions": submissions, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showSubmissionHandler for the "GET /v1/submissions/:id" endpoint
+func (app *application) showSubmissionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	submission, err := app.models.Submissions.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"submission": submission}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// approveSubmissionHandler for the "POST /v1/submissions/:id/approve" endpoint
+// The reason is optional when approving
+func (app *application) approveSubmissionHandler(w http.ResponseWriter, r *http.Request) {
+	app.decideSubmission(w, r, data.SubmissionApproved)
+}
+
+// rejectSubmissionHandler for the "POST /v1/submissions/:id/reject" endpoint
+// A reason has to be given when rejecting
+func (app *application) rejectSubmissionHandler(w http.ResponseWriter, r *http.Request) {
+	app.decideSubmission(w, r, data.SubmissionRejected)
+}
+
+// The decideSubmission() method approves or rejects a pending submission and
+// emails the submitter in the background
+func (app *application) decideSubmission(w http.ResponseWriter, r *http.Request, status string) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	var input struct {
+		Reason string `json:"reason"`
+	}
+	// The body may be left out entirely
+	if r.ContentLength != 0 {
+		err = app.readJSON(w, r, &input)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	}
+	v := validator.New()
+	if data.ValidateReason(v, input.Reason, status == data.SubmissionRejected); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	submission, err := app.models.Submissions.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if submission.Status != data.SubmissionPending {
+		app.submissionDecidedResponse(w, r, submission.Status)
+		return
+	}
+
+	reviewer := app.contextGetUser(r)
+	if status == data.SubmissionApproved {
+		// The vocabularies may have changed since the submission was made
+		vocabulary, err := app.models.Vocabularies.Load()
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if data.ValidateEntries(v, &submission.Entry, vocabulary); !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+		err = app.models.Submissions.Approve(submission, reviewer.ID, input.Reason)
+	} else {
+		err = app.models.Submissions.Reject(submission, reviewer.ID, input.Reason)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if submission.Status == data.SubmissionApproved {
+		if err := app.emitEvent(data.EventEntryCreated, &submission.Entry); err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	app.background(func() {
+		data := map[string]interface{}{
+			"userName":     submission.SubmitterName,
+			"name":         submission.Entry.Name,
+			"submissionID": submission.ID,
+			"status":       submission.Status,
+			"reason":       submission.Reason,
+			"entryID":      submission.EntryID,
+		}
+		// Let the submitter know what happened
+		err := app.mailer.Send(submission.SubmitterEmail, "submission_decided.tmpl", data)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+	})
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"submission": submission}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,218 @@
+// Filename: cmd/api/suggestions.go
+
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"kriol.camerontillett.net/internal/data"
+	"kriol.camerontillett.net/internal/validator"
+)
+
+// createSuggestionHandler for the "POST /v1/entries/:id/suggestions" endpoint
+// Anyone may suggest a correction. The fields are checked with the same rules
+// as an update but nothing changes until staff apply the suggestion
+func (app *application) createSuggestionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	var input struct {
+		data.EntryFields
+		Note string `json:"note"`
+		// A field people never see on the form. Bots tend to fill it in
+		Nickname string `json:"nickname"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	// Pretend it worked so the bot has no reason to try again
+	if input.Nickname != "" {
+		err = app.writeJSON(w, http.StatusAccepted, envelope{"message": "thank you, your suggestion will be reviewed"}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	entries, err := app.models.Entry.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	// Check the entry as it would be with the suggestion applied
+	proposed := *entries
+	input.EntryFields.Apply(&proposed)
+	vocabulary, err := app.models.Vocabularies.Load()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	data.ValidateEntries(v, &proposed, vocabulary)
+	data.ValidateNote(v, input.Note)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	// Only keep the fields that actually change
+	suggestion := &data.Suggestion{
+		EntryID:      entries.ID,
+		EntryVersion: entries.Version,
+		Fields:       data.DiffFields(entries, &proposed),
+		Note:         input.Note,
+	}
+	suggestion.Changes = data.DiffEntries(entries, &proposed)
+	if len(suggestion.Changes) == 0 {
+		v.AddError("fields", "must change at least one value")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Suggestions.Insert(suggestion)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"message": "thank you, your suggestion will be reviewed"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listSuggestionsHandler for the "GET /v1/suggestions" endpoint
+// The staff inbox, showing each suggestion as a diff against the current entry
+func (app *application) listSuggestionsHandler(w http.ResponseWriter, r *http.Request) {
+	var filters data.Filters
+	v := validator.New()
+	qs := r.URL.Query()
+	status := app.readString(qs, "status", data.SuggestionPending)
+	filters.Page = app.readInt(qs, "page", 1, v)
+	filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	// The inbox is always oldest first
+	filters.Sort = "id"
+	filters.SortList = []string{"id"}
+	v.Check(validator.In(status, data.SuggestionPending, data.SuggestionApplied, data.SuggestionDismissed), "status", "must be pending, applied or dismissed")
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	suggestions, metadata, err := app.models.Suggestions.GetAll(status, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"suggestions": suggestions, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// applySuggestionHandler for the "POST /v1/suggestions/:id/apply" endpoint
+// Writes the suggested values to the entry as a new version
+func (app *application) applySuggestionHandler(w http.ResponseWriter, r *http.Request) {
+	suggestion, ok := app.readPendingSuggestion(w, r)
+	if !ok {
+		return
+	}
+	entries := suggestion.Entry
+	suggestion.Fields.Apply(&entries)
+	// The entry may have changed since the suggestion was made
+	vocabulary, err := app.models.Vocabularies.Load()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if data.ValidateEntries(v, &entries, vocabulary); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+	err = app.models.Suggestions.Apply(suggestion, &entries, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if err := app.emitEvent(data.EventEntryUpdated, entries); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"suggestion": suggestion, "entries": entries}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// dismissSuggestionHandler for the "POST /v1/suggestions/:id/dismiss" endpoint
+func (app *application) dismissSuggestionHandler(w http.ResponseWriter, r *http.Request) {
+	suggestion, ok := app.readPendingSuggestion(w, r)
+	if !ok {
+		return
+	}
+	user := app.contextGetUser(r)
+	err := app.models.Suggestions.Dismiss(suggestion, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"suggestion": suggestion}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The readPendingSuggestion() method fetches the suggestion named by the ":id"
+// parameter and checks that the user may edit its entry. It writes the error
+// response itself and returns false if the request should stop
+func (app *application) readPendingSuggestion(w http.ResponseWriter, r *http.Request) (*data.Suggestion, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+	suggestion, err := app.models.Suggestions.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	ok, err := app.canMaintain(app.contextGetUser(r), suggestion.EntryID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil, false
+	}
+	if !ok {
+		app.notPermittedResponse(w, r)
+		return nil, false
+	}
+	if suggestion.Status != data.SuggestionPending {
+		app.suggestionClosedResponse(w, r, suggestion.Status)
+		return nil, false
+	}
+	return suggestion, true
+}
@@ -0,0 +1,97 @@
+// Filename: cmd/api/trash.go
+
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"kriol.camerontillett.net/internal/data"
+	"kriol.camerontillett.net/internal/validator"
+)
+
+// listTrashHandler for the "GET /v1/entries/trash" endpoint
+func (app *application) listTrashHandler(w http.ResponseWriter, r *http.Request) {
+	var filters data.Filters
+	// Get the page information
+	v := validator.New()
+	qs := r.URL.Query()
+	filters.Page = app.readInt(qs, "page", 1, v)
+	filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	// The trash is always ordered by deletion time
+	filters.Sort = "id"
+	filters.SortList = []string{"id"}
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	entries, metadata, err := app.models.Entry.GetTrash(filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"entries": entries, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// restoreEntryHandler for the "POST /v1/entries/:id/restore" endpoint
+func (app *application) restoreEntryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	// Take the entry out of the trash
+	err = app.models.Entry.Restore(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	// Send back the restored entry
+	entries, err := app.models.Entry.Get(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if err := app.emitEvent(data.EventEntryRestored, entries); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"entries": entries}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// purgeTrash() runs until the server shuts down and removes entries that have
+// been in the trash for longer than the configured retention period
+func (app *application) purgeTrash() {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		count, err := app.models.Entry.Purge(app.config.trash.retention)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		} else if count > 0 {
+			app.logger.PrintInfo("purged trashed entries", map[string]string{
+				"count": strconv.FormatInt(count, 10),
+			})
+		}
+		select {
+		case <-ticker.C:
+		case <-app.stopCtx.Done():
+			return
+		}
+	}
+}
@@ -73,6 +73,11 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		app.serverErrorResponse(w, r, err)
 		return
 	}
+	// Only tell the webhooks once the registration can no longer fail
+	if err := app.emitEvent(data.EventUserCreated, user); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
 	app.background(func() {
 		data := map[string]interface{}{
 			"activationToken": token.Plaintext,
@@ -140,6 +145,10 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 		app.serverErrorResponse(w, r, err)
 		return
 	}
+	if err := app.emitEvent(data.EventUserActivated, user); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
 	// Send a json response with the updated details
 	err = app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
 	if err != nil {
@@ -0,0 +1,198 @@
+// Filename: cmd/api/vocabularies.go
+
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"kriol.camerontillett.net/internal/data"
+	"kriol.camerontillett.net/internal/validator"
+)
+
+// The vocabularies exposed under /v1/vocabularies/:kind
+var vocabularyKinds = map[string]string{
+	"levels":    data.VocabularyLevel,
+	"modes":     data.VocabularyMode,
+	"districts": data.VocabularyDistrict,
+}
+
+// The readKindParam() method returns the vocabulary named by the ":kind" parameter
+func (app *application) readKindParam(r *http.Request) (string, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+	kind, ok := vocabularyKinds[params.ByName("kind")]
+	if !ok {
+		return "", errors.New("invalid kind parameter")
+	}
+	return kind, nil
+}
+
+// listVocabularyHandler for the "GET /v1/vocabularies/:kind" endpoint
+func (app *application) listVocabularyHandler(w http.ResponseWriter, r *http.Request) {
+	kind, err := app.readKindParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	terms, err := app.models.Vocabularies.GetAll(kind)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"terms": terms}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createVocabularyHandler for the "POST /v1/vocabularies/:kind" endpoint
+func (app *application) createVocabularyHandler(w http.ResponseWriter, r *http.Request) {
+	kind, err := app.readKindParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	var input struct {
+		Code    string   `json:"code"`
+		Label   string   `json:"label"`
+		Aliases []string `json:"aliases"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	term := &data.Term{
+		Kind:    kind,
+		Code:    input.Code,
+		Label:   input.Label,
+		Aliases: input.Aliases,
+	}
+	// Aliases are optional when creating a term
+	if term.Aliases == nil {
+		term.Aliases = []string{}
+	}
+
+	vocabulary, err := app.models.Vocabularies.Load()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if data.ValidateTerm(v, term, vocabulary); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Vocabularies.Insert(term)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateTerm):
+			v.AddError("code", "a term with this code already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusCreated, envelope{"term": term}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateVocabularyHandler for the "PATCH /v1/vocabularies/:kind/:id" endpoint
+// The code cannot be changed since entries store it
+func (app *application) updateVocabularyHandler(w http.ResponseWriter, r *http.Request) {
+	kind, err := app.readKindParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	term, err := app.models.Vocabularies.Get(kind, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	var input struct {
+		Label   *string  `json:"label"`
+		Aliases []string `json:"aliases"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if input.Label != nil {
+		term.Label = *input.Label
+	}
+	if input.Aliases != nil {
+		term.Aliases = input.Aliases
+	}
+
+	vocabulary, err := app.models.Vocabularies.Load()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if data.ValidateTerm(v, term, vocabulary); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Vocabularies.Update(term)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"term": term}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteVocabularyHandler for the "DELETE /v1/vocabularies/:kind/:id" endpoint
+// Terms that entries still use cannot be removed
+func (app *application) deleteVocabularyHandler(w http.ResponseWriter, r *http.Request) {
+	kind, err := app.readKindParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	err = app.models.Vocabularies.Delete(kind, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrTermInUse):
+			app.termInUseResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "term successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,376 @@
+// Filename: cmd/api/webhooks.go
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"kriol.camerontillett.net/internal/data"
+	"kriol.camerontillett.net/internal/validator"
+	"kriol.camerontillett.net/internal/webhook"
+)
+
+// The most deliveries sent at the same time
+const webhookBatchSize = 20
+
+// listWebhooksHandler for the "GET /v1/webhooks" endpoint
+func (app *application) listWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	var filters data.Filters
+	v := validator.New()
+	qs := r.URL.Query()
+	filters.Page = app.readInt(qs, "page", 1, v)
+	filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	filters.Sort = "id"
+	filters.SortList = []string{"id"}
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	webhooks, metadata, err := app.models.Webhooks.GetAll(filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"webhooks": webhooks, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createWebhookHandler for the "POST /v1/webhooks" endpoint. The signing
+// secret is only ever shown in this response
+func (app *application) createWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		URL    string   `json:"url"`
+		Events []string `json:"events"`
+		Active *bool    `json:"active"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	secret, err := webhook.NewSecret()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	hook := &data.Webhook{
+		CreatedBy: app.contextGetUser(r).ID,
+		URL:       input.URL,
+		Events:    input.Events,
+		Secret:    secret,
+		Active:    true,
+	}
+	if input.Active != nil {
+		hook.Active = *input.Active
+	}
+
+	v := validator.New()
+	if data.ValidateWebhook(v, hook); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Webhooks.Insert(hook)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/webhooks/%d", hook.ID))
+	err = app.writeJSON(w, http.StatusCreated, envelope{"webhook": hook, "secret": secret}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The readWebhook() method fetches the webhook named by the ":id" parameter. It
+// writes the error response and returns nil if it cannot
+func (app *application) readWebhook(w http.ResponseWriter, r *http.Request) *data.Webhook {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+	hook, err := app.models.Webhooks.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil
+	}
+	return hook
+}
+
+// showWebhookHandler for the "GET /v1/webhooks/:id" endpoint
+func (app *application) showWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	hook := app.readWebhook(w, r)
+	if hook == nil {
+		return
+	}
+	err := app.writeJSON(w, http.StatusOK, envelope{"webhook": hook}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateWebhookHandler for the "PATCH /v1/webhooks/:id" endpoint
+func (app *application) updateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	hook := app.readWebhook(w, r)
+	if hook == nil {
+		return
+	}
+	var input struct {
+		URL    *string  `json:"url"`
+		Events []string `json:"events"`
+		Active *bool    `json:"active"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if input.URL != nil {
+		hook.URL = *input.URL
+	}
+	if input.Events != nil {
+		hook.Events = input.Events
+	}
+	if input.Active != nil {
+		hook.Active = *input.Active
+	}
+
+	v := validator.New()
+	if data.ValidateWebhook(v, hook); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Webhooks.Update(hook)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	// Turning a webhook back on lets its waiting deliveries go out
+	app.wakeWebhooks()
+	err = app.writeJSON(w, http.StatusOK, envelope{"webhook": hook}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteWebhookHandler for the "DELETE /v1/webhooks/:id" endpoint
+func (app *application) deleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	err = app.models.Webhooks.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "webhook successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listWebhookDeliveriesHandler for the "GET /v1/webhooks/:id/deliveries" endpoint
+func (app *application) listWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	hook := app.readWebhook(w, r)
+	if hook == nil {
+		return
+	}
+	var filters data.Filters
+	v := validator.New()
+	qs := r.URL.Query()
+	filters.Page = app.readInt(qs, "page", 1, v)
+	filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	filters.Sort = "id"
+	filters.SortList = []string{"id"}
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	deliveries, metadata, err := app.models.Webhooks.GetDeliveries(hook.ID, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"deliveries": deliveries, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// redeliverWebhookHandler for the
+// "POST /v1/webhooks/:id/deliveries/:delivery/redeliver" endpoint. A new
+// delivery is queued with the same payload
+func (app *application) redeliverWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	params := httprouter.ParamsFromContext(r.Context())
+	deliveryID, err := strconv.ParseInt(params.ByName("delivery"), 10, 64)
+	if err != nil || deliveryID < 1 {
+		app.notFoundResponse(w, r)
+		return
+	}
+	delivery, err := app.models.Webhooks.GetDelivery(id, deliveryID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	redelivery, err := app.models.Webhooks.Redeliver(delivery)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.wakeWebhooks()
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"delivery": redelivery}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The emitEvent() method queues an event for the webhooks that subscribe to
+// it. The deliveries are written before the response is sent, so a failure is
+// reported to the client instead of the event going missing from the log
+func (app *application) emitEvent(event string, payload interface{}) error {
+	body, err := json.Marshal(envelope{
+		"event":       event,
+		"occurred_at": time.Now().UTC(),
+		"data":        payload,
+	})
+	if err != nil {
+		return err
+	}
+	count, err := app.models.Webhooks.Enqueue(event, body)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		app.wakeWebhooks()
+	}
+	return nil
+}
+
+// wakeWebhooks() tells the sender there is something to send without waiting
+// for its next tick
+func (app *application) wakeWebhooks() {
+	select {
+	case app.webhookWake <- struct{}{}:
+	default:
+	}
+}
+
+// deliverWebhooks() runs until the server shuts down and sends the deliveries
+// that are due. It runs on a timer so retries go out when their backoff ends,
+// and straight away when woken. Deliveries already being sent are finished
+func (app *application) deliverWebhooks() {
+	ticker := time.NewTicker(app.config.webhooks.interval)
+	defer ticker.Stop()
+
+	for {
+		// Keep going while there are full batches waiting
+		for {
+			count, err := app.deliverWebhookBatch()
+			if err != nil {
+				app.logger.PrintError(err, nil)
+				break
+			}
+			if count < webhookBatchSize || app.stopCtx.Err() != nil {
+				break
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-app.webhookWake:
+		case <-app.stopCtx.Done():
+			return
+		}
+	}
+}
+
+// The deliverWebhookBatch() method claims a batch of due deliveries and sends
+// them at the same time. The claim lasts long enough for every send to time
+// out, after which an unrecorded delivery is picked up again
+func (app *application) deliverWebhookBatch() (int, error) {
+	cfg := app.config.webhooks
+	deliveries, err := app.models.Webhooks.ClaimDeliveries(webhookBatchSize, 2*cfg.timeout+time.Minute)
+	if err != nil {
+		return 0, err
+	}
+	var wg sync.WaitGroup
+	for _, delivery := range deliveries {
+		wg.Add(1)
+		go func(delivery *data.WebhookDelivery) {
+			defer wg.Done()
+			app.sendDelivery(delivery)
+		}(delivery)
+	}
+	wg.Wait()
+	return len(deliveries), nil
+}
+
+// The sendDelivery() method makes one attempt at a delivery and records it.
+// Failures are retried with exponential backoff until the attempts run out
+func (app *application) sendDelivery(delivery *data.WebhookDelivery) {
+	cfg := app.config.webhooks
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.timeout)
+	status, err := app.webhookSender.Send(ctx, delivery.URL, delivery.Secret, delivery.Event, delivery.ID, delivery.Payload)
+	cancel()
+
+	now := time.Now()
+	delivery.Attempts++
+	delivery.LastStatus = status
+	delivery.LastError = ""
+	delivery.NextAttemptAt = nil
+	switch {
+	case err == nil:
+		delivery.Status = data.DeliverySucceeded
+		delivery.DeliveredAt = &now
+	case delivery.Attempts >= cfg.maxAttempts:
+		delivery.Status = data.DeliveryFailed
+		delivery.LastError = err.Error()
+	default:
+		next := now.Add(webhook.Backoff(delivery.Attempts))
+		delivery.NextAttemptAt = &next
+		delivery.LastError = err.Error()
+	}
+	err = app.models.Webhooks.RecordAttempt(delivery)
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{
+			"delivery_id": strconv.FormatInt(delivery.ID, 10),
+		})
+	}
+}
@@ -0,0 +1,112 @@
+// Filename: cmd/api/webhooks_test.go
+
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"kriol.camerontillett.net/internal/data"
+	"kriol.camerontillett.net/internal/jsonlog"
+	"kriol.camerontillett.net/internal/webhook"
+)
+
+// A nullArg matches a NULL argument, or any other value when it is false
+type nullArg bool
+
+func (n nullArg) Match(v driver.Value) bool {
+	return (v == nil) == bool(n)
+}
+
+func TestDeliverWebhookBatchRecordsOutcome(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name       string
+		path       string
+		attempts   int
+		status     string
+		lastStatus int
+		lastError  string
+		retry      bool
+		delivered  bool
+	}{
+		{"success", "/ok", 0, data.DeliverySucceeded, http.StatusNoContent, "", false, true},
+		{"retry", "/down", 2, data.DeliveryPending, http.StatusServiceUnavailable, "received status 503", true, false},
+		{"final failure", "/down", 4, data.DeliveryFailed, http.StatusServiceUnavailable, "received status 503", false, false},
+	}
+	for _, tt := range tests {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		app := &application{
+			logger:        jsonlog.New(io.Discard, jsonlog.LevelOff),
+			models:        data.NewModels(db),
+			webhookSender: webhook.New(srv.Client()),
+		}
+		app.config.webhooks.timeout = time.Second
+		app.config.webhooks.maxAttempts = 5
+
+		mock.ExpectQuery("UPDATE webhook_deliveries AS d").
+			WithArgs(webhookBatchSize, sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "webhook_id", "event", "payload", "attempts", "url", "secret"}).
+				AddRow(9, 3, data.EventEntryCreated, []byte(`{}`), tt.attempts, srv.URL+tt.path, "secret"))
+		mock.ExpectExec("UPDATE webhook_deliveries\\s+SET status").
+			WithArgs(tt.status, tt.attempts+1, nullArg(!tt.retry), tt.lastStatus, tt.lastError, nullArg(!tt.delivered), 9).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		count, err := app.deliverWebhookBatch()
+		if err != nil || count != 1 {
+			t.Errorf("%s: got %d, %v; want 1 delivery", tt.name, count, err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		db.Close()
+	}
+}
+
+func TestEmitEventQueuesDeliveries(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	app := &application{models: data.NewModels(db), webhookWake: make(chan struct{}, 1)}
+
+	mock.ExpectExec("INSERT INTO webhook_deliveries").
+		WithArgs(data.EventEntryDeleted, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	if err := app.emitEvent(data.EventEntryDeleted, envelope{"id": 7}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-app.webhookWake:
+	default:
+		t.Error("the sender was not woken")
+	}
+
+	// A failure is returned to the caller instead of being dropped
+	mock.ExpectExec("INSERT INTO webhook_deliveries").WillReturnError(context.DeadlineExceeded)
+	if err := app.emitEvent(data.EventEntryDeleted, envelope{"id": 7}); err == nil {
+		t.Error("got no error; want the enqueue error")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,80 @@
+// Filename: internal/data/batch.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// WithTx() runs fn inside a single transaction. The transaction is committed
+// if fn returns nil and rolled back otherwise, so callers can make several
+// writes with the Tx methods below and have all or none of them saved
+func (m EntryModel) WithTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = fn(tx)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetTx() reads a live entry and locks it until the transaction ends
+func (m EntryModel) GetTx(ctx context.Context, tx *sql.Tx, id int64) (*Entry, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT ` + entryColumns + `
+		FROM entries
+		WHERE id = $1
+		AND deleted_at IS NULL
+		FOR UPDATE
+	`
+	var entries Entry
+	err := tx.QueryRowContext(ctx, query, id).Scan(entryDest(&entries)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &entries, nil
+}
+
+// InsertTx() works like Insert() inside the caller's transaction
+func (m EntryModel) InsertTx(ctx context.Context, tx *sql.Tx, entries *Entry, userID int64) error {
+	return insertEntry(ctx, tx, entries, userID)
+}
+
+// UpdateTx() works like Update() inside the caller's transaction
+func (m EntryModel) UpdateTx(ctx context.Context, tx *sql.Tx, entries *Entry, userID int64) error {
+	return updateEntry(ctx, tx, entries, userID)
+}
+
+// DeleteTx() works like Delete() inside the caller's transaction
+func (m EntryModel) DeleteTx(ctx context.Context, tx *sql.Tx, id int64, version int32) error {
+	return deleteEntry(ctx, tx, id, version)
+}
+
+// IsMaintainerTx() works like IsMaintainer() inside the caller's transaction,
+// so it sees the maintainer added by an InsertTx() earlier in the same batch
+func (m EntryModel) IsMaintainerTx(ctx context.Context, tx *sql.Tx, entryID, userID int64) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM entry_maintainers
+			WHERE entry_id = $1 AND user_id = $2
+		)
+	`
+	var exists bool
+	err := tx.QueryRowContext(ctx, query, entryID, userID).Scan(&exists)
+	return exists, err
+}
@@ -0,0 +1,249 @@
+// Filename: internal/data/duplicates.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"kriol.camerontillett.net/internal/phone"
+)
+
+// How similar two names must be, from 0 to 1, before they are flagged
+const duplicateNameSimilarity = 0.6
+
+// The most candidates reported for a single entry
+const maxDuplicateCandidates = 10
+
+var (
+	websitePrefixRX = regexp.MustCompile(`^https?://(www\.)?`)
+	websiteSuffixRX = regexp.MustCompile(`/+$`)
+)
+
+// NormalizePhone() returns a phone number in E.164 form, reading numbers
+// without a country code as belonging to PhoneRegion
+func NormalizePhone(raw string) (string, bool) {
+	number, err := phone.Parse(raw, PhoneRegion)
+	if err != nil {
+		return "", false
+	}
+	return number.E164(), true
+}
+
+// normalizeEmail() ignores case and surrounding spaces
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// normalizeWebsite() ignores case, the scheme, a leading "www." and trailing slashes
+func normalizeWebsite(website string) string {
+	website = websitePrefixRX.ReplaceAllString(strings.ToLower(strings.TrimSpace(website)), "")
+	return websiteSuffixRX.ReplaceAllString(website, "")
+}
+
+// A DuplicateCandidate is an existing entry that looks like the one being created
+type DuplicateCandidate struct {
+	ID         int64    `json:"id"`
+	Name       string   `json:"name"`
+	Similarity float64  `json:"similarity"`
+	Matches    []string `json:"matches"`
+}
+
+// The FindDuplicates() method looks for live entries with a similar name or the
+// same phone, email or website once they are normalized. The entry must have
+// been through ValidateEntries() so its phone is in E.164 form. The SQL
+// expressions match the normalize functions above and the indexes in the
+// migrations
+func (m EntryModel) FindDuplicates(entries *Entry) ([]*DuplicateCandidate, error) {
+	query := `
+		SELECT id, name, similarity(name, $1),
+		       name % $1 AND similarity(name, $1) >= $5,
+		       $2 <> '' AND phone_e164 = $2,
+		       $3 <> '' AND lower(trim(email)) = $3,
+		       $4 <> '' AND regexp_replace(regexp_replace(lower(trim(website)), '^https?://(www\.)?', ''), '/+$', '') = $4
+		FROM entries
+		WHERE deleted_at IS NULL
+		AND (
+			(name % $1 AND similarity(name, $1) >= $5)
+			OR ($2 <> '' AND phone_e164 = $2)
+			OR ($3 <> '' AND lower(trim(email)) = $3)
+			OR ($4 <> '' AND regexp_replace(regexp_replace(lower(trim(website)), '^https?://(www\.)?', ''), '/+$', '') = $4)
+		)
+		ORDER BY similarity(name, $1) DESC, id ASC
+		LIMIT $6
+	`
+	args := []interface{}{
+		entries.Name,
+		entries.PhoneE164,
+		normalizeEmail(entries.Email),
+		normalizeWebsite(entries.Website),
+		duplicateNameSimilarity,
+		maxDuplicateCandidates,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	candidates := []*DuplicateCandidate{}
+	for rows.Next() {
+		var candidate DuplicateCandidate
+		var matches [4]bool
+		err := rows.Scan(&candidate.ID, &candidate.Name, &candidate.Similarity, &matches[0], &matches[1], &matches[2], &matches[3])
+		if err != nil {
+			return nil, err
+		}
+		// Report which fields made this a candidate
+		candidate.Matches = []string{}
+		for i, field := range []string{"name", "phone", "email", "website"} {
+			if matches[i] {
+				candidate.Matches = append(candidate.Matches, field)
+			}
+		}
+		candidates = append(candidates, &candidate)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return candidates, nil
+}
+
+// MergeEntries() fills in the gaps of one entry using another. Values already
+// on into are kept, missing ones are taken from from and the modes are
+// combined up to the limit of five
+func MergeEntries(into, from *Entry) {
+	fields := []struct {
+		into *string
+		from string
+	}{
+		{&into.Name, from.Name},
+		{&into.Level, from.Level},
+		{&into.Contact, from.Contact},
+		{&into.Phone, from.Phone},
+		{&into.Email, from.Email},
+		{&into.Website, from.Website},
+		{&into.Address, from.Address},
+		{&into.District, from.District},
+	}
+	for _, f := range fields {
+		if *f.into == "" {
+			*f.into = f.from
+		}
+	}
+	for _, mode := range from.Mode {
+		found := false
+		for _, existing := range into.Mode {
+			if existing == mode {
+				found = true
+				break
+			}
+		}
+		if !found && len(into.Mode) < 5 {
+			into.Mode = append(into.Mode, mode)
+		}
+	}
+	if into.Latitude == nil && into.Longitude == nil {
+		into.Latitude = from.Latitude
+		into.Longitude = from.Longitude
+	}
+}
+
+// The Merge() method saves the combined entry, moves the old one to the trash
+// and leaves a redirect so the old ID still leads to the new one. Both entries
+// must still be at the versions that were read
+func (m EntryModel) Merge(from, into *Entry, userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = updateEntry(ctx, tx, into, userID)
+	if err != nil {
+		return err
+	}
+	// Trash the old entry
+	query := `
+		UPDATE entries
+		SET deleted_at = NOW()
+		WHERE id = $1
+		AND version = $2
+		AND deleted_at IS NULL
+	`
+	result, err := tx.ExecContext(ctx, query, from.ID, from.Version)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+	// The maintainers of the old entry carry over
+	query = `
+		INSERT INTO entry_maintainers (entry_id, user_id)
+		SELECT $1, user_id FROM entry_maintainers WHERE entry_id = $2
+		ON CONFLICT DO NOTHING
+	`
+	_, err = tx.ExecContext(ctx, query, into.ID, from.ID)
+	if err != nil {
+		return err
+	}
+	// Entries that were merged into the old one now point at the new one
+	_, err = tx.ExecContext(ctx, "UPDATE entry_redirects SET to_id = $1 WHERE to_id = $2", into.ID, from.ID)
+	if err != nil {
+		return err
+	}
+	query = `
+		INSERT INTO entry_redirects (from_id, to_id)
+		VALUES ($1, $2)
+		ON CONFLICT (from_id) DO UPDATE SET to_id = EXCLUDED.to_id, created_at = NOW()
+	`
+	_, err = tx.ExecContext(ctx, query, from.ID, into.ID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetRedirect() returns the ID an entry was merged into
+func (m EntryModel) GetRedirect(id int64) (int64, error) {
+	if id < 1 {
+		return 0, ErrRecordNotFound
+	}
+	query := `
+		SELECT entry_redirects.to_id
+		FROM entry_redirects
+		INNER JOIN entries
+		ON entries.id = entry_redirects.to_id
+		WHERE entry_redirects.from_id = $1
+		AND entries.deleted_at IS NULL
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var to int64
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&to)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+	return to, nil
+}
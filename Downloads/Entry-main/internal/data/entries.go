@@ -8,8 +8,10 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strconv"
 	//"time"
 
+	"kriol.camerontillett.net/internal/phone"
 	"kriol.camerontillett.net/internal/validator"
 	//"kriol.camerontillett.net/internal/data"
 	"github.com/lib/pq"
@@ -22,26 +24,69 @@ type Entry struct {
 	Level string `json:"level"`
 	Contact string `json:"contact"`
 	Phone string `json:"phone"`
+	// The phone number in E.164 form, set by ValidateEntries()
+	PhoneE164 string `json:"phone_e164,omitempty"`
 	Email string `json:"email,omitempty"`
 	Website string `json:"website,omitempty"`
 	Address string `json:"address"`
+	// The code of the district the entry is in, if known
+	District string `json:"district,omitempty"`
 	Mode []string `json:"mode"`
 	Version int32 `json:"version"`
+	// The user who created the entry, if known
+	CreatedBy int64 `json:"created_by,omitempty"`
+	// The location is optional
+	Latitude *float64 `json:"latitude,omitempty"`
+	Longitude *float64 `json:"longitude,omitempty"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// Filled in by the website checker. A zero status with a check time means
+	// the website could not be reached at all
+	WebsiteCheckedAt *time.Time `json:"website_checked_at,omitempty"`
+	WebsiteStatus int `json:"website_status,omitempty"`
+	WebsiteRedirect string `json:"website_redirect,omitempty"`
+	WebsiteError string `json:"website_error,omitempty"`
+	// Only filled in when a listing is given a point to measure from
+	Distance *float64 `json:"distance_km,omitempty"`
+	// Only filled in by Search(). The highlights are HTML snippets
+	Rank float32 `json:"rank,omitempty"`
+	Highlights map[string]string `json:"highlights,omitempty"`
 }
 
-func ValidateEntries (v *validator.Validator, entries *Entry) {
+// PhoneRegion is the country assumed for phone numbers written without a
+// country code
+var PhoneRegion = "BZ"
+
+// ValidateEntries() checks an entry before it is written. The level, mode and
+// district must be codes or aliases from the vocabulary and are replaced by
+// their code. The district is optional.
+// The phone number is rewritten in the display format
+func ValidateEntries (v *validator.Validator, entries *Entry, vocabulary *Vocabulary) {
 	// Check() method to execute
 	v.Check(entries.Name != "", "name", "must be provided")
 	v.Check(len(entries.Name) <= 200, "name", "must not be more than 200 bytes long")
 	
 	v.Check(entries.Level != "", "level", "must be provided")
 	v.Check(len(entries.Level) <= 200, "level", "must not be more than 200 bytes long")
+	if entries.Level != "" {
+		level, ok := vocabulary.Normalize(VocabularyLevel, entries.Level)
+		v.Check(ok, "level", "must be a known level")
+		if ok {
+			entries.Level = level
+		}
+	}
 	
 	v.Check(entries.Contact != "", "contact", "must be provided")
 	v.Check(len(entries.Contact) <= 200, "contact", "must not be more than 200 bytes long")
 	
 	v.Check(entries.Phone != "", "phone", "must be provided")
-	v.Check(validator.Matches(entries.Phone, validator.PhoneRX), "phone", "must be a valid phone number")
+	if entries.Phone != "" {
+		number, err := phone.Parse(entries.Phone, PhoneRegion)
+		v.Check(err == nil, "phone", "must be a valid phone number")
+		if err == nil {
+			entries.Phone = number.Format()
+			entries.PhoneE164 = number.E164()
+		}
+	}
 
 	v.Check(entries.Email != "", "email", "must be provided")
 	v.Check(validator.Matches(entries.Email, validator.EmailRX), "email", "must be a valid email")
@@ -52,10 +97,65 @@ func ValidateEntries (v *validator.Validator, entries *Entry) {
 	v.Check(entries.Address != "", "address", "must be provided")
 	v.Check(len(entries.Address) <= 500, "address", "must not be more than 500 bytes long")
 
+	if entries.District != "" {
+		district, ok := vocabulary.Normalize(VocabularyDistrict, entries.District)
+		v.Check(ok, "district", "must be a known district")
+		if ok {
+			entries.District = district
+		}
+	}
+
 	v.Check(entries.Mode != nil, "mode", "must be provided")
 	v.Check(len(entries.Mode) >= 1, "mode", "must contain at least one entries")
 	v.Check(len(entries.Mode) <= 5, "mode", "must contain at most 5 entries")
+	for i, value := range entries.Mode {
+		mode, ok := vocabulary.Normalize(VocabularyMode, value)
+		v.Check(ok, "mode", "must only contain known modes")
+		if ok {
+			entries.Mode[i] = mode
+		}
+	}
 	v.Check(validator.Unique(entries.Mode), "mode", "must not contain duplicate entries")
+
+	// The coordinates are optional but must be provided together
+	v.Check(entries.Latitude != nil || entries.Longitude == nil, "latitude", "must be provided with longitude")
+	v.Check(entries.Longitude != nil || entries.Latitude == nil, "longitude", "must be provided with latitude")
+	if entries.Latitude != nil {
+		v.Check(*entries.Latitude >= -90 && *entries.Latitude <= 90, "latitude", "must be between -90 and 90")
+	}
+	if entries.Longitude != nil {
+		v.Check(*entries.Longitude >= -180 && *entries.Longitude <= 180, "longitude", "must be between -180 and 180")
+	}
+}
+
+// The columns read by every entry query, in the order entryDest() expects
+const entryColumns = `id, created_at, name, level, contact, phone, phone_e164, email, website, address, district, mode, version, latitude, longitude,
+		COALESCE(created_by, 0) AS created_by, website_checked_at, website_status, website_redirect, website_error`
+
+// entryDest() lists the scan destinations for the entryColumns
+func entryDest(entries *Entry) []interface{} {
+	return []interface{}{
+		&entries.ID,
+		&entries.CreatedAt,
+		&entries.Name,
+		&entries.Level,
+		&entries.Contact,
+		&entries.Phone,
+		&entries.PhoneE164,
+		&entries.Email,
+		&entries.Website,
+		&entries.Address,
+		&entries.District,
+		pq.Array(&entries.Mode),
+		&entries.Version,
+		&entries.Latitude,
+		&entries.Longitude,
+		&entries.CreatedBy,
+		&entries.WebsiteCheckedAt,
+		&entries.WebsiteStatus,
+		&entries.WebsiteRedirect,
+		&entries.WebsiteError,
+	}
 }
 
 // Define a Entries Model to wrap the sql.db connection pool
@@ -64,39 +164,98 @@ type EntryModel struct {
 }
 
 // Allows us to create a new Entry
-func (m EntryModel) Insert(entries *Entry) error {
-	query := `
-		INSERT INTO entries (name, level, contact, phone, email, website, address, mode)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-		RETURNING id, created_at, version
-	`
+// The first version is also written to the revision history
+func (m EntryModel) Insert(entries *Entry, userID int64) error {
 	// Create a context
 	// Time starts when context is created
 	ctx, cancel := context.WithTimeout(context.Background(), 3 * time.Second)
 	// Cleanup to prevent memory leaks
 	defer cancel()
 
+	// Start a transaction so the entry and its first revision are saved together
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = insertEntry(ctx, tx, entries, userID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// InsertMany() creates several entries in a single transaction. Either all
+// of them are saved or none are
+func (m EntryModel) InsertMany(entries []*Entry, userID int64) error {
+	// Bulk inserts get a longer deadline than a single row
+	ctx, cancel := context.WithTimeout(context.Background(), 30 * time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, entry := range entries {
+		err = insertEntry(ctx, tx, entry, userID)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// insertEntry() writes a new entry and its first revision using the
+// transaction it is given
+func insertEntry(ctx context.Context, tx *sql.Tx, entries *Entry, userID int64) error {
+	query := `
+		INSERT INTO entries (name, level, contact, phone, email, website, address, mode, latitude, longitude, created_by,
+		                     phone_e164, district)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NULLIF($11, 0), $12, $13)
+		RETURNING id, created_at, version
+	`
 	//Collect the data fields into a slice
 	args := []interface{}{
 		entries.Name, entries.Level,
 		entries.Contact, entries.Phone,
 		entries.Email, entries.Website,
 		entries.Address, pq.Array(entries.Mode),
+		entries.Latitude, entries.Longitude,
+		userID, entries.PhoneE164,
+		entries.District,
 	}
-	return m.DB.QueryRowContext(ctx, query, args...).Scan(&entries.ID, &entries.CreatedAt, &entries.Version)
+	err := tx.QueryRowContext(ctx, query, args...).Scan(&entries.ID, &entries.CreatedAt, &entries.Version)
+	if err != nil {
+		return err
+	}
+	entries.CreatedBy = userID
+	// The creator is the first maintainer
+	if userID != 0 {
+		err = insertMaintainer(ctx, tx, entries.ID, userID)
+		if err != nil {
+			return err
+		}
+	}
+	return insertRevision(ctx, tx, entries, userID)
 }
 
-// Get () Allows us to retrieve a specific entry
-func (m EntryModel) Get(id int64) (*Entry, error) {
+// Get () Allows us to retrieve a specific entry. Passing fields reads only
+// those columns
+func (m EntryModel) Get(id int64, fields ...string) (*Entry, error) {
 	// Ensure that there is a valid ID
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
 	// Create the query
+	columns, dest := entrySelection(fields)
 	query := `
-		SELECT id, created_at, name, level, contact, phone, email, website, address, mode, version
+		SELECT ` + columns + `
 		FROM entries
 		WHERE id = $1
+		AND deleted_at IS NULL
 	`
 	// Declare a Entry variable to hold the returned data
 	var entries Entry
@@ -106,19 +265,7 @@ func (m EntryModel) Get(id int64) (*Entry, error) {
 	// Cleanup to prevent memory leaks
 	defer cancel()
 	// Execute the query using QueryRow()
-	err := m.DB.QueryRowContext(ctx, query, id).Scan(
-		&entries.ID,
-		&entries.CreatedAt,
-		&entries.Name,
-		&entries.Level,
-		&entries.Contact,
-		&entries.Phone,
-		&entries.Email,
-		&entries.Website,
-		&entries.Address,
-		pq.Array(entries.Mode),
-		&entries.Version,
-	)
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(dest(&entries)...)
 	// Handle any errors
 	if err != nil {
 		// Check the type of error
@@ -137,24 +284,48 @@ func (m EntryModel) Get(id int64) (*Entry, error) {
 // KEY: Go's http.Server handles each request in its own goroutine
 //Avoid data races
 // OPtimistic locking (version number)
-func (m EntryModel) Update(entries *Entry) error {
+// Every successful update is recorded in the revision history
+func (m EntryModel) Update(entries *Entry, userID int64) error {
+	// Create a context
+	// Time starts when context is created
+	ctx, cancel := context.WithTimeout(context.Background(), 3 * time.Second)
+	// Cleanup to prevent memory leaks
+	defer cancel()
+
+	// Start a transaction so the new version and its revision are saved together
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = updateEntry(ctx, tx, entries, userID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// updateEntry() writes the new version of an entry and its revision using the
+// caller's transaction
+func updateEntry(ctx context.Context, tx *sql.Tx, entries *Entry, userID int64) error {
 	// Create a query
 	query := `
 		UPDATE entries
 		SET name = $1, 	  level = $2, contact = $3,
 		    phone = $4,   email = $5, website = $6,
-			address = $7, mode = $8,  version = version + 1
-		WHERE id = $9
-		AND version = $10
+			address = $7, mode = $8,  latitude = $9,
+			longitude = $10, phone_e164 = $13, district = $14, version = version + 1,
+			-- A new website has to be checked again
+			website_checked_at = CASE WHEN website = $6 THEN website_checked_at END,
+			website_status = CASE WHEN website = $6 THEN website_status ELSE 0 END,
+			website_redirect = CASE WHEN website = $6 THEN website_redirect ELSE '' END,
+			website_error = CASE WHEN website = $6 THEN website_error ELSE '' END
+		WHERE id = $11
+		AND version = $12
+		AND deleted_at IS NULL
 		RETURNING version
 	`
-
-	// Create a context
-	// Time starts when context is created
-	ctx, cancel := context.WithTimeout(context.Background(), 3 * time.Second)
-	// Cleanup to prevent memory leaks
-	defer cancel()
-
 	args := []interface{}{
 		entries.Name,
 		entries.Level,
@@ -164,11 +335,15 @@ func (m EntryModel) Update(entries *Entry) error {
 		entries.Website,
 		entries.Address,
 		pq.Array(entries.Mode),
+		entries.Latitude,
+		entries.Longitude,
 		entries.ID,
 		entries.Version,
+		entries.PhoneE164,
+		entries.District,
 	}
 	// Check for edit conflicts
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&entries.Version)
+	err := tx.QueryRowContext(ctx, query, args...).Scan(&entries.Version)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -177,11 +352,34 @@ func (m EntryModel) Update(entries *Entry) error {
 			return err
 		}
 	}
-	return nil
+	return insertRevision(ctx, tx, entries, userID)
+}
+
+// Delete() moves a specific Entry to the trash. The row is only removed
+// for good by Purge() once the retention period has passed. A version of 0
+// deletes whatever version is current, any other version must still match
+func (m EntryModel) Delete(id int64, version int32) error {
+	// Create a context
+	// Time starts when context is created
+	ctx, cancel := context.WithTimeout(context.Background(), 3 * time.Second)
+	// Cleanup to prevent memory leaks
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = deleteEntry(ctx, tx, id, version)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-// Delete() removes a specific Entry
-func (m EntryModel) Delete(id int64) error {
+// deleteEntry() moves an entry to the trash using the caller's transaction
+func deleteEntry(ctx context.Context, tx *sql.Tx, id int64, version int32) error {
 	// Ensure that there is a valid ID
 	if id < 1 {
 		return ErrRecordNotFound
@@ -189,18 +387,15 @@ func (m EntryModel) Delete(id int64) error {
 
 	// Create the delete query
 	query := `
-		DELETE FROM entries
+		UPDATE entries
+		SET deleted_at = NOW()
 		WHERE id = $1
+		AND ($2 = 0 OR version = $2)
+		AND deleted_at IS NULL
 	`
 
-	// Create a context
-	// Time starts when context is created
-	ctx, cancel := context.WithTimeout(context.Background(), 3 * time.Second)
-	// Cleanup to prevent memory leaks
-	defer cancel()
-
 	// Execute the query
-	result, err := m.DB.ExecContext(ctx, query, id)
+	result, err := tx.ExecContext(ctx, query, id, version)
 	if err != nil {
 		return err
 	}
@@ -212,32 +407,34 @@ func (m EntryModel) Delete(id int64) error {
 	}
 	// Check if no rows were affected
 	if rowsAffected == 0 {
+		if version != 0 {
+			return ErrEditConflict
+		}
 		return ErrRecordNotFound
 	}
 	return nil
 }
 
 // The GetAll() method returns a list of all the schools sorted by id
-func (m EntryModel) GetAll (name string, level string, mode []string, filters Filters) ([]*Entry, Metadata, error) {
+func (m EntryModel) GetAll (filter EntryFilter, filters Filters) ([]*Entry, Metadata, error) {
+	// Build the conditions from the filter
+	args := queryArgs{}
+	where, distance := filter.clauses(&args)
+	columns, scanDest := entrySelection(filters.Fields)
 	// Construst the query
 	query := fmt.Sprintf (`
-		SELECT COUNT(*) OVER(), id, created_at, name, level, 
-				contact, phone, email, website, 
-				address, mode, version
+		SELECT COUNT(*) OVER(), %s, %s AS distance
 		FROM entries
-		WHERE (to_tsvector('simple', name) @@ plainto_tsquery('simple', $1) OR $1 = '')
-		AND (to_tsvector('simple', level) @@ plainto_tsquery('simple', $2) OR $2 = '')
-		AND (mode @> $3 OR $3 = '{}' )
+		WHERE %s
 		ORDER BY %s %s, id ASC
-		LIMIT $4 OFFSET $5`, filters.sortColumn(), filters.sortOrder())
+		LIMIT %s OFFSET %s`, columns, distance, where, filters.sortColumn(), filters.sortOrder(),
+		args.add(filters.limit()), args.add(filters.offset()))
 
 
 	// Created a 3-second-timeout context
 	ctx, cancel := context.WithTimeout(context.Background(), 3 * time.Second)
 	defer cancel()
 
-	// Execute the query
-	args := []interface{}{name, level, pq.Array(mode), filters.limit(), filters.offset()}
 	// Execute the query
 	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
@@ -254,20 +451,8 @@ func (m EntryModel) GetAll (name string, level string, mode []string, filters Fi
 	for rows.Next() {
 		var entries Entry
 		// Scan the values from the row into entry
-		err := rows.Scan (
-			&totalRecords,
-			&entries.ID,
-			&entries.CreatedAt,
-			&entries.Name,
-			&entries.Level,
-			&entries.Contact,
-			&entries.Phone,
-			&entries.Email,
-			&entries.Website,
-			&entries.Address,
-			pq.Array(&entries.Mode),
-			&entries.Version,
-		)
+		dest := append([]interface{}{&totalRecords}, scanDest(&entries)...)
+		err := rows.Scan(append(dest, &entries.Distance)...)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
@@ -284,3 +469,211 @@ func (m EntryModel) GetAll (name string, level string, mode []string, filters Fi
 	// Return the slice of schools
 	return entry, metadata, nil
 }
+
+// Restore() takes a specific Entry back out of the trash
+func (m EntryModel) Restore(id int64) error {
+	// Ensure that there is a valid ID
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+		UPDATE entries
+		SET deleted_at = NULL
+		WHERE id = $1
+		AND deleted_at IS NOT NULL
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3 * time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	// Nothing in the trash with that id
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	// An entry that was merged away stops redirecting once it is back
+	_, err = tx.ExecContext(ctx, "DELETE FROM entry_redirects WHERE from_id = $1", id)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Purge() permanently removes entries that have been in the trash
+// for longer than the retention period and returns how many were removed
+func (m EntryModel) Purge(retention time.Duration) (int64, error) {
+	query := `
+		DELETE FROM entries
+		WHERE deleted_at IS NOT NULL
+		AND deleted_at < $1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 30 * time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, time.Now().Add(-retention))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// The GetTrash() method returns the deleted entries, most recently deleted first
+func (m EntryModel) GetTrash(filters Filters) ([]*Entry, Metadata, error) {
+	query := `
+		SELECT COUNT(*) OVER(), ` + entryColumns + `, deleted_at
+		FROM entries
+		WHERE deleted_at IS NOT NULL
+		ORDER BY deleted_at DESC, id ASC
+		LIMIT $1 OFFSET $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3 * time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	entry := []*Entry{}
+	for rows.Next() {
+		var entries Entry
+		dest := append([]interface{}{&totalRecords}, entryDest(&entries)...)
+		err := rows.Scan(append(dest, &entries.DeletedAt)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		entry = append(entry, &entries)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return entry, metadata, nil
+}
+
+// The GetAllByCursor() method returns a page of entries using keyset pagination.
+// Rather than skipping rows with OFFSET it continues from the row named by the
+// cursor, so deep pages cost the same as the first one. The id column breaks
+// ties between rows with the same sort value
+func (m EntryModel) GetAllByCursor(filter EntryFilter, filters Filters) ([]*Entry, Metadata, error) {
+	ks, err := newKeyset(filters)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	args := queryArgs{}
+	where, distance := filter.clauses(&args)
+	// The sort column is always read since the cursors are built from it
+	fields := filters.Fields
+	if len(fields) > 0 {
+		fields = append(append([]string{}, fields...), ks.column)
+	}
+	columns, scanDest := entrySelection(fields)
+	sort := filters.sortExpr(distance, "")
+	keyset, err := ks.clause(&args, sort)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	// Fetch one extra row to find out if there is another page
+	query := fmt.Sprintf(`
+		SELECT %s, %s AS distance
+		FROM entries
+		WHERE %s
+		%s
+		ORDER BY %s %s, id %s
+		LIMIT %s`, columns, distance, where, keyset, sort, ks.columnOrder, ks.idOrder, args.add(filters.limit()+1))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3 * time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	entry := []*Entry{}
+	for rows.Next() {
+		var entries Entry
+		err := rows.Scan(append(scanDest(&entries), &entries.Distance)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		entry = append(entry, &entries)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	entry, metadata := ks.page(entry, filters)
+	return entry, metadata, nil
+}
+
+// sortValue() returns the value of a sortable column as text for use in a cursor
+func (e *Entry) sortValue(column string) string {
+	switch column {
+	case "name":
+		return e.Name
+	case "level":
+		return e.Level
+	// Entries without a location sort as if they were infinitely far away
+	case "distance":
+		if e.Distance == nil {
+			return "Infinity"
+		}
+		return strconv.FormatFloat(*e.Distance, 'g', -1, 64)
+	case "rank":
+		return strconv.FormatFloat(float64(e.Rank), 'g', -1, 32)
+	default:
+		return strconv.FormatInt(e.ID, 10)
+	}
+}
+
+// The Export() method walks every entry matching the same filters as GetAll()
+// and hands each one to fn as soon as it is read from the result set, so the
+// full listing is never held in memory. The caller's context controls how
+// long the export may run
+func (m EntryModel) Export(ctx context.Context, filter EntryFilter, filters Filters, fn func(*Entry) error) error {
+	args := queryArgs{}
+	where, distance := filter.clauses(&args)
+	query := fmt.Sprintf(`
+		SELECT %s, %s AS distance
+		FROM entries
+		WHERE %s
+		ORDER BY %s %s, id ASC`, entryColumns, distance, where, filters.sortColumn(), filters.sortOrder())
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entries Entry
+		err := rows.Scan(append(entryDest(&entries), &entries.Distance)...)
+		if err != nil {
+			return err
+		}
+		// Hand the row over before reading the next one
+		if err = fn(&entries); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
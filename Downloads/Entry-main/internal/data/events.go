@@ -0,0 +1,98 @@
+// Filename: internal/data/events.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// EntryEventChannel is the PostgreSQL NOTIFY channel each event is sent on
+// once it is numbered, as the JSON of its entry_events row
+const EntryEventChannel = "entry_events"
+
+// EntryEventQueuedChannel is the PostgreSQL NOTIFY channel the entries trigger
+// uses to say there are events waiting to be released
+const EntryEventQueuedChannel = "entry_events_queued"
+
+// An EntryEvent records that an entry was created, updated or deleted. The
+// level and mode are kept so feeds can be filtered without reading the entry
+type EntryEvent struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	EntryID   int64     `json:"entry_id"`
+	Action    string    `json:"action"`
+	Version   int32     `json:"version"`
+	Name      string    `json:"name"`
+	Level     string    `json:"level"`
+	Mode      []string  `json:"mode"`
+}
+
+// Define an Entry Event Model to wrap the sql.db connection pool
+type EntryEventModel struct {
+	DB *sql.DB
+}
+
+// GetAfter() returns up to limit events that came after the given one, oldest
+// first. It is used to resume a feed
+func (m EntryEventModel) GetAfter(id int64, limit int) ([]*EntryEvent, error) {
+	query := `
+		SELECT id, created_at, entry_id, action, version, name, level, mode
+		FROM entry_events
+		WHERE id > $1
+		ORDER BY id ASC
+		LIMIT $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, id, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*EntryEvent{}
+	for rows.Next() {
+		var event EntryEvent
+		err := rows.Scan(&event.ID, &event.CreatedAt, &event.EntryID, &event.Action, &event.Version,
+			&event.Name, &event.Level, pq.Array(&event.Mode))
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, &event)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// Release() numbers the queued events whose transactions, and every older
+// transaction, have finished and sends them on EntryEventChannel. Events are
+// held back while an older transaction is still running so their IDs follow
+// the order they were committed in
+func (m EntryEventModel) Release() (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var released int
+	err := m.DB.QueryRowContext(ctx, "SELECT release_entry_events()").Scan(&released)
+	return released, err
+}
+
+// Prune() removes events older than the retention period. Feeds cannot be
+// resumed from before then
+func (m EntryEventModel) Prune(retention time.Duration) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, "DELETE FROM entry_events WHERE created_at < $1", time.Now().Add(-retention))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,111 @@
+// Filename: internal/data/facets.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// The facets that can be counted along with the SQL that produces the value
+// for each row. Mode is an array so each element is counted on its own.
+// Entries without a district are left out of the district counts
+var facetSources = map[string]struct {
+	value string
+	from  string
+	where string
+}{
+	"level":    {value: "level", from: "entries"},
+	"mode":     {value: "m", from: "entries, unnest(mode) AS m"},
+	"district": {value: "district", from: "entries", where: "district <> ''"},
+}
+
+// FacetNames lists the facets in the order they are returned
+var FacetNames = []string{"level", "mode", "district"}
+
+// A FacetCount is the number of entries that share a facet value
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// The Facets() method counts how many entries match each distinct level, mode
+// element and district, using the same filters as GetAll(). A facet named in
+// disjunctive is counted without its own filter, so the counts show what the
+// client would get by picking a different value for that facet. The counts are
+// read from one snapshot so they agree with each other and with the total
+func (m EntryModel) Facets(filter EntryFilter, disjunctive []string) (map[string][]FacetCount, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, 0, err
+	}
+	defer tx.Rollback()
+
+	// Count the entries that match every filter
+	args := queryArgs{}
+	where, _ := filter.clauses(&args)
+	total := 0
+	err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM entries WHERE "+where, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	facets := map[string][]FacetCount{}
+	for _, name := range FacetNames {
+		source := facetSources[name]
+		// Drop the facet's own filter if it is disjunctive
+		f := filter
+		for _, d := range disjunctive {
+			if d == name {
+				switch name {
+				case "level":
+					f.Level = ""
+				case "mode":
+					f.Mode = nil
+				case "district":
+					f.District = ""
+				}
+			}
+		}
+		args := queryArgs{}
+		where, _ := f.clauses(&args)
+		if source.where != "" {
+			where += " AND " + source.where
+		}
+		query := fmt.Sprintf(`
+			SELECT %[1]s, COUNT(*)
+			FROM %[2]s
+			WHERE %[3]s
+			GROUP BY %[1]s
+			ORDER BY COUNT(*) DESC, %[1]s ASC`, source.value, source.from, where)
+
+		rows, err := tx.QueryContext(ctx, query, args...)
+		if err != nil {
+			return nil, 0, err
+		}
+		counts := []FacetCount{}
+		for rows.Next() {
+			var count FacetCount
+			if err := rows.Scan(&count.Value, &count.Count); err != nil {
+				rows.Close()
+				return nil, 0, err
+			}
+			counts = append(counts, count)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, 0, err
+		}
+		facets[name] = counts
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, 0, err
+	}
+	return facets, total, nil
+}
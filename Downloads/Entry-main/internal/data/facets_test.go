@@ -0,0 +1,52 @@
+// Filename: internal/data/facets_test.go
+
+package data
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestFacetsDistrict(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	counts := func(rows ...[2]interface{}) *sqlmock.Rows {
+		r := sqlmock.NewRows([]string{"value", "count"})
+		for _, row := range rows {
+			r.AddRow(row[0], row[1])
+		}
+		return r
+	}
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM entries WHERE deleted_at IS NULL AND district = \$1`).
+		WithArgs("cayo").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectQuery(`SELECT level, COUNT\(\*\)\s+FROM entries\s+WHERE deleted_at IS NULL AND district = \$1\s+GROUP BY level`).
+		WithArgs("cayo").WillReturnRows(counts([2]interface{}{"primary", 3}))
+	mock.ExpectQuery(`SELECT m, COUNT\(\*\)\s+FROM entries, unnest\(mode\) AS m\s+WHERE deleted_at IS NULL AND district = \$1\s+GROUP BY m`).
+		WithArgs("cayo").WillReturnRows(counts([2]interface{}{"in-person", 3}))
+	// The district facet is disjunctive so it drops its own filter
+	mock.ExpectQuery(`SELECT district, COUNT\(\*\)\s+FROM entries\s+WHERE deleted_at IS NULL AND district <> ''\s+GROUP BY district`).
+		WithArgs().WillReturnRows(counts([2]interface{}{"belize", 5}, [2]interface{}{"cayo", 3}))
+	mock.ExpectCommit()
+
+	m := EntryModel{DB: db}
+	facets, total, err := m.Facets(EntryFilter{District: "cayo"}, []string{"district"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 3 {
+		t.Errorf("got total %d; want 3", total)
+	}
+	districts := facets["district"]
+	if len(districts) != 2 || districts[0] != (FacetCount{"belize", 5}) || districts[1] != (FacetCount{"cayo", 3}) {
+		t.Errorf("got district counts %v", districts)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,85 @@
+// Filename: internal/data/fields.go
+
+package data
+
+import (
+	"strings"
+
+	"github.com/lib/pq"
+	"kriol.camerontillett.net/internal/validator"
+)
+
+// An entryField ties a JSON field of an entry to the column it is read from
+type entryField struct {
+	name   string
+	column string
+	dest   func(entries *Entry) interface{}
+}
+
+// The fields a client may ask for with fields=, in the order of entryColumns
+var entryFields = []entryField{
+	{"id", "id", func(e *Entry) interface{} { return &e.ID }},
+	{"name", "name", func(e *Entry) interface{} { return &e.Name }},
+	{"level", "level", func(e *Entry) interface{} { return &e.Level }},
+	{"contact", "contact", func(e *Entry) interface{} { return &e.Contact }},
+	{"phone", "phone", func(e *Entry) interface{} { return &e.Phone }},
+	{"phone_e164", "phone_e164", func(e *Entry) interface{} { return &e.PhoneE164 }},
+	{"email", "email", func(e *Entry) interface{} { return &e.Email }},
+	{"website", "website", func(e *Entry) interface{} { return &e.Website }},
+	{"address", "address", func(e *Entry) interface{} { return &e.Address }},
+	{"district", "district", func(e *Entry) interface{} { return &e.District }},
+	{"mode", "mode", func(e *Entry) interface{} { return pq.Array(&e.Mode) }},
+	{"version", "version", func(e *Entry) interface{} { return &e.Version }},
+	{"latitude", "latitude", func(e *Entry) interface{} { return &e.Latitude }},
+	{"longitude", "longitude", func(e *Entry) interface{} { return &e.Longitude }},
+	{"created_by", "COALESCE(created_by, 0) AS created_by", func(e *Entry) interface{} { return &e.CreatedBy }},
+	{"website_checked_at", "website_checked_at", func(e *Entry) interface{} { return &e.WebsiteCheckedAt }},
+	{"website_status", "website_status", func(e *Entry) interface{} { return &e.WebsiteStatus }},
+	{"website_redirect", "website_redirect", func(e *Entry) interface{} { return &e.WebsiteRedirect }},
+	{"website_error", "website_error", func(e *Entry) interface{} { return &e.WebsiteError }},
+}
+
+// EntryFieldNames lists the values accepted by fields=
+var EntryFieldNames = func() []string {
+	names := make([]string, len(entryFields))
+	for i, field := range entryFields {
+		names[i] = field.name
+	}
+	return names
+}()
+
+// ValidateFields() checks that every requested field exists
+func ValidateFields(v *validator.Validator, fields []string) {
+	for _, field := range fields {
+		v.Check(validator.In(field, EntryFieldNames...), "fields", "must only contain known fields")
+	}
+}
+
+// entrySelection() returns the columns and scan destinations for a set of
+// fields. With no fields every column is read. Otherwise only the requested
+// columns are, plus the id and version which the handlers always need
+func entrySelection(fields []string) (string, func(entries *Entry) []interface{}) {
+	if len(fields) == 0 {
+		return entryColumns, entryDest
+	}
+	wanted := map[string]bool{"id": true, "version": true}
+	for _, field := range fields {
+		wanted[field] = true
+	}
+	var columns []string
+	var selected []entryField
+	for _, field := range entryFields {
+		if wanted[field.name] {
+			columns = append(columns, field.column)
+			selected = append(selected, field)
+		}
+	}
+	dest := func(entries *Entry) []interface{} {
+		dest := make([]interface{}, len(selected))
+		for i, field := range selected {
+			dest[i] = field.dest(entries)
+		}
+		return dest
+	}
+	return strings.Join(columns, ", "), dest
+}
@@ -3,9 +3,15 @@
 package data
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"math"
+	"strconv"
 	"strings"
 
+	"github.com/lib/pq"
 	"kriol.camerontillett.net/internal/validator"
 )
 
@@ -14,6 +20,11 @@ type Filters struct {
 	PageSize int
 	Sort     string
 	SortList []string
+	// Cursor holds the opaque keyset cursor sent by the client. It is only
+	// used by the keyset listing methods
+	Cursor string
+	// Fields limits the columns read for each entry. Empty means all of them
+	Fields []string
 }
 
 func ValidateFilters(v *validator.Validator, f Filters) {
@@ -24,6 +35,12 @@ func ValidateFilters(v *validator.Validator, f Filters) {
 	v.Check(f.PageSize <= 100, "page_size", "must be a maximum of 100")
 	// Check that the sort parameter matches a value in the acceptable sort list
 	v.Check(validator.In(f.Sort, f.SortList...), "sort", "invalid sort value")
+	// A cursor is only valid for the sort it was created with
+	if f.Cursor != "" {
+		cursor, err := DecodeCursor(f.Cursor)
+		v.Check(err == nil, "cursor", "invalid cursor value")
+		v.Check(err != nil || cursor.Sort == f.Sort, "cursor", "does not match the sort value")
+	}
 }
 
 // Sort Column() method safety extracts the sort fild query parameter
@@ -61,6 +78,8 @@ type Metadata struct {
 	FirstPage    int `json:"first_page,omitempty"`
 	LastPage     int `json:"last_page,omitempty"`
 	TotalRecords int `json:"total_records,omitempty"`
+	NextCursor   string `json:"next_cursor,omitempty"`
+	PrevCursor   string `json:"prev_cursor,omitempty"`
 }
 
 // The calculateMetadata() function computes the values for the Metadata fields
@@ -75,4 +94,237 @@ func calculateMetadata(totalRecrods int, page int, pageSize int) Metadata {
 		LastPage:     int(math.Ceil(float64(totalRecrods) / float64(pageSize))),
 		TotalRecords: totalRecrods,
 	}
+}
+
+// A Cursor marks a position in a keyset listing. It holds the sort it was
+// created for, the sort value and id of the row at the edge of the page, and
+// whether the next page is before or after that row
+type Cursor struct {
+	Sort   string `json:"s"`
+	Value  string `json:"v"`
+	ID     int64  `json:"id"`
+	Before bool   `json:"b,omitempty"`
+}
+
+// Encode() turns a Cursor into the opaque string handed to clients
+func (c Cursor) Encode() string {
+	js, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+// DecodeCursor() turns a client supplied string back into a Cursor
+func DecodeCursor(s string) (Cursor, error) {
+	var c Cursor
+	js, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, err
+	}
+	err = json.Unmarshal(js, &c)
+	if err != nil {
+		return c, err
+	}
+	if c.ID < 1 {
+		return c, errors.New("invalid cursor")
+	}
+	return c, nil
+}
+
+// The sortExpr() method returns the SQL for the value a keyset listing sorts
+// by. Entries without a location count as infinitely far away, which is where
+// their NULL distance would sort anyway, so a cursor can be compared with them
+func (f Filters) sortExpr(distance, rank string) string {
+	switch column := f.sortColumn(); column {
+	case "distance":
+		return fmt.Sprintf("COALESCE(%s, 'Infinity')", distance)
+	case "rank":
+		return rank
+	default:
+		return column
+	}
+}
+
+// A keyset holds what a keyset listing needs to continue from a cursor: the
+// cursor itself and the directions to read the rows in
+type keyset struct {
+	cursor      Cursor
+	column      string
+	columnOrder string
+	idOrder     string
+}
+
+// newKeyset() reads the cursor in filters. Going backwards the rows are read
+// in reverse and page() flips them afterwards
+func newKeyset(filters Filters) (keyset, error) {
+	k := keyset{column: filters.sortColumn(), columnOrder: filters.sortOrder(), idOrder: "ASC"}
+	if filters.Cursor == "" {
+		return k, nil
+	}
+	var err error
+	k.cursor, err = DecodeCursor(filters.Cursor)
+	if err != nil {
+		return k, err
+	}
+	if k.cursor.Before {
+		k.columnOrder, k.idOrder = reverseOrder(k.columnOrder), reverseOrder(k.idOrder)
+	}
+	return k, nil
+}
+
+// The clause() method returns the condition for the rows on the far side of
+// the cursor row, or an empty string for the first page. expr is the SQL for
+// the sort value. The id column breaks ties
+func (k keyset) clause(args *queryArgs, expr string) (string, error) {
+	if k.cursor.ID == 0 {
+		return "", nil
+	}
+	op, idOp := ">", ">"
+	if k.columnOrder == "DESC" {
+		op = "<"
+	}
+	if k.idOrder == "DESC" {
+		idOp = "<"
+	}
+	// The sort value is stored as text so convert it back to the column's type
+	var value interface{} = k.cursor.Value
+	cast := ""
+	switch k.column {
+	case "id":
+		id, err := strconv.ParseInt(k.cursor.Value, 10, 64)
+		if err != nil {
+			return "", err
+		}
+		value = id
+	case "distance", "rank":
+		_, err := strconv.ParseFloat(k.cursor.Value, 64)
+		if err != nil {
+			return "", err
+		}
+		cast = "::double precision"
+		if k.column == "rank" {
+			cast = "::real"
+		}
+	}
+	v, id := args.add(value)+cast, args.add(k.cursor.ID)
+	return fmt.Sprintf("AND (%[1]s %[2]s %[4]s OR (%[1]s = %[4]s AND id %[3]s %[5]s))", expr, op, idOp, v, id), nil
+}
+
+// The page() method takes the rows read with one extra and returns the page
+// in display order with the cursors for its neighbours
+func (k keyset) page(entries []*Entry, filters Filters) ([]*Entry, Metadata) {
+	// Drop the extra row and put a backwards page back into display order
+	more := len(entries) > filters.limit()
+	if more {
+		entries = entries[:filters.limit()]
+	}
+	if k.cursor.Before {
+		for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+			entries[i], entries[j] = entries[j], entries[i]
+		}
+	}
+
+	metadata := Metadata{PageSize: filters.PageSize}
+	if len(entries) > 0 {
+		first, last := entries[0], entries[len(entries)-1]
+		// There is a next page if we read forwards and found more rows, or if
+		// we came backwards from a later page
+		if more || k.cursor.Before {
+			metadata.NextCursor = Cursor{Sort: filters.Sort, Value: last.sortValue(k.column), ID: last.ID}.Encode()
+		}
+		if (more && k.cursor.Before) || (filters.Cursor != "" && !k.cursor.Before) {
+			metadata.PrevCursor = Cursor{Sort: filters.Sort, Value: first.sortValue(k.column), ID: first.ID, Before: true}.Encode()
+		}
+	}
+	return entries, metadata
+}
+
+// reverseOrder() flips an ASC/DESC sort direction
+func reverseOrder(order string) string {
+	if order == "ASC" {
+		return "DESC"
+	}
+	return "ASC"
+}
+
+// EntryFilter holds the conditions shared by every entry listing
+type EntryFilter struct {
+	Name  string
+	Level string
+	Mode  []string
+	// District is a district code
+	District string
+	// Near limits results to entries within RadiusKm of a point. A zero
+	// radius only works out the distance without limiting the results
+	Near     *GeoPoint
+	RadiusKm float64
+	// BBox limits results to entries inside a bounding box
+	BBox *BoundingBox
+	// WebsiteStatus is one of WebsiteStatuses, or empty for any
+	WebsiteStatus string
+	// Phone is a phone number in E.164 form
+	Phone string
+}
+
+func ValidateEntryFilter(v *validator.Validator, f EntryFilter) {
+	if f.Near != nil {
+		ValidateCoordinates(v, "near", f.Near.Latitude, f.Near.Longitude)
+	}
+	v.Check(f.RadiusKm == 0 || f.Near != nil, "radius_km", "requires the near parameter")
+	v.Check(f.RadiusKm >= 0, "radius_km", "must be greater than zero")
+	v.Check(f.RadiusKm <= 20000, "radius_km", "must be a maximum of 20000")
+	if f.BBox != nil {
+		ValidateCoordinates(v, "bbox", f.BBox.MinLatitude, f.BBox.MinLongitude)
+		ValidateCoordinates(v, "bbox", f.BBox.MaxLatitude, f.BBox.MaxLongitude)
+		v.Check(f.BBox.MinLatitude <= f.BBox.MaxLatitude, "bbox", "min latitude must not be greater than max latitude")
+	}
+	v.Check(f.WebsiteStatus == "" || validator.In(f.WebsiteStatus, WebsiteStatuses...), "website_status", "must be one of ok, broken or unchecked")
+}
+
+// queryArgs collects the arguments of a query that is built up in pieces
+type queryArgs []interface{}
+
+// add() appends an argument and returns its placeholder
+func (a *queryArgs) add(value interface{}) string {
+	*a = append(*a, value)
+	return "$" + strconv.Itoa(len(*a))
+}
+
+// The clauses() method returns the WHERE conditions for the filter along with
+// a SQL expression for the distance column. The distance is NULL when no
+// point was given. Arguments are added to args as they are needed
+func (f EntryFilter) clauses(args *queryArgs) (where string, distance string) {
+	conditions := []string{"deleted_at IS NULL"}
+	if f.Name != "" {
+		conditions = append(conditions, fmt.Sprintf("to_tsvector('simple', name) @@ plainto_tsquery('simple', %s)", args.add(f.Name)))
+	}
+	if f.Level != "" {
+		conditions = append(conditions, fmt.Sprintf("to_tsvector('simple', level) @@ plainto_tsquery('simple', %s)", args.add(f.Level)))
+	}
+	if len(f.Mode) > 0 {
+		conditions = append(conditions, fmt.Sprintf("mode @> %s", args.add(pq.Array(f.Mode))))
+	}
+	if f.District != "" {
+		conditions = append(conditions, fmt.Sprintf("district = %s", args.add(f.District)))
+	}
+	if f.BBox != nil {
+		conditions = append(conditions, bboxSQL(*f.BBox, args))
+	}
+	if f.Phone != "" {
+		conditions = append(conditions, fmt.Sprintf("phone_e164 = %s", args.add(f.Phone)))
+	}
+	if f.WebsiteStatus != "" {
+		conditions = append(conditions, websiteStatusSQL(f.WebsiteStatus))
+	}
+
+	distance = "NULL::double precision"
+	if f.Near != nil {
+		distance = haversineSQL(args.add(f.Near.Latitude), args.add(f.Near.Longitude))
+		if f.RadiusKm > 0 {
+			// Cut the search down to a box around the circle first
+			if box, ok := radiusBounds(*f.Near, f.RadiusKm); ok {
+				conditions = append(conditions, bboxSQL(box, args))
+			}
+			conditions = append(conditions, fmt.Sprintf("%s <= %s", distance, args.add(f.RadiusKm)))
+		}
+	}
+	return strings.Join(conditions, "\n\t\tAND "), distance
 }
\ No newline at end of file
@@ -0,0 +1,116 @@
+// Filename: internal/data/filters_test.go
+
+package data
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestKeysetClause(t *testing.T) {
+	distance := 12.5
+	tests := []struct {
+		sort   string
+		entry  Entry
+		before bool
+		want   string
+		value  interface{}
+	}{
+		{"id", Entry{ID: 7}, false, "AND (id > $1 OR (id = $1 AND id > $2))", int64(7)},
+		{"-name", Entry{ID: 7, Name: "Belmopan"}, false, "AND (name < $1 OR (name = $1 AND id > $2))", "Belmopan"},
+		{"-name", Entry{ID: 7, Name: "Belmopan"}, true, "AND (name > $1 OR (name = $1 AND id < $2))", "Belmopan"},
+		{"-rank", Entry{ID: 7, Rank: 0.0607927}, false, "AND (RANK < $1::real OR (RANK = $1::real AND id > $2))", "0.0607927"},
+		{"distance", Entry{ID: 7, Distance: &distance}, false,
+			"AND (COALESCE(DIST, 'Infinity') > $1::double precision OR (COALESCE(DIST, 'Infinity') = $1::double precision AND id > $2))", "12.5"},
+		{"distance", Entry{ID: 7}, true,
+			"AND (COALESCE(DIST, 'Infinity') < $1::double precision OR (COALESCE(DIST, 'Infinity') = $1::double precision AND id < $2))", "Infinity"},
+	}
+	for _, tt := range tests {
+		column := strings.TrimPrefix(tt.sort, "-")
+		cursor := Cursor{Sort: tt.sort, Value: tt.entry.sortValue(column), ID: tt.entry.ID, Before: tt.before}
+		filters := Filters{Sort: tt.sort, SortList: []string{tt.sort}, Cursor: cursor.Encode(), PageSize: 20}
+		ks, err := newKeyset(filters)
+		if err != nil {
+			t.Fatal(err)
+		}
+		args := queryArgs{}
+		got, err := ks.clause(&args, filters.sortExpr("DIST", "RANK"))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.sort, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %q; want %q", tt.sort, got, tt.want)
+		}
+		if len(args) != 2 || args[0] != tt.value || args[1] != tt.entry.ID {
+			t.Errorf("%s: got args %v; want [%v %d]", tt.sort, args, tt.value, tt.entry.ID)
+		}
+	}
+}
+
+func TestKeysetClauseFirstPage(t *testing.T) {
+	ks, err := newKeyset(Filters{Sort: "-rank", SortList: []string{"-rank"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := queryArgs{}
+	got, err := ks.clause(&args, "RANK")
+	if got != "" || err != nil || len(args) != 0 {
+		t.Errorf("got %q, %v, %v; want no condition", got, err, args)
+	}
+}
+
+func TestKeysetClauseBadValue(t *testing.T) {
+	for _, sort := range []string{"id", "rank", "distance"} {
+		cursor := Cursor{Sort: sort, Value: "abc", ID: 1}
+		ks, err := newKeyset(Filters{Sort: sort, SortList: []string{sort}, Cursor: cursor.Encode()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ks.clause(&queryArgs{}, sort); err == nil {
+			t.Errorf("%s: got no error for a cursor value of %q", sort, cursor.Value)
+		}
+	}
+}
+
+func TestKeysetPage(t *testing.T) {
+	entries := func(ids ...int64) []*Entry {
+		list := make([]*Entry, len(ids))
+		for i, id := range ids {
+			list[i] = &Entry{ID: id}
+		}
+		return list
+	}
+	ids := func(list []*Entry) []int64 {
+		got := []int64{}
+		for _, e := range list {
+			got = append(got, e.ID)
+		}
+		return got
+	}
+
+	// Reading forwards from the start with a row to spare
+	filters := Filters{Sort: "id", SortList: []string{"id"}, PageSize: 2}
+	ks, _ := newKeyset(filters)
+	page, metadata := ks.page(entries(1, 2, 3), filters)
+	if got := ids(page); len(got) != 2 || got[0] != 1 || got[1] != 2 {
+		t.Errorf("got page %v; want [1 2]", got)
+	}
+	if metadata.NextCursor == "" || metadata.PrevCursor != "" {
+		t.Errorf("got %+v; want only a next cursor", metadata)
+	}
+	next, _ := DecodeCursor(metadata.NextCursor)
+	if next.ID != 2 || next.Value != "2" || next.Before {
+		t.Errorf("got next cursor %+v; want after 2", next)
+	}
+
+	// Reading backwards from 5 returns the rows in reverse
+	filters.Cursor = Cursor{Sort: "id", Value: "5", ID: 5, Before: true}.Encode()
+	ks, _ = newKeyset(filters)
+	page, metadata = ks.page(entries(4, 3, 2), filters)
+	if got := ids(page); len(got) != 2 || got[0] != 3 || got[1] != 4 {
+		t.Errorf("got page %v; want [3 4]", got)
+	}
+	if metadata.NextCursor == "" || metadata.PrevCursor == "" {
+		t.Errorf("got %+v; want both cursors", metadata)
+	}
+}
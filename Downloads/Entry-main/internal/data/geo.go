@@ -0,0 +1,82 @@
+// Filename: internal/data/geo.go
+
+package data
+
+import (
+	"fmt"
+	"math"
+
+	"kriol.camerontillett.net/internal/validator"
+)
+
+// The mean radius of the earth used by the distance calculations
+const earthRadiusKm = 6371.0
+
+// A GeoPoint is a latitude/longitude pair in decimal degrees
+type GeoPoint struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// A BoundingBox is the area between two corners. When MinLongitude is greater
+// than MaxLongitude the box crosses the antimeridian
+type BoundingBox struct {
+	MinLatitude  float64 `json:"min_latitude"`
+	MinLongitude float64 `json:"min_longitude"`
+	MaxLatitude  float64 `json:"max_latitude"`
+	MaxLongitude float64 `json:"max_longitude"`
+}
+
+// ValidateCoordinates() checks that a latitude and longitude are in range
+func ValidateCoordinates(v *validator.Validator, key string, latitude, longitude float64) {
+	v.Check(latitude >= -90 && latitude <= 90, key, "latitude must be between -90 and 90")
+	v.Check(longitude >= -180 && longitude <= 180, key, "longitude must be between -180 and 180")
+}
+
+// haversineSQL() returns a SQL expression for the great-circle distance in
+// kilometres between the entry's coordinates and the point held in the lat and
+// lng placeholders. It only needs plain PostgreSQL, no PostGIS or extensions
+func haversineSQL(lat, lng string) string {
+	return fmt.Sprintf(`(%[3]g * 2 * asin(least(1, sqrt(
+		power(sin(radians(latitude - %[1]s) / 2), 2) +
+		cos(radians(%[1]s)) * cos(radians(latitude)) *
+		power(sin(radians(longitude - %[2]s) / 2), 2)))))`, lat, lng, earthRadiusKm)
+}
+
+// radiusBounds() returns a box that fully contains the circle around a point.
+// It lets the latitude/longitude index discard most rows before the distance is
+// worked out. ok is false when the circle covers a pole or the whole globe
+func radiusBounds(p GeoPoint, radiusKm float64) (box BoundingBox, ok bool) {
+	// One degree of latitude is roughly the same length everywhere
+	dLat := radiusKm / (earthRadiusKm * math.Pi / 180)
+	box.MinLatitude = p.Latitude - dLat
+	box.MaxLatitude = p.Latitude + dLat
+	if box.MinLatitude < -90 || box.MaxLatitude > 90 {
+		return box, false
+	}
+	// Degrees of longitude shrink towards the poles
+	dLng := dLat / math.Cos(p.Latitude*math.Pi/180)
+	if dLng >= 180 {
+		return box, false
+	}
+	box.MinLongitude = p.Longitude - dLng
+	box.MaxLongitude = p.Longitude + dLng
+	// Wrap around the antimeridian
+	if box.MinLongitude < -180 {
+		box.MinLongitude += 360
+	}
+	if box.MaxLongitude > 180 {
+		box.MaxLongitude -= 360
+	}
+	return box, true
+}
+
+// bboxSQL() returns the condition for entries inside a bounding box
+func bboxSQL(box BoundingBox, args *queryArgs) string {
+	lat := fmt.Sprintf("latitude BETWEEN %s AND %s", args.add(box.MinLatitude), args.add(box.MaxLatitude))
+	// A box that crosses the antimeridian wraps around
+	if box.MinLongitude > box.MaxLongitude {
+		return fmt.Sprintf("%s AND (longitude >= %s OR longitude <= %s)", lat, args.add(box.MinLongitude), args.add(box.MaxLongitude))
+	}
+	return fmt.Sprintf("%s AND longitude BETWEEN %s AND %s", lat, args.add(box.MinLongitude), args.add(box.MaxLongitude))
+}
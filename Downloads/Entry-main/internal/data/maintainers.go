@@ -0,0 +1,211 @@
+// Filename: internal/data/maintainers.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// A Maintainer is a user who may edit a specific entry. Only the public parts
+// of the user are shown
+type Maintainer struct {
+	UserID  int64     `json:"user_id"`
+	Name    string    `json:"name"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+// insertMaintainer() adds a maintainer using the caller's transaction
+func insertMaintainer(ctx context.Context, tx *sql.Tx, entryID, userID int64) error {
+	query := `
+		INSERT INTO entry_maintainers (entry_id, user_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`
+	_, err := tx.ExecContext(ctx, query, entryID, userID)
+	return err
+}
+
+// IsMaintainer() reports whether a user maintains an entry. Entries in the
+// trash still count so their maintainers can restore them
+func (m EntryModel) IsMaintainer(entryID, userID int64) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM entry_maintainers
+			WHERE entry_id = $1 AND user_id = $2
+		)
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var exists bool
+	err := m.DB.QueryRowContext(ctx, query, entryID, userID).Scan(&exists)
+	return exists, err
+}
+
+// GetMaintainers() returns the maintainers of an entry in the order they were added
+func (m EntryModel) GetMaintainers(entryID int64) ([]*Maintainer, error) {
+	query := `
+		SELECT users.id, users.name, entry_maintainers.added_at
+		FROM entry_maintainers
+		INNER JOIN users
+		ON users.id = entry_maintainers.user_id
+		WHERE entry_maintainers.entry_id = $1
+		ORDER BY entry_maintainers.added_at ASC, users.id ASC
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, entryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	maintainers := []*Maintainer{}
+	for rows.Next() {
+		var maintainer Maintainer
+		err := rows.Scan(&maintainer.UserID, &maintainer.Name, &maintainer.AddedAt)
+		if err != nil {
+			return nil, err
+		}
+		maintainers = append(maintainers, &maintainer)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return maintainers, nil
+}
+
+// GetMaintainersForEntries() returns the maintainers of several entries with
+// one query, keyed by entry ID. Each list is in the order the maintainers were
+// added. Entries without maintainers are left out
+func (m EntryModel) GetMaintainersForEntries(entryIDs []int64) (map[int64][]*Maintainer, error) {
+	query := `
+		SELECT entry_maintainers.entry_id, users.id, users.name, entry_maintainers.added_at
+		FROM entry_maintainers
+		INNER JOIN users
+		ON users.id = entry_maintainers.user_id
+		WHERE entry_maintainers.entry_id = ANY($1)
+		ORDER BY entry_maintainers.added_at ASC, users.id ASC
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(entryIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	maintainers := map[int64][]*Maintainer{}
+	for rows.Next() {
+		var entryID int64
+		var maintainer Maintainer
+		err := rows.Scan(&entryID, &maintainer.UserID, &maintainer.Name, &maintainer.AddedAt)
+		if err != nil {
+			return nil, err
+		}
+		maintainers[entryID] = append(maintainers[entryID], &maintainer)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return maintainers, nil
+}
+
+// AddMaintainer() lets another user edit an entry. Adding an existing
+// maintainer does nothing. ErrRecordNotFound means the user does not exist
+func (m EntryModel) AddMaintainer(entryID, userID int64) error {
+	query := `
+		INSERT INTO entry_maintainers (entry_id, user_id)
+		SELECT $1, users.id FROM users WHERE users.id = $2
+		ON CONFLICT DO NOTHING
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, entryID, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		// Either the user is missing or is already a maintainer
+		var exists bool
+		err = m.DB.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)", userID).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrRecordNotFound
+		}
+	}
+	return nil
+}
+
+// RemoveMaintainer() takes away a user's right to edit an entry
+func (m EntryModel) RemoveMaintainer(entryID, userID int64) error {
+	query := `
+		DELETE FROM entry_maintainers
+		WHERE entry_id = $1 AND user_id = $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, entryID, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetAllForMaintainer() returns a page of the live entries a user maintains
+func (m EntryModel) GetAllForMaintainer(userID int64, filters Filters) ([]*Entry, Metadata, error) {
+	query := `
+		SELECT COUNT(*) OVER(), ` + entryColumns + `
+		FROM entries
+		WHERE deleted_at IS NULL
+		AND id IN (SELECT entry_id FROM entry_maintainers WHERE user_id = $1)
+		ORDER BY ` + filters.sortColumn() + ` ` + filters.sortOrder() + `, id ASC
+		LIMIT $2 OFFSET $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	entry := []*Entry{}
+	for rows.Next() {
+		var entries Entry
+		err := rows.Scan(append([]interface{}{&totalRecords}, entryDest(&entries)...)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		entry = append(entry, &entries)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return entry, metadata, nil
+}
@@ -16,8 +16,14 @@ var (
 type Models struct {
 	Permissions PermissionModel
 	Entry EntryModel
+	EntryEvents EntryEventModel
+	Revisions RevisionModel
+	Submissions SubmissionModel
+	Suggestions SuggestionModel
 	Tokens TokenModel
 	Users UserModel
+	Vocabularies VocabularyModel
+	Webhooks WebhookModel
 }
 
 // NewModels() allows us to create a new Models
@@ -25,7 +31,13 @@ func NewModels(db *sql.DB) Models {
 	return Models{
 		Permissions: PermissionModel{DB: db},
 		Entry: EntryModel{DB: db},
+		EntryEvents: EntryEventModel{DB: db},
+		Revisions: RevisionModel{DB: db},
+		Submissions: SubmissionModel{DB: db},
+		Suggestions: SuggestionModel{DB: db},
 		Tokens: TokenModel{DB: db},
 		Users: UserModel{DB: db},
+		Vocabularies: VocabularyModel{DB: db},
+		Webhooks: WebhookModel{DB: db},
 	}
 }
\ No newline at end of file
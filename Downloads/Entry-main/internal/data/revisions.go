@@ -0,0 +1,199 @@
+// Filename: internal/data/revisions.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// A Revision is a snapshot of an entry as it looked at a specific version
+type Revision struct {
+	ID        int64     `json:"id"`
+	Entry     Entry     `json:"entry"`
+	ChangedBy int64     `json:"changed_by,omitempty"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// A Change describes a single field that differs between two versions
+type Change struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+// DiffEntries() compares two entries field by field and returns the changes
+// needed to go from the first to the second
+func DiffEntries(from, to *Entry) []Change {
+	fields := []struct {
+		name     string
+		from, to interface{}
+	}{
+		{"name", from.Name, to.Name},
+		{"level", from.Level, to.Level},
+		{"contact", from.Contact, to.Contact},
+		{"phone", from.Phone, to.Phone},
+		{"email", from.Email, to.Email},
+		{"website", from.Website, to.Website},
+		{"address", from.Address, to.Address},
+		{"district", from.District, to.District},
+		{"mode", from.Mode, to.Mode},
+		{"latitude", from.Latitude, to.Latitude},
+		{"longitude", from.Longitude, to.Longitude},
+	}
+	changes := []Change{}
+	for _, f := range fields {
+		if !reflect.DeepEqual(f.from, f.to) {
+			changes = append(changes, Change{Field: f.name, From: f.from, To: f.to})
+		}
+	}
+	return changes
+}
+
+// Define a Revision Model to wrap the sql.db connection pool
+type RevisionModel struct {
+	DB *sql.DB
+}
+
+// insertRevision() records the current state of an entry. It runs inside the
+// same transaction as the write to the entries table so the two never drift
+func insertRevision(ctx context.Context, tx *sql.Tx, entries *Entry, userID int64) error {
+	query := `
+		INSERT INTO entry_revisions (entry_id, version, name, level, contact, phone, email, website, address, mode,
+		                             latitude, longitude, changed_by, district)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, NULLIF($13, 0), $14)
+	`
+	args := []interface{}{
+		entries.ID, entries.Version,
+		entries.Name, entries.Level,
+		entries.Contact, entries.Phone,
+		entries.Email, entries.Website,
+		entries.Address, pq.Array(entries.Mode),
+		entries.Latitude, entries.Longitude,
+		userID, entries.District,
+	}
+	_, err := tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+// GetAllForEntry() returns every stored version of an entry, oldest first
+func (m RevisionModel) GetAllForEntry(entryID int64) ([]*Revision, error) {
+	query := `
+		SELECT id, entry_id, version, name, level, contact, phone, email, website, address, district, mode,
+		       latitude, longitude, COALESCE(changed_by, 0), changed_at
+		FROM entry_revisions
+		WHERE entry_id = $1
+		ORDER BY version ASC
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, entryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []*Revision{}
+	for rows.Next() {
+		var revision Revision
+		err := rows.Scan(revisionDest(&revision)...)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, &revision)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
+
+// Get() returns a single version of an entry
+func (m RevisionModel) Get(entryID int64, version int32) (*Revision, error) {
+	if entryID < 1 || version < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT id, entry_id, version, name, level, contact, phone, email, website, address, district, mode,
+		       latitude, longitude, COALESCE(changed_by, 0), changed_at
+		FROM entry_revisions
+		WHERE entry_id = $1 AND version = $2
+	`
+	var revision Revision
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, entryID, version).Scan(revisionDest(&revision)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &revision, nil
+}
+
+// GetLatest() returns the newest stored version of each of several entries
+// keyed by entry ID
+func (m RevisionModel) GetLatest(entryIDs []int64) (map[int64]*Revision, error) {
+	query := `
+		SELECT DISTINCT ON (entry_id) id, entry_id, version, name, level, contact, phone, email, website,
+		       address, district, mode, latitude, longitude, COALESCE(changed_by, 0), changed_at
+		FROM entry_revisions
+		WHERE entry_id = ANY($1)
+		ORDER BY entry_id, version DESC
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(entryIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := map[int64]*Revision{}
+	for rows.Next() {
+		var revision Revision
+		err := rows.Scan(revisionDest(&revision)...)
+		if err != nil {
+			return nil, err
+		}
+		revisions[revision.Entry.ID] = &revision
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
+
+// revisionDest() lists the scan destinations shared by the revision queries
+func revisionDest(revision *Revision) []interface{} {
+	return []interface{}{
+		&revision.ID,
+		&revision.Entry.ID,
+		&revision.Entry.Version,
+		&revision.Entry.Name,
+		&revision.Entry.Level,
+		&revision.Entry.Contact,
+		&revision.Entry.Phone,
+		&revision.Entry.Email,
+		&revision.Entry.Website,
+		&revision.Entry.Address,
+		&revision.Entry.District,
+		pq.Array(&revision.Entry.Mode),
+		&revision.Entry.Latitude,
+		&revision.Entry.Longitude,
+		&revision.ChangedBy,
+		&revision.ChangedAt,
+	}
+}
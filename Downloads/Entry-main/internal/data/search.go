@@ -0,0 +1,188 @@
+// Filename: internal/data/search.go
+
+package data
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// SearchLanguages maps the "lang" values a client may send to the PostgreSQL
+// text search configuration used for stemming. Each one has its own
+// generated search_<config> column on the entries table
+var SearchLanguages = map[string]string{
+	"simple":  "simple",
+	"en":      "english",
+	"english": "english",
+	"es":      "spanish",
+	"spanish": "spanish",
+}
+
+// ts_headline() copies the field text into its snippets as it is, so the
+// matches are marked with control characters instead of tags. highlight()
+// escapes the snippet and then swaps the markers for <mark> tags
+const (
+	headlineStart   = "\x02"
+	headlineStop    = "\x03"
+	headlineOptions = "StartSel=" + headlineStart + ", StopSel=" + headlineStop +
+		", MaxWords=20, MinWords=5, MaxFragments=2"
+)
+
+// highlight() turns a snippet from ts_headline() into HTML
+func highlight(headline string) string {
+	return strings.NewReplacer(headlineStart, "<mark>", headlineStop, "</mark>").
+		Replace(html.EscapeString(headline))
+}
+
+// The Search() method runs a ranked full-text search across the name, level,
+// contact and address of each entry. The filters from GetAll() still apply.
+// Each result carries its rank and a snippet for every field the search term
+// matched. The snippets are HTML: the text is escaped and the matches are
+// wrapped in <mark> tags
+func (m EntryModel) Search(q string, lang string, filter EntryFilter, filters Filters) ([]*Entry, Metadata, error) {
+	entry, totalRecords, err := m.search(q, lang, filter, filters, nil)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return entry, metadata, nil
+}
+
+// The SearchByCursor() method runs the same search as Search() but continues
+// from a cursor like GetAllByCursor(). The rank is sorted on like any other
+// column
+func (m EntryModel) SearchByCursor(q string, lang string, filter EntryFilter, filters Filters) ([]*Entry, Metadata, error) {
+	ks, err := newKeyset(filters)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	entry, _, err := m.search(q, lang, filter, filters, &ks)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	entry, metadata := ks.page(entry, filters)
+	return entry, metadata, nil
+}
+
+// search() runs the query for Search() and SearchByCursor(). Given a keyset it
+// reads one row more than a page from the cursor instead of a numbered page,
+// and leaves the matches uncounted
+func (m EntryModel) search(q string, lang string, filter EntryFilter, filters Filters, ks *keyset) ([]*Entry, int, error) {
+	config, ok := SearchLanguages[lang]
+	if !ok {
+		return nil, 0, fmt.Errorf("unsupported search language %q", lang)
+	}
+	args := queryArgs{q}
+	where, distance := filter.clauses(&args)
+	rank := fmt.Sprintf("ts_rank(search_%s, q.tsq)", config)
+	// A search for a phone number also finds the entry with that number
+	// however it was written
+	match := fmt.Sprintf("search_%s @@ q.tsq", config)
+	if number, ok := NormalizePhone(q); ok {
+		match = fmt.Sprintf("(%s OR phone_e164 = %s)", match, args.add(number))
+	}
+	column, columnOrder, idOrder := filters.sortColumn(), filters.sortOrder(), "ASC"
+	sort, total, keyset, page := column, "COUNT(*) OVER()", "", ""
+	if ks == nil {
+		page = fmt.Sprintf("LIMIT %s OFFSET %s", args.add(filters.limit()), args.add(filters.offset()))
+	} else {
+		var err error
+		sort, total = filters.sortExpr(distance, rank), "0"
+		columnOrder, idOrder = ks.columnOrder, ks.idOrder
+		keyset, err = ks.clause(&args, sort)
+		if err != nil {
+			return nil, 0, err
+		}
+		// Fetch one extra row to find out if there is another page
+		page = "LIMIT " + args.add(filters.limit()+1)
+	}
+	// The inner query ranks and pages the matches. The outer query only builds
+	// snippets for the rows on the page since ts_headline() is expensive
+	query := fmt.Sprintf(`
+		SELECT e.total, e.id, e.created_at, e.name, e.level,
+				e.contact, e.phone, e.phone_e164, e.email, e.website,
+				e.address, e.district, e.mode, e.version, e.latitude,
+				e.longitude, e.created_by, e.website_checked_at, e.website_status,
+				e.website_redirect, e.website_error, e.distance, e.rank,
+				ts_headline('%[1]s', e.name, q.tsq, '%[4]s'),
+				ts_headline('%[1]s', e.level, q.tsq, '%[4]s'),
+				ts_headline('%[1]s', e.contact, q.tsq, '%[4]s'),
+				ts_headline('%[1]s', e.address, q.tsq, '%[4]s')
+		FROM (
+			SELECT %[12]s AS total, %[5]s,
+					%[6]s AS distance, %[13]s AS rank
+			FROM entries, websearch_to_tsquery('%[1]s', $1) AS q(tsq)
+			WHERE %[9]s
+			AND %[7]s
+			%[10]s
+			ORDER BY %[11]s %[3]s, id %[14]s
+			%[8]s
+		) AS e, websearch_to_tsquery('%[1]s', $1) AS q(tsq)
+		ORDER BY %[2]s %[3]s, id %[14]s`, config, column, columnOrder, headlineOptions,
+		entryColumns, distance, where, page, match, keyset, sort, total, rank, idOrder)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	entry := []*Entry{}
+	for rows.Next() {
+		var entries Entry
+		var headlines [4]string
+		err := rows.Scan(
+			&totalRecords,
+			&entries.ID,
+			&entries.CreatedAt,
+			&entries.Name,
+			&entries.Level,
+			&entries.Contact,
+			&entries.Phone,
+			&entries.PhoneE164,
+			&entries.Email,
+			&entries.Website,
+			&entries.Address,
+			&entries.District,
+			pq.Array(&entries.Mode),
+			&entries.Version,
+			&entries.Latitude,
+			&entries.Longitude,
+			&entries.CreatedBy,
+			&entries.WebsiteCheckedAt,
+			&entries.WebsiteStatus,
+			&entries.WebsiteRedirect,
+			&entries.WebsiteError,
+			&entries.Distance,
+			&entries.Rank,
+			&headlines[0],
+			&headlines[1],
+			&headlines[2],
+			&headlines[3],
+		)
+		if err != nil {
+			return nil, 0, err
+		}
+		// Only keep the snippets for fields that actually matched
+		entries.Highlights = map[string]string{}
+		for i, field := range []string{"name", "level", "contact", "address"} {
+			if strings.Contains(headlines[i], headlineStart) {
+				entries.Highlights[field] = highlight(headlines[i])
+			}
+		}
+		entry = append(entry, &entries)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	return entry, totalRecords, nil
+}
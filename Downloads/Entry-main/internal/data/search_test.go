@@ -0,0 +1,22 @@
+// Filename: internal/data/search_test.go
+
+package data
+
+import "testing"
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		headline string
+		want     string
+	}{
+		{"\x02Belmopan\x03 Primary", "<mark>Belmopan</mark> Primary"},
+		{"<script>alert(1)</script> \x02Primary\x03", "&lt;script&gt;alert(1)&lt;/script&gt; <mark>Primary</mark>"},
+		{"St. John's & \x02Mary\x03", "St. John&#39;s &amp; <mark>Mary</mark>"},
+		{"<mark>Fake</mark>", "&lt;mark&gt;Fake&lt;/mark&gt;"},
+	}
+	for _, tt := range tests {
+		if got := highlight(tt.headline); got != tt.want {
+			t.Errorf("highlight(%q) = %q; want %q", tt.headline, got, tt.want)
+		}
+	}
+}
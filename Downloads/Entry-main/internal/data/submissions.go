@@ -0,0 +1,245 @@
+// Filename: internal/data/submissions.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"kriol.camerontillett.net/internal/validator"
+)
+
+// The states a submission moves through
+const (
+	SubmissionPending  = "pending"
+	SubmissionApproved = "approved"
+	SubmissionRejected = "rejected"
+)
+
+// A Submission is a school proposed by a user who cannot write entries. It is
+// kept apart from the entries until a reviewer decides on it
+type Submission struct {
+	ID          int64      `json:"id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	SubmittedBy int64      `json:"submitted_by"`
+	Entry       Entry      `json:"entry"`
+	Status      string     `json:"status"`
+	Reason      string     `json:"reason,omitempty"`
+	ReviewedBy  int64      `json:"reviewed_by,omitempty"`
+	ReviewedAt  *time.Time `json:"reviewed_at,omitempty"`
+	EntryID     int64      `json:"entry_id,omitempty"`
+	Version     int32      `json:"version"`
+	// Used to tell the submitter about the decision
+	SubmitterName  string `json:"-"`
+	SubmitterEmail string `json:"-"`
+}
+
+// ValidateReason() checks the reason given with a decision
+func ValidateReason(v *validator.Validator, reason string, required bool) {
+	v.Check(!required || reason != "", "reason", "must be provided")
+	v.Check(len(reason) <= 1000, "reason", "must not be more than 1000 bytes long")
+}
+
+// Define a Submission Model to wrap the sql.db connection pool
+type SubmissionModel struct {
+	DB *sql.DB
+}
+
+// The columns read by the submission queries, in the order submissionDest() expects
+const submissionColumns = `submissions.id, submissions.created_at, submissions.submitted_by,
+		submissions.name, submissions.level, submissions.contact, submissions.phone,
+		submissions.email, submissions.website, submissions.address, submissions.district, submissions.mode,
+		submissions.latitude, submissions.longitude, submissions.status, submissions.reason,
+		COALESCE(submissions.reviewed_by, 0), submissions.reviewed_at,
+		COALESCE(submissions.entry_id, 0), submissions.version, users.name, users.email`
+
+// submissionDest() lists the scan destinations for the submissionColumns
+func submissionDest(submission *Submission) []interface{} {
+	return []interface{}{
+		&submission.ID,
+		&submission.CreatedAt,
+		&submission.SubmittedBy,
+		&submission.Entry.Name,
+		&submission.Entry.Level,
+		&submission.Entry.Contact,
+		&submission.Entry.Phone,
+		&submission.Entry.Email,
+		&submission.Entry.Website,
+		&submission.Entry.Address,
+		&submission.Entry.District,
+		pq.Array(&submission.Entry.Mode),
+		&submission.Entry.Latitude,
+		&submission.Entry.Longitude,
+		&submission.Status,
+		&submission.Reason,
+		&submission.ReviewedBy,
+		&submission.ReviewedAt,
+		&submission.EntryID,
+		&submission.Version,
+		&submission.SubmitterName,
+		&submission.SubmitterEmail,
+	}
+}
+
+// Insert() adds a pending submission
+func (m SubmissionModel) Insert(submission *Submission) error {
+	query := `
+		INSERT INTO submissions (submitted_by, name, level, contact, phone, email, website, address, mode,
+		                         latitude, longitude, district)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		RETURNING id, created_at, status, version
+	`
+	args := []interface{}{
+		submission.SubmittedBy,
+		submission.Entry.Name, submission.Entry.Level,
+		submission.Entry.Contact, submission.Entry.Phone,
+		submission.Entry.Email, submission.Entry.Website,
+		submission.Entry.Address, pq.Array(submission.Entry.Mode),
+		submission.Entry.Latitude, submission.Entry.Longitude,
+		submission.Entry.District,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&submission.ID, &submission.CreatedAt, &submission.Status, &submission.Version)
+}
+
+// Get() returns a single submission
+func (m SubmissionModel) Get(id int64) (*Submission, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT ` + submissionColumns + `
+		FROM submissions
+		INNER JOIN users
+		ON users.id = submissions.submitted_by
+		WHERE submissions.id = $1
+	`
+	var submission Submission
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(submissionDest(&submission)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &submission, nil
+}
+
+// GetAll() returns a page of submissions in a given status, oldest first so
+// the queue is worked through in order
+func (m SubmissionModel) GetAll(status string, filters Filters) ([]*Submission, Metadata, error) {
+	query := `
+		SELECT COUNT(*) OVER(), ` + submissionColumns + `
+		FROM submissions
+		INNER JOIN users
+		ON users.id = submissions.submitted_by
+		WHERE submissions.status = $1
+		ORDER BY submissions.created_at ASC, submissions.id ASC
+		LIMIT $2 OFFSET $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, status, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	submissions := []*Submission{}
+	for rows.Next() {
+		var submission Submission
+		err := rows.Scan(append([]interface{}{&totalRecords}, submissionDest(&submission)...)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		submissions = append(submissions, &submission)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return submissions, metadata, nil
+}
+
+// Approve() turns a pending submission into an entry. The submitter is recorded
+// as the creator. ErrEditConflict means the submission was already decided
+func (m SubmissionModel) Approve(submission *Submission, reviewerID int64, reason string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = insertEntry(ctx, tx, &submission.Entry, submission.SubmittedBy)
+	if err != nil {
+		return err
+	}
+	submission.EntryID = submission.Entry.ID
+	err = decideSubmission(ctx, tx, submission, SubmissionApproved, reviewerID, reason)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Reject() closes a pending submission without creating an entry
+func (m SubmissionModel) Reject(submission *Submission, reviewerID int64, reason string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = decideSubmission(ctx, tx, submission, SubmissionRejected, reviewerID, reason)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// decideSubmission() records the reviewer's decision on a pending submission
+func decideSubmission(ctx context.Context, tx *sql.Tx, submission *Submission, status string, reviewerID int64, reason string) error {
+	query := `
+		UPDATE submissions
+		SET status = $1, reason = $2, reviewed_by = $3, reviewed_at = NOW(),
+		    entry_id = NULLIF($4, 0), version = version + 1
+		WHERE id = $5
+		AND version = $6
+		AND status = 'pending'
+		RETURNING reviewed_at, version
+	`
+	args := []interface{}{status, reason, reviewerID, submission.EntryID, submission.ID, submission.Version}
+	err := tx.QueryRowContext(ctx, query, args...).Scan(&submission.ReviewedAt, &submission.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	submission.Status = status
+	submission.Reason = reason
+	submission.ReviewedBy = reviewerID
+	return nil
+}
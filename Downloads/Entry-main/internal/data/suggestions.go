@@ -0,0 +1,318 @@
+// Filename: internal/data/suggestions.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"kriol.camerontillett.net/internal/validator"
+)
+
+// The states a suggestion moves through
+const (
+	SuggestionPending   = "pending"
+	SuggestionApplied   = "applied"
+	SuggestionDismissed = "dismissed"
+)
+
+// EntryFields holds a partial set of entry values. Fields left as nil are
+// not changed when the values are applied
+type EntryFields struct {
+	Name      *string  `json:"name,omitempty"`
+	Level     *string  `json:"level,omitempty"`
+	Contact   *string  `json:"contact,omitempty"`
+	Phone     *string  `json:"phone,omitempty"`
+	Email     *string  `json:"email,omitempty"`
+	Website   *string  `json:"website,omitempty"`
+	Address   *string  `json:"address,omitempty"`
+	District  *string  `json:"district,omitempty"`
+	Mode      []string `json:"mode,omitempty"`
+	Latitude  *float64 `json:"latitude,omitempty"`
+	Longitude *float64 `json:"longitude,omitempty"`
+}
+
+// Apply() copies the fields that were set onto an entry
+func (f EntryFields) Apply(entries *Entry) {
+	if f.Name != nil {
+		entries.Name = *f.Name
+	}
+	if f.Level != nil {
+		entries.Level = *f.Level
+	}
+	if f.Contact != nil {
+		entries.Contact = *f.Contact
+	}
+	if f.Phone != nil {
+		entries.Phone = *f.Phone
+	}
+	if f.Email != nil {
+		entries.Email = *f.Email
+	}
+	if f.Website != nil {
+		entries.Website = *f.Website
+	}
+	if f.Address != nil {
+		entries.Address = *f.Address
+	}
+	if f.District != nil {
+		entries.District = *f.District
+	}
+	if f.Mode != nil {
+		entries.Mode = append([]string{}, f.Mode...)
+	}
+	if f.Latitude != nil {
+		entries.Latitude = f.Latitude
+	}
+	if f.Longitude != nil {
+		entries.Longitude = f.Longitude
+	}
+}
+
+// DiffFields() returns only the fields of to that differ from from
+func DiffFields(from, to *Entry) EntryFields {
+	var f EntryFields
+	for _, change := range DiffEntries(from, to) {
+		switch change.Field {
+		case "name":
+			f.Name = &to.Name
+		case "level":
+			f.Level = &to.Level
+		case "contact":
+			f.Contact = &to.Contact
+		case "phone":
+			f.Phone = &to.Phone
+		case "email":
+			f.Email = &to.Email
+		case "website":
+			f.Website = &to.Website
+		case "address":
+			f.Address = &to.Address
+		case "district":
+			f.District = &to.District
+		case "mode":
+			f.Mode = to.Mode
+		case "latitude":
+			f.Latitude = to.Latitude
+		case "longitude":
+			f.Longitude = to.Longitude
+		}
+	}
+	return f
+}
+
+// A Suggestion is a correction to an entry sent in by the public. Changes is
+// worked out against the entry as it is now when the suggestion is read
+type Suggestion struct {
+	ID           int64       `json:"id"`
+	CreatedAt    time.Time   `json:"created_at"`
+	EntryID      int64       `json:"entry_id"`
+	EntryVersion int32       `json:"entry_version"`
+	Fields       EntryFields `json:"-"`
+	Changes      []Change    `json:"changes"`
+	Note         string      `json:"note,omitempty"`
+	Status       string      `json:"status"`
+	ReviewedBy   int64       `json:"reviewed_by,omitempty"`
+	ReviewedAt   *time.Time  `json:"reviewed_at,omitempty"`
+	Version      int32       `json:"version"`
+	// The entry the suggestion is for, as it is now
+	Entry Entry `json:"-"`
+}
+
+// ValidateNote() checks the optional note left with a suggestion
+func ValidateNote(v *validator.Validator, note string) {
+	v.Check(len(note) <= 500, "note", "must not be more than 500 bytes long")
+}
+
+// Define a Suggestion Model to wrap the sql.db connection pool
+type SuggestionModel struct {
+	DB *sql.DB
+}
+
+// Insert() stores a pending suggestion
+func (m SuggestionModel) Insert(suggestion *Suggestion) error {
+	fields, err := json.Marshal(suggestion.Fields)
+	if err != nil {
+		return err
+	}
+	query := `
+		INSERT INTO suggestions (entry_id, entry_version, fields, note)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, status, version
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{suggestion.EntryID, suggestion.EntryVersion, fields, suggestion.Note}
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&suggestion.ID, &suggestion.CreatedAt, &suggestion.Status, &suggestion.Version)
+}
+
+// The suggestion columns followed by the entry columns. The entry is read in a
+// subquery so its column names do not clash with the suggestion's
+const suggestionQuery = `
+		SELECT COUNT(*) OVER(), s.id, s.created_at, s.entry_id, s.entry_version, s.fields, s.note,
+		       s.status, COALESCE(s.reviewed_by, 0), s.reviewed_at, s.version, e.*
+		FROM suggestions AS s
+		INNER JOIN LATERAL (
+			SELECT ` + entryColumns + `
+			FROM entries
+			WHERE entries.id = s.entry_id
+			AND entries.deleted_at IS NULL
+		) AS e ON true`
+
+// scanSuggestion() reads a row of the suggestionQuery and works out the changes
+func scanSuggestion(rows interface{ Scan(...interface{}) error }, totalRecords *int) (*Suggestion, error) {
+	var suggestion Suggestion
+	var fields []byte
+	dest := []interface{}{
+		totalRecords,
+		&suggestion.ID,
+		&suggestion.CreatedAt,
+		&suggestion.EntryID,
+		&suggestion.EntryVersion,
+		&fields,
+		&suggestion.Note,
+		&suggestion.Status,
+		&suggestion.ReviewedBy,
+		&suggestion.ReviewedAt,
+		&suggestion.Version,
+	}
+	err := rows.Scan(append(dest, entryDest(&suggestion.Entry)...)...)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(fields, &suggestion.Fields)
+	if err != nil {
+		return nil, err
+	}
+	// Show the reviewer what would change if it were applied now
+	proposed := suggestion.Entry
+	suggestion.Fields.Apply(&proposed)
+	suggestion.Changes = DiffEntries(&suggestion.Entry, &proposed)
+	return &suggestion, nil
+}
+
+// Get() returns a single suggestion for an entry that is not in the trash
+func (m SuggestionModel) Get(id int64) (*Suggestion, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var totalRecords int
+	row := m.DB.QueryRowContext(ctx, suggestionQuery+` WHERE s.id = $1`, id)
+	suggestion, err := scanSuggestion(row, &totalRecords)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return suggestion, nil
+}
+
+// GetAll() returns a page of the inbox, oldest first
+func (m SuggestionModel) GetAll(status string, filters Filters) ([]*Suggestion, Metadata, error) {
+	query := suggestionQuery + `
+		WHERE s.status = $1
+		ORDER BY s.created_at ASC, s.id ASC
+		LIMIT $2 OFFSET $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, status, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	suggestions := []*Suggestion{}
+	for rows.Next() {
+		suggestion, err := scanSuggestion(rows, &totalRecords)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		suggestions = append(suggestions, suggestion)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return suggestions, metadata, nil
+}
+
+// Apply() writes the suggested values to the entry and closes the suggestion
+// in one transaction. entries must already have the values applied and be
+// at the version that was read
+func (m SuggestionModel) Apply(suggestion *Suggestion, entries *Entry, userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = updateEntry(ctx, tx, entries, userID)
+	if err != nil {
+		return err
+	}
+	err = closeSuggestion(ctx, tx, suggestion, SuggestionApplied, userID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Dismiss() closes a suggestion without changing the entry
+func (m SuggestionModel) Dismiss(suggestion *Suggestion, userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = closeSuggestion(ctx, tx, suggestion, SuggestionDismissed, userID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// closeSuggestion() records what a reviewer did with a pending suggestion
+func closeSuggestion(ctx context.Context, tx *sql.Tx, suggestion *Suggestion, status string, userID int64) error {
+	query := `
+		UPDATE suggestions
+		SET status = $1, reviewed_by = $2, reviewed_at = NOW(), version = version + 1
+		WHERE id = $3
+		AND version = $4
+		AND status = 'pending'
+		RETURNING reviewed_at, version
+	`
+	args := []interface{}{status, userID, suggestion.ID, suggestion.Version}
+	err := tx.QueryRowContext(ctx, query, args...).Scan(&suggestion.ReviewedAt, &suggestion.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	suggestion.Status = status
+	suggestion.ReviewedBy = userID
+	return nil
+}
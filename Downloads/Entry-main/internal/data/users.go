@@ -9,6 +9,7 @@ import (
 	"errors"
 	"time"
 
+	"github.com/lib/pq"
 	"golang.org/x/crypto/bcrypt"
 	"kriol.camerontillett.net/internal/validator"
 )
@@ -30,6 +31,12 @@ type User struct {
 	Version   int       `json:"-"`
 }
 
+// A PublicUser is the part of a user that is shown alongside their entries
+type PublicUser struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
 // Check if a user is anonymous
 func (u *User) IsAnonymous() bool {
 	return u == AnonymousUser
@@ -161,6 +168,38 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 	return &user, nil
 }
 
+// GetPublic() returns the public details of several users keyed by ID. IDs
+// that do not exist are left out
+func (m UserModel) GetPublic(ids []int64) (map[int64]*PublicUser, error) {
+	query := `
+		SELECT id, name
+		FROM users
+		WHERE id = ANY($1)
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := map[int64]*PublicUser{}
+	for rows.Next() {
+		var user PublicUser
+		err := rows.Scan(&user.ID, &user.Name)
+		if err != nil {
+			return nil, err
+		}
+		users[user.ID] = &user
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
 // The client can update their information
 func (m UserModel) Update(user *User) error {
 	query := `
@@ -0,0 +1,281 @@
+// Filename: internal/data/vocabularies.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/lib/pq"
+	"kriol.camerontillett.net/internal/validator"
+)
+
+var (
+	ErrDuplicateTerm = errors.New("duplicate term")
+	ErrTermInUse     = errors.New("term in use")
+)
+
+// The kinds of vocabulary an entry field can be checked against
+const (
+	VocabularyLevel    = "level"
+	VocabularyMode     = "mode"
+	VocabularyDistrict = "district"
+)
+
+// A Term is one allowed value for a level, mode or district. Entries store the code,
+// the label is what clients display and the aliases are other spellings
+// that are accepted and turned into the code
+type Term struct {
+	ID      int64    `json:"id"`
+	Kind    string   `json:"-"`
+	Code    string   `json:"code"`
+	Label   string   `json:"label"`
+	Aliases []string `json:"aliases"`
+	Version int32    `json:"version"`
+}
+
+// termKey() folds a value down to lower case letters and digits so that
+// "Pre-School", "pre school" and "preschool" all match the same term. The
+// migration that normalized the existing rows uses the same rule
+func termKey(value string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(value) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// ValidateTerm() checks a term before it is written. The vocabulary is used to
+// make sure the code and aliases do not clash with another term
+func ValidateTerm(v *validator.Validator, term *Term, vocabulary *Vocabulary) {
+	v.Check(term.Code != "", "code", "must be provided")
+	v.Check(len(term.Code) <= 100, "code", "must not be more than 100 bytes long")
+	v.Check(termKey(term.Code) != "", "code", "must contain a letter or digit")
+
+	v.Check(term.Label != "", "label", "must be provided")
+	v.Check(len(term.Label) <= 200, "label", "must not be more than 200 bytes long")
+
+	v.Check(term.Aliases != nil, "aliases", "must be provided")
+	v.Check(len(term.Aliases) <= 20, "aliases", "must contain at most 20 entries")
+	v.Check(validator.Unique(term.Aliases), "aliases", "must not contain duplicate entries")
+	for _, alias := range term.Aliases {
+		v.Check(termKey(alias) != "", "aliases", "must contain a letter or digit")
+	}
+
+	// The code and aliases must not resolve to a different term
+	if code, ok := vocabulary.Normalize(term.Kind, term.Code); ok && code != term.Code {
+		v.AddError("code", "is already used by "+code)
+	}
+	for _, alias := range term.Aliases {
+		if code, ok := vocabulary.Normalize(term.Kind, alias); ok && code != term.Code {
+			v.AddError("aliases", alias+" is already used by "+code)
+		}
+	}
+}
+
+// A Vocabulary holds every term so entry values can be checked without a
+// query for each field
+type Vocabulary struct {
+	terms map[string]map[string]string
+}
+
+// NewVocabulary() indexes the terms by their code and aliases
+func NewVocabulary(terms []*Term) *Vocabulary {
+	vocabulary := &Vocabulary{terms: map[string]map[string]string{}}
+	for _, term := range terms {
+		keys, ok := vocabulary.terms[term.Kind]
+		if !ok {
+			keys = map[string]string{}
+			vocabulary.terms[term.Kind] = keys
+		}
+		keys[termKey(term.Code)] = term.Code
+		for _, alias := range term.Aliases {
+			keys[termKey(alias)] = term.Code
+		}
+	}
+	return vocabulary
+}
+
+// Normalize() returns the code for a value if it matches a known code or alias
+func (vocabulary *Vocabulary) Normalize(kind, value string) (string, bool) {
+	key := termKey(value)
+	if key == "" {
+		return "", false
+	}
+	code, ok := vocabulary.terms[kind][key]
+	return code, ok
+}
+
+// Define a Vocabulary Model to wrap the sql.db connection pool
+type VocabularyModel struct {
+	DB *sql.DB
+}
+
+// Load() reads every term into a Vocabulary
+func (m VocabularyModel) Load() (*Vocabulary, error) {
+	query := `
+		SELECT id, kind, code, label, aliases, version
+		FROM vocabularies
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	terms, err := m.query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return NewVocabulary(terms), nil
+}
+
+// GetAll() returns the terms of one kind ordered by their label
+func (m VocabularyModel) GetAll(kind string) ([]*Term, error) {
+	query := `
+		SELECT id, kind, code, label, aliases, version
+		FROM vocabularies
+		WHERE kind = $1
+		ORDER BY label ASC, id ASC
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.query(ctx, query, kind)
+}
+
+// query() runs a query that returns terms
+func (m VocabularyModel) query(ctx context.Context, query string, args ...interface{}) ([]*Term, error) {
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	terms := []*Term{}
+	for rows.Next() {
+		var term Term
+		err := rows.Scan(&term.ID, &term.Kind, &term.Code, &term.Label, pq.Array(&term.Aliases), &term.Version)
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, &term)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return terms, nil
+}
+
+// Get() returns a single term
+func (m VocabularyModel) Get(kind string, id int64) (*Term, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT id, kind, code, label, aliases, version
+		FROM vocabularies
+		WHERE kind = $1 AND id = $2
+	`
+	var term Term
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, kind, id).Scan(&term.ID, &term.Kind, &term.Code, &term.Label, pq.Array(&term.Aliases), &term.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &term, nil
+}
+
+// Insert() adds a new term
+func (m VocabularyModel) Insert(term *Term) error {
+	query := `
+		INSERT INTO vocabularies (kind, code, label, aliases)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, version
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, term.Kind, term.Code, term.Label, pq.Array(term.Aliases)).Scan(&term.ID, &term.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "vocabularies_kind_code_key"`:
+			return ErrDuplicateTerm
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Update() changes the label and aliases of a term. The code is fixed since
+// entries store it
+func (m VocabularyModel) Update(term *Term) error {
+	query := `
+		UPDATE vocabularies
+		SET label = $1, aliases = $2, version = version + 1
+		WHERE id = $3 AND version = $4
+		RETURNING version
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, term.Label, pq.Array(term.Aliases), term.ID, term.Version).Scan(&term.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete() removes a term as long as no entry, including the ones in the
+// trash, still uses it
+func (m VocabularyModel) Delete(kind string, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+		DELETE FROM vocabularies AS v
+		WHERE v.kind = $1 AND v.id = $2
+		AND NOT EXISTS (
+			SELECT 1 FROM entries
+			WHERE (v.kind = 'level' AND entries.level = v.code)
+			OR (v.kind = 'mode' AND v.code = ANY(entries.mode))
+			OR (v.kind = 'district' AND entries.district = v.code)
+		)
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, kind, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		// Work out whether the term is missing or still in use
+		if _, err := m.Get(kind, id); err != nil {
+			return err
+		}
+		return ErrTermInUse
+	}
+	return nil
+}
@@ -0,0 +1,454 @@
+// Filename: internal/data/webhooks.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"kriol.camerontillett.net/internal/linkcheck"
+	"kriol.camerontillett.net/internal/validator"
+)
+
+// The events a webhook can subscribe to
+const (
+	EventEntryCreated  = "entry.created"
+	EventEntryUpdated  = "entry.updated"
+	EventEntryDeleted  = "entry.deleted"
+	EventEntryRestored = "entry.restored"
+	EventUserCreated   = "user.created"
+	EventUserActivated = "user.activated"
+)
+
+// WebhookEvents lists the events a webhook can subscribe to
+var WebhookEvents = []string{
+	EventEntryCreated,
+	EventEntryUpdated,
+	EventEntryDeleted,
+	EventEntryRestored,
+	EventUserCreated,
+	EventUserActivated,
+}
+
+// The states a delivery moves through
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// A Webhook is a subscription to some events. The secret signs the deliveries
+// and is only shown when the webhook is created
+type Webhook struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	CreatedBy int64     `json:"created_by,omitempty"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"-"`
+	Active    bool      `json:"active"`
+	Version   int32     `json:"version"`
+}
+
+// ValidateWebhook() checks a webhook before it is written
+func ValidateWebhook(v *validator.Validator, webhook *Webhook) {
+	v.Check(webhook.URL != "", "url", "must be provided")
+	u, err := url.Parse(webhook.URL)
+	v.Check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "url", "must be an absolute http or https url")
+	v.Check(len(webhook.URL) <= 2000, "url", "must not be more than 2000 bytes long")
+	if err == nil && u.Host != "" {
+		v.Check(publicHost(u.Hostname()), "url", "must point to a public host")
+	}
+
+	v.Check(len(webhook.Events) >= 1, "events", "must contain at least one event")
+	for _, event := range webhook.Events {
+		v.Check(validator.In(event, WebhookEvents...), "events", "must only contain known events")
+	}
+	v.Check(validator.Unique(webhook.Events), "events", "must not contain duplicate events")
+}
+
+// publicHost() reports whether a URL host could be on the internet. Names are
+// checked again when the sender dials them, this only catches the obvious
+// cases early: private addresses, localhost and names without a dot
+func publicHost(host string) bool {
+	if ip := net.ParseIP(host); ip != nil {
+		return linkcheck.PublicIP(ip)
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return false
+	}
+	return strings.Contains(host, ".")
+}
+
+// A WebhookDelivery is one event sent, or to be sent, to one webhook. The
+// deliveries of a webhook make up its delivery log
+type WebhookDelivery struct {
+	ID            int64           `json:"id"`
+	CreatedAt     time.Time       `json:"created_at"`
+	WebhookID     int64           `json:"webhook_id"`
+	Event         string          `json:"event"`
+	Payload       json.RawMessage `json:"payload"`
+	Status        string          `json:"status"`
+	Attempts      int             `json:"attempts"`
+	NextAttemptAt *time.Time      `json:"next_attempt_at,omitempty"`
+	LastStatus    int             `json:"last_status,omitempty"`
+	LastError     string          `json:"last_error,omitempty"`
+	DeliveredAt   *time.Time      `json:"delivered_at,omitempty"`
+	// Filled in when the delivery is claimed for sending
+	URL    string `json:"-"`
+	Secret string `json:"-"`
+}
+
+// Define a Webhook Model to wrap the sql.db connection pool
+type WebhookModel struct {
+	DB *sql.DB
+}
+
+// Insert() adds a webhook
+func (m WebhookModel) Insert(webhook *Webhook) error {
+	query := `
+		INSERT INTO webhooks (created_by, url, events, secret, active)
+		VALUES (NULLIF($1, 0), $2, $3, $4, $5)
+		RETURNING id, created_at, version
+	`
+	args := []interface{}{webhook.CreatedBy, webhook.URL, pq.Array(webhook.Events), webhook.Secret, webhook.Active}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&webhook.ID, &webhook.CreatedAt, &webhook.Version)
+}
+
+// The columns read by the webhook queries, in the order webhookDest() expects
+const webhookColumns = `id, created_at, COALESCE(created_by, 0), url, events, secret, active, version`
+
+// webhookDest() lists the scan destinations for the webhookColumns
+func webhookDest(webhook *Webhook) []interface{} {
+	return []interface{}{
+		&webhook.ID,
+		&webhook.CreatedAt,
+		&webhook.CreatedBy,
+		&webhook.URL,
+		pq.Array(&webhook.Events),
+		&webhook.Secret,
+		&webhook.Active,
+		&webhook.Version,
+	}
+}
+
+// Get() returns a single webhook
+func (m WebhookModel) Get(id int64) (*Webhook, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT ` + webhookColumns + `
+		FROM webhooks
+		WHERE id = $1
+	`
+	var webhook Webhook
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(webhookDest(&webhook)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &webhook, nil
+}
+
+// GetAll() returns a page of webhooks, oldest first
+func (m WebhookModel) GetAll(filters Filters) ([]*Webhook, Metadata, error) {
+	query := `
+		SELECT COUNT(*) OVER(), ` + webhookColumns + `
+		FROM webhooks
+		ORDER BY id ASC
+		LIMIT $1 OFFSET $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	webhooks := []*Webhook{}
+	for rows.Next() {
+		var webhook Webhook
+		err := rows.Scan(append([]interface{}{&totalRecords}, webhookDest(&webhook)...)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		webhooks = append(webhooks, &webhook)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return webhooks, metadata, nil
+}
+
+// Update() changes the URL, events or active flag of a webhook
+func (m WebhookModel) Update(webhook *Webhook) error {
+	query := `
+		UPDATE webhooks
+		SET url = $1, events = $2, active = $3, version = version + 1
+		WHERE id = $4
+		AND version = $5
+		RETURNING version
+	`
+	args := []interface{}{webhook.URL, pq.Array(webhook.Events), webhook.Active, webhook.ID, webhook.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&webhook.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete() removes a webhook along with its delivery log
+func (m WebhookModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, "DELETE FROM webhooks WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// Enqueue() queues a delivery of an event for every active webhook that
+// subscribes to it and returns how many were queued
+func (m WebhookModel) Enqueue(event string, payload []byte) (int64, error) {
+	query := `
+		INSERT INTO webhook_deliveries (webhook_id, event, payload)
+		SELECT id, $1, $2
+		FROM webhooks
+		WHERE active
+		AND $1 = ANY(events)
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, event, payload)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// The columns read by the delivery queries, in the order deliveryDest() expects
+const deliveryColumns = `id, created_at, webhook_id, event, payload, status, attempts, next_attempt_at,
+		last_status, last_error, delivered_at`
+
+// deliveryDest() lists the scan destinations for the deliveryColumns
+func deliveryDest(delivery *WebhookDelivery) []interface{} {
+	return []interface{}{
+		&delivery.ID,
+		&delivery.CreatedAt,
+		&delivery.WebhookID,
+		&delivery.Event,
+		&delivery.Payload,
+		&delivery.Status,
+		&delivery.Attempts,
+		&delivery.NextAttemptAt,
+		&delivery.LastStatus,
+		&delivery.LastError,
+		&delivery.DeliveredAt,
+	}
+}
+
+// GetDeliveries() returns a page of a webhook's delivery log, newest first
+func (m WebhookModel) GetDeliveries(webhookID int64, filters Filters) ([]*WebhookDelivery, Metadata, error) {
+	query := `
+		SELECT COUNT(*) OVER(), ` + deliveryColumns + `
+		FROM webhook_deliveries
+		WHERE webhook_id = $1
+		ORDER BY id DESC
+		LIMIT $2 OFFSET $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, webhookID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	deliveries := []*WebhookDelivery{}
+	for rows.Next() {
+		var delivery WebhookDelivery
+		err := rows.Scan(append([]interface{}{&totalRecords}, deliveryDest(&delivery)...)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		deliveries = append(deliveries, &delivery)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return deliveries, metadata, nil
+}
+
+// GetDelivery() returns a single delivery of a webhook
+func (m WebhookModel) GetDelivery(webhookID, id int64) (*WebhookDelivery, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT ` + deliveryColumns + `
+		FROM webhook_deliveries
+		WHERE webhook_id = $1
+		AND id = $2
+	`
+	var delivery WebhookDelivery
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, webhookID, id).Scan(deliveryDest(&delivery)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &delivery, nil
+}
+
+// Redeliver() queues a new delivery with the same event and payload as an
+// earlier one. The earlier one stays in the log as it was
+func (m WebhookModel) Redeliver(delivery *WebhookDelivery) (*WebhookDelivery, error) {
+	query := `
+		INSERT INTO webhook_deliveries (webhook_id, event, payload)
+		VALUES ($1, $2, $3)
+		RETURNING ` + deliveryColumns
+
+	var redelivery WebhookDelivery
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, delivery.WebhookID, delivery.Event, []byte(delivery.Payload)).Scan(deliveryDest(&redelivery)...)
+	if err != nil {
+		return nil, err
+	}
+	return &redelivery, nil
+}
+
+// ClaimDeliveries() picks up to limit pending deliveries that are due and
+// pushes their next attempt back by lease so no other sender picks them up
+// while they are being sent. Deliveries of inactive webhooks wait until the
+// webhook is turned back on
+func (m WebhookModel) ClaimDeliveries(limit int, lease time.Duration) ([]*WebhookDelivery, error) {
+	query := `
+		UPDATE webhook_deliveries AS d
+		SET next_attempt_at = NOW() + $2 * interval '1 second'
+		FROM webhooks AS w
+		WHERE w.id = d.webhook_id
+		AND d.id IN (
+			SELECT webhook_deliveries.id
+			FROM webhook_deliveries
+			INNER JOIN webhooks
+			ON webhooks.id = webhook_deliveries.webhook_id
+			WHERE webhook_deliveries.status = 'pending'
+			AND webhook_deliveries.next_attempt_at <= NOW()
+			AND webhooks.active
+			ORDER BY webhook_deliveries.next_attempt_at ASC, webhook_deliveries.id ASC
+			LIMIT $1
+			FOR UPDATE OF webhook_deliveries SKIP LOCKED
+		)
+		RETURNING d.id, d.webhook_id, d.event, d.payload, d.attempts, w.url, w.secret
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, limit, int(lease.Seconds()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*WebhookDelivery{}
+	for rows.Next() {
+		var delivery WebhookDelivery
+		err := rows.Scan(&delivery.ID, &delivery.WebhookID, &delivery.Event, &delivery.Payload,
+			&delivery.Attempts, &delivery.URL, &delivery.Secret)
+		if err != nil {
+			return nil, err
+		}
+		delivery.Status = DeliveryPending
+		deliveries = append(deliveries, &delivery)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// RecordAttempt() saves the outcome of sending a claimed delivery
+func (m WebhookModel) RecordAttempt(delivery *WebhookDelivery) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = $1, attempts = $2, next_attempt_at = $3, last_status = $4, last_error = $5,
+		    delivered_at = $6
+		WHERE id = $7
+	`
+	args := []interface{}{
+		delivery.Status,
+		delivery.Attempts,
+		delivery.NextAttemptAt,
+		delivery.LastStatus,
+		delivery.LastError,
+		delivery.DeliveredAt,
+		delivery.ID,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, args...)
+	return err
+}
@@ -0,0 +1,34 @@
+// Filename: internal/data/webhooks_test.go
+
+package data
+
+import (
+	"testing"
+
+	"kriol.camerontillett.net/internal/validator"
+)
+
+func TestValidateWebhookURL(t *testing.T) {
+	tests := []struct {
+		url   string
+		valid bool
+	}{
+		{"https://hooks.example.com/entries", true},
+		{"http://93.184.216.34/hook", true},
+		{"ftp://hooks.example.com", false},
+		{"http://127.0.0.1:4000/v1/entries", false},
+		{"http://169.254.169.254/latest/meta-data", false},
+		{"http://[::1]/hook", false},
+		{"http://10.0.0.5/hook", false},
+		{"http://localhost:8080/hook", false},
+		{"http://api.localhost/hook", false},
+		{"http://intranet/hook", false},
+	}
+	for _, tt := range tests {
+		v := validator.New()
+		ValidateWebhook(v, &Webhook{URL: tt.url, Events: []string{EventEntryCreated}})
+		if v.Valid() != tt.valid {
+			t.Errorf("%s: got valid %t; want %t (%v)", tt.url, v.Valid(), tt.valid, v.Errors)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+// Filename: internal/data/websites.go
+
+package data
+
+import (
+	"context"
+	"time"
+)
+
+// The values accepted by the website_status filter
+const (
+	WebsiteStatusOK        = "ok"
+	WebsiteStatusBroken    = "broken"
+	WebsiteStatusUnchecked = "unchecked"
+)
+
+// WebsiteStatuses lists the values accepted by the website_status filter
+var WebsiteStatuses = []string{WebsiteStatusOK, WebsiteStatusBroken, WebsiteStatusUnchecked}
+
+// websiteStatusSQL() returns the condition for a website_status filter value.
+// A website is broken if it could not be reached or answered with an error
+func websiteStatusSQL(status string) string {
+	switch status {
+	case WebsiteStatusBroken:
+		return "(website_checked_at IS NOT NULL AND (website_status = 0 OR website_status >= 400))"
+	case WebsiteStatusOK:
+		return "(website_checked_at IS NOT NULL AND website_status BETWEEN 1 AND 399)"
+	default:
+		return "website_checked_at IS NULL"
+	}
+}
+
+// A WebsiteCheck is the outcome of requesting an entry's website
+type WebsiteCheck struct {
+	EntryID   int64
+	Website   string
+	CheckedAt time.Time
+	Status    int
+	Redirect  string
+	Error     string
+}
+
+// GetWebsitesToCheck() returns live entries whose website has never been
+// checked or was last checked before olderThan, the longest waiting first.
+// Only the ID and website are filled in
+func (m EntryModel) GetWebsitesToCheck(olderThan time.Time, limit int) ([]*WebsiteCheck, error) {
+	query := `
+		SELECT id, website
+		FROM entries
+		WHERE deleted_at IS NULL
+		AND website <> ''
+		AND (website_checked_at IS NULL OR website_checked_at < $1)
+		ORDER BY website_checked_at ASC NULLS FIRST, id ASC
+		LIMIT $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, olderThan, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	checks := []*WebsiteCheck{}
+	for rows.Next() {
+		var check WebsiteCheck
+		err := rows.Scan(&check.EntryID, &check.Website)
+		if err != nil {
+			return nil, err
+		}
+		checks = append(checks, &check)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return checks, nil
+}
+
+// SetWebsiteCheck() records the outcome of a check. Nothing is written if the
+// website was changed while it was being checked. The entry's version is not
+// bumped since the check is not an edit and must not cause edit conflicts
+func (m EntryModel) SetWebsiteCheck(check *WebsiteCheck) error {
+	query := `
+		UPDATE entries
+		SET website_checked_at = $1, website_status = $2, website_redirect = $3, website_error = $4
+		WHERE id = $5
+		AND website = $6
+	`
+	args := []interface{}{check.CheckedAt, check.Status, check.Redirect, check.Error, check.EntryID, check.Website}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, args...)
+	return err
+}
@@ -0,0 +1,335 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: entry.proto
+
+package entrypb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	emptypb "google.golang.org/protobuf/types/known/emptypb"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	EntryService_Get_FullMethodName    = "/entry.v1.EntryService/Get"
+	EntryService_List_FullMethodName   = "/entry.v1.EntryService/List"
+	EntryService_Create_FullMethodName = "/entry.v1.EntryService/Create"
+	EntryService_Update_FullMethodName = "/entry.v1.EntryService/Update"
+	EntryService_Delete_FullMethodName = "/entry.v1.EntryService/Delete"
+	EntryService_Watch_FullMethodName  = "/entry.v1.EntryService/Watch"
+)
+
+// EntryServiceClient is the client API for EntryService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type EntryServiceClient interface {
+	// Needs entries:read
+	Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*Entry, error)
+	// Needs entries:read. Filtered and paged like GET /v1/entries
+	List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListResponse, error)
+	// Needs entries:write
+	Create(ctx context.Context, in *CreateRequest, opts ...grpc.CallOption) (*Entry, error)
+	// Needs entries:write and to be a maintainer of the entry
+	Update(ctx context.Context, in *UpdateRequest, opts ...grpc.CallOption) (*Entry, error)
+	// Needs entries:write and to be a maintainer of the entry
+	Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	// Needs entries:read. Sends entries as they are created, updated and deleted
+	Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (EntryService_WatchClient, error)
+}
+
+type entryServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewEntryServiceClient(cc grpc.ClientConnInterface) EntryServiceClient {
+	return &entryServiceClient{cc}
+}
+
+func (c *entryServiceClient) Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*Entry, error) {
+	out := new(Entry)
+	err := c.cc.Invoke(ctx, EntryService_Get_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *entryServiceClient) List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListResponse, error) {
+	out := new(ListResponse)
+	err := c.cc.Invoke(ctx, EntryService_List_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *entryServiceClient) Create(ctx context.Context, in *CreateRequest, opts ...grpc.CallOption) (*Entry, error) {
+	out := new(Entry)
+	err := c.cc.Invoke(ctx, EntryService_Create_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *entryServiceClient) Update(ctx context.Context, in *UpdateRequest, opts ...grpc.CallOption) (*Entry, error) {
+	out := new(Entry)
+	err := c.cc.Invoke(ctx, EntryService_Update_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *entryServiceClient) Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, EntryService_Delete_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *entryServiceClient) Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (EntryService_WatchClient, error) {
+	stream, err := c.cc.NewStream(ctx, &EntryService_ServiceDesc.Streams[0], EntryService_Watch_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &entryServiceWatchClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type EntryService_WatchClient interface {
+	Recv() (*EntryEvent, error)
+	grpc.ClientStream
+}
+
+type entryServiceWatchClient struct {
+	grpc.ClientStream
+}
+
+func (x *entryServiceWatchClient) Recv() (*EntryEvent, error) {
+	m := new(EntryEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// EntryServiceServer is the server API for EntryService service.
+// All implementations must embed UnimplementedEntryServiceServer
+// for forward compatibility
+type EntryServiceServer interface {
+	// Needs entries:read
+	Get(context.Context, *GetRequest) (*Entry, error)
+	// Needs entries:read. Filtered and paged like GET /v1/entries
+	List(context.Context, *ListRequest) (*ListResponse, error)
+	// Needs entries:write
+	Create(context.Context, *CreateRequest) (*Entry, error)
+	// Needs entries:write and to be a maintainer of the entry
+	Update(context.Context, *UpdateRequest) (*Entry, error)
+	// Needs entries:write and to be a maintainer of the entry
+	Delete(context.Context, *DeleteRequest) (*emptypb.Empty, error)
+	// Needs entries:read. Sends entries as they are created, updated and deleted
+	Watch(*WatchRequest, EntryService_WatchServer) error
+	mustEmbedUnimplementedEntryServiceServer()
+}
+
+// UnimplementedEntryServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedEntryServiceServer struct {
+}
+
+func (UnimplementedEntryServiceServer) Get(context.Context, *GetRequest) (*Entry, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Get not implemented")
+}
+func (UnimplementedEntryServiceServer) List(context.Context, *ListRequest) (*ListResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method List not implemented")
+}
+func (UnimplementedEntryServiceServer) Create(context.Context, *CreateRequest) (*Entry, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Create not implemented")
+}
+func (UnimplementedEntryServiceServer) Update(context.Context, *UpdateRequest) (*Entry, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Update not implemented")
+}
+func (UnimplementedEntryServiceServer) Delete(context.Context, *DeleteRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Delete not implemented")
+}
+func (UnimplementedEntryServiceServer) Watch(*WatchRequest, EntryService_WatchServer) error {
+	return status.Errorf(codes.Unimplemented, "method Watch not implemented")
+}
+func (UnimplementedEntryServiceServer) mustEmbedUnimplementedEntryServiceServer() {}
+
+// UnsafeEntryServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to EntryServiceServer will
+// result in compilation errors.
+type UnsafeEntryServiceServer interface {
+	mustEmbedUnimplementedEntryServiceServer()
+}
+
+func RegisterEntryServiceServer(s grpc.ServiceRegistrar, srv EntryServiceServer) {
+	s.RegisterService(&EntryService_ServiceDesc, srv)
+}
+
+func _EntryService_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EntryServiceServer).Get(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: EntryService_Get_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EntryServiceServer).Get(ctx, req.(*GetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EntryService_List_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EntryServiceServer).List(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: EntryService_List_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EntryServiceServer).List(ctx, req.(*ListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EntryService_Create_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EntryServiceServer).Create(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: EntryService_Create_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EntryServiceServer).Create(ctx, req.(*CreateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EntryService_Update_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EntryServiceServer).Update(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: EntryService_Update_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EntryServiceServer).Update(ctx, req.(*UpdateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EntryService_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EntryServiceServer).Delete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: EntryService_Delete_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EntryServiceServer).Delete(ctx, req.(*DeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EntryService_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(EntryServiceServer).Watch(m, &entryServiceWatchServer{stream})
+}
+
+type EntryService_WatchServer interface {
+	Send(*EntryEvent) error
+	grpc.ServerStream
+}
+
+type entryServiceWatchServer struct {
+	grpc.ServerStream
+}
+
+func (x *entryServiceWatchServer) Send(m *EntryEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// EntryService_ServiceDesc is the grpc.ServiceDesc for EntryService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var EntryService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "entry.v1.EntryService",
+	HandlerType: (*EntryServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Get",
+			Handler:    _EntryService_Get_Handler,
+		},
+		{
+			MethodName: "List",
+			Handler:    _EntryService_List_Handler,
+		},
+		{
+			MethodName: "Create",
+			Handler:    _EntryService_Create_Handler,
+		},
+		{
+			MethodName: "Update",
+			Handler:    _EntryService_Update_Handler,
+		},
+		{
+			MethodName: "Delete",
+			Handler:    _EntryService_Delete_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Watch",
+			Handler:       _EntryService_Watch_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "entry.proto",
+}
@@ -0,0 +1,7 @@
+// Filename: internal/entrypb/generate.go
+
+// Package entrypb holds the protocol buffer and gRPC code generated from
+// proto/entry.proto. Run go generate after changing the .proto file
+package entrypb
+
+//go:generate protoc -I ../../proto --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative entry.proto
@@ -0,0 +1,252 @@
+// Filename: internal/jsonpatch/jsonpatch.go
+
+// Package jsonpatch applies JSON Merge Patch (RFC 7396) and JSON Patch
+// (RFC 6902) documents. Only the add, remove, replace and test operations of
+// JSON Patch are supported
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrTestFailed is returned when a "test" operation does not match
+	ErrTestFailed = errors.New("test operation failed")
+)
+
+// MergePatch() applies an RFC 7396 merge patch to a JSON document. Members set
+// to null in the patch are removed, objects are merged and everything else,
+// arrays included, is replaced
+func MergePatch(doc, patch []byte) ([]byte, error) {
+	var target, p interface{}
+	if err := json.Unmarshal(doc, &target); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return nil, fmt.Errorf("merge patch is not valid JSON: %w", err)
+	}
+	return json.Marshal(mergeValue(target, p))
+}
+
+func mergeValue(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+			continue
+		}
+		targetObject[key] = mergeValue(targetObject[key], value)
+	}
+	return targetObject
+}
+
+// An Operation is a single step of a JSON Patch
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// Apply() runs the operations of an RFC 6902 patch against a JSON document in
+// order. If any operation fails the document is left as it was
+func Apply(doc, patch []byte) ([]byte, error) {
+	var target interface{}
+	if err := json.Unmarshal(doc, &target); err != nil {
+		return nil, err
+	}
+	var operations []Operation
+	if err := json.Unmarshal(patch, &operations); err != nil {
+		return nil, fmt.Errorf("patch must be a JSON array of operations: %w", err)
+	}
+	for i, operation := range operations {
+		var err error
+		target, err = applyOperation(target, operation)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d: %w", i, err)
+		}
+	}
+	return json.Marshal(target)
+}
+
+func applyOperation(doc interface{}, operation Operation) (interface{}, error) {
+	tokens, err := parsePointer(operation.Path)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	switch operation.Op {
+	case "add", "replace", "test":
+		if len(operation.Value) == 0 {
+			return nil, fmt.Errorf("%q needs a value", operation.Op)
+		}
+		if err := json.Unmarshal(operation.Value, &value); err != nil {
+			return nil, err
+		}
+	case "remove":
+	default:
+		return nil, fmt.Errorf("unsupported op %q", operation.Op)
+	}
+
+	// The whole document
+	if len(tokens) == 0 {
+		switch operation.Op {
+		case "add", "replace":
+			return value, nil
+		case "test":
+			if !reflect.DeepEqual(doc, value) {
+				return nil, ErrTestFailed
+			}
+			return doc, nil
+		default:
+			return nil, errors.New("cannot remove the whole document")
+		}
+	}
+
+	if operation.Op == "test" {
+		current, err := get(doc, tokens)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(current, value) {
+			return nil, ErrTestFailed
+		}
+		return doc, nil
+	}
+	return update(doc, tokens, operation.Op, value)
+}
+
+// parsePointer() splits an RFC 6901 JSON pointer into its reference tokens
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("path %q must start with /", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// get() returns the value a pointer refers to
+func get(doc interface{}, tokens []string) (interface{}, error) {
+	for _, token := range tokens {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			value, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("path member %q does not exist", token)
+			}
+			doc = value
+		case []interface{}:
+			i, err := arrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[i]
+		default:
+			return nil, fmt.Errorf("path member %q does not exist", token)
+		}
+	}
+	return doc, nil
+}
+
+// update() performs an add, remove or replace on the parent of the last token
+// and returns the changed container so arrays can grow or shrink
+func update(doc interface{}, tokens []string, op string, value interface{}) (interface{}, error) {
+	token := tokens[0]
+	last := len(tokens) == 1
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		current, exists := node[token]
+		if !last {
+			if !exists {
+				return nil, fmt.Errorf("path member %q does not exist", token)
+			}
+			child, err := update(current, tokens[1:], op, value)
+			if err != nil {
+				return nil, err
+			}
+			node[token] = child
+			return node, nil
+		}
+		switch op {
+		case "add":
+			node[token] = value
+		case "replace":
+			if !exists {
+				return nil, fmt.Errorf("path member %q does not exist", token)
+			}
+			node[token] = value
+		case "remove":
+			if !exists {
+				return nil, fmt.Errorf("path member %q does not exist", token)
+			}
+			delete(node, token)
+		}
+		return node, nil
+	case []interface{}:
+		i, err := arrayIndex(token, len(node), last && op == "add")
+		if err != nil {
+			return nil, err
+		}
+		if !last {
+			child, err := update(node[i], tokens[1:], op, value)
+			if err != nil {
+				return nil, err
+			}
+			node[i] = child
+			return node, nil
+		}
+		switch op {
+		case "add":
+			node = append(node, nil)
+			copy(node[i+1:], node[i:])
+			node[i] = value
+		case "replace":
+			node[i] = value
+		case "remove":
+			node = append(node[:i], node[i+1:]...)
+		}
+		return node, nil
+	default:
+		return nil, fmt.Errorf("path member %q does not exist", token)
+	}
+}
+
+// arrayIndex() reads an array index. "-" and the length itself are only
+// allowed when adding, where they mean the end of the array
+func arrayIndex(token string, length int, adding bool) (int, error) {
+	if token == "-" {
+		if !adding {
+			return 0, errors.New(`"-" can only be used to add to an array`)
+		}
+		return length, nil
+	}
+	// Only digits, and leading zeros are not allowed
+	if token == "" || (len(token) > 1 && token[0] == '0') || strings.TrimLeft(token, "0123456789") != "" {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	if i > length || (i == length && !adding) {
+		return 0, fmt.Errorf("array index %d is out of range", i)
+	}
+	return i, nil
+}
@@ -0,0 +1,191 @@
+// Filename: internal/jsonpatch/jsonpatch_test.go
+
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// equalJSON() compares two documents regardless of key order
+func equalJSON(t *testing.T, got []byte, want string) bool {
+	t.Helper()
+	var g, w interface{}
+	if err := json.Unmarshal(got, &g); err != nil {
+		t.Fatalf("invalid result %s: %v", got, err)
+	}
+	if err := json.Unmarshal([]byte(want), &w); err != nil {
+		t.Fatalf("invalid expectation %s: %v", want, err)
+	}
+	return reflect.DeepEqual(g, w)
+}
+
+func TestArrayIndex(t *testing.T) {
+	tests := []struct {
+		token  string
+		length int
+		adding bool
+		want   int
+		valid  bool
+	}{
+		{"0", 3, false, 0, true},
+		{"2", 3, false, 2, true},
+		{"3", 3, false, 0, false},
+		{"3", 3, true, 3, true},
+		{"4", 3, true, 0, false},
+		{"-", 3, true, 3, true},
+		{"-", 3, false, 0, false},
+		{"01", 3, false, 0, false},
+		{"00", 3, true, 0, false},
+		{"", 3, true, 0, false},
+		{"-1", 3, false, 0, false},
+		{"+1", 3, false, 0, false},
+		{"1.0", 3, false, 0, false},
+		{"a", 3, false, 0, false},
+		{"0", 0, false, 0, false},
+		{"0", 0, true, 0, true},
+	}
+	for _, tt := range tests {
+		got, err := arrayIndex(tt.token, tt.length, tt.adding)
+		if tt.valid && (err != nil || got != tt.want) {
+			t.Errorf("arrayIndex(%q, %d, %t) = %d, %v; want %d", tt.token, tt.length, tt.adding, got, err, tt.want)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("arrayIndex(%q, %d, %t) = %d; want an error", tt.token, tt.length, tt.adding, got)
+		}
+	}
+}
+
+func TestParsePointer(t *testing.T) {
+	tests := []struct {
+		pointer string
+		want    []string
+	}{
+		{"", nil},
+		{"/", []string{""}},
+		{"/mode/0", []string{"mode", "0"}},
+		{"/a~1b", []string{"a/b"}},
+		{"/m~0n", []string{"m~n"}},
+		// ~01 is ~ followed by 1, not /
+		{"/~01", []string{"~1"}},
+		{"/~10", []string{"/0"}},
+	}
+	for _, tt := range tests {
+		got, err := parsePointer(tt.pointer)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parsePointer(%q) = %q, %v; want %q", tt.pointer, got, err, tt.want)
+		}
+	}
+	if _, err := parsePointer("mode"); err == nil {
+		t.Error("a pointer without a leading / was accepted")
+	}
+}
+
+func TestApply(t *testing.T) {
+	const entry = `{"name": "Belmopan Primary", "mode": ["in-person", "online"], "a/b": 1, "m~n": 2}`
+	tests := []struct {
+		name  string
+		patch string
+		want  string
+	}{
+		{"add a mode at the end", `[{"op": "add", "path": "/mode/-", "value": "hybrid"}]`,
+			`{"name": "Belmopan Primary", "mode": ["in-person", "online", "hybrid"], "a/b": 1, "m~n": 2}`},
+		{"add a mode at the length", `[{"op": "add", "path": "/mode/2", "value": "hybrid"}]`,
+			`{"name": "Belmopan Primary", "mode": ["in-person", "online", "hybrid"], "a/b": 1, "m~n": 2}`},
+		{"insert a mode", `[{"op": "add", "path": "/mode/0", "value": "hybrid"}]`,
+			`{"name": "Belmopan Primary", "mode": ["hybrid", "in-person", "online"], "a/b": 1, "m~n": 2}`},
+		{"remove a mode", `[{"op": "remove", "path": "/mode/0"}]`,
+			`{"name": "Belmopan Primary", "mode": ["online"], "a/b": 1, "m~n": 2}`},
+		{"replace a mode", `[{"op": "replace", "path": "/mode/1", "value": "hybrid"}]`,
+			`{"name": "Belmopan Primary", "mode": ["in-person", "hybrid"], "a/b": 1, "m~n": 2}`},
+		{"test then replace", `[{"op": "test", "path": "/name", "value": "Belmopan Primary"}, {"op": "replace", "path": "/name", "value": "BPS"}]`,
+			`{"name": "BPS", "mode": ["in-person", "online"], "a/b": 1, "m~n": 2}`},
+		{"escaped members", `[{"op": "replace", "path": "/a~1b", "value": 3}, {"op": "remove", "path": "/m~0n"}]`,
+			`{"name": "Belmopan Primary", "mode": ["in-person", "online"], "a/b": 3}`},
+		{"replace the document", `[{"op": "replace", "path": "", "value": {"name": "x"}}]`, `{"name": "x"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Apply([]byte(entry), []byte(tt.patch))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !equalJSON(t, got, tt.want) {
+				t.Errorf("got %s; want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyErrors(t *testing.T) {
+	const entry = `{"name": "Belmopan Primary", "mode": ["in-person", "online"]}`
+	tests := []struct {
+		name       string
+		patch      string
+		testFailed bool
+	}{
+		{"test a different value", `[{"op": "test", "path": "/name", "value": "Other"}]`, true},
+		{"test a different mode list", `[{"op": "test", "path": "/mode", "value": ["online", "in-person"]}]`, true},
+		{"test the whole document", `[{"op": "test", "path": "", "value": {}}]`, true},
+		{"test after a change", `[{"op": "replace", "path": "/name", "value": "BPS"}, {"op": "test", "path": "/name", "value": "Belmopan Primary"}]`, true},
+		{"test a missing member", `[{"op": "test", "path": "/email", "value": "x"}]`, false},
+		{"replace past the end", `[{"op": "replace", "path": "/mode/2", "value": "hybrid"}]`, false},
+		{"replace with -", `[{"op": "replace", "path": "/mode/-", "value": "hybrid"}]`, false},
+		{"remove past the end", `[{"op": "remove", "path": "/mode/2"}]`, false},
+		{"remove a missing member", `[{"op": "remove", "path": "/email"}]`, false},
+		{"replace a missing member", `[{"op": "replace", "path": "/email", "value": "x"}]`, false},
+		{"add with a leading zero", `[{"op": "add", "path": "/mode/01", "value": "hybrid"}]`, false},
+		{"add without a value", `[{"op": "add", "path": "/name"}]`, false},
+		{"add below a missing member", `[{"op": "add", "path": "/a/b", "value": 1}]`, false},
+		{"unsupported op", `[{"op": "move", "from": "/name", "path": "/contact"}]`, false},
+		{"remove the document", `[{"op": "remove", "path": ""}]`, false},
+		{"not an array", `{"op": "remove", "path": "/name"}`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Apply([]byte(entry), []byte(tt.patch))
+			if err == nil {
+				t.Fatal("got no error")
+			}
+			if errors.Is(err, ErrTestFailed) != tt.testFailed {
+				t.Errorf("got %v; want ErrTestFailed to be %t", err, tt.testFailed)
+			}
+		})
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	const entry = `{"name": "Belmopan Primary", "latitude": 17.25, "mode": ["in-person", "online"], "extra": {"a": 1, "b": 2}}`
+	tests := []struct {
+		name  string
+		patch string
+		want  string
+	}{
+		{"replace a member", `{"name": "BPS"}`,
+			`{"name": "BPS", "latitude": 17.25, "mode": ["in-person", "online"], "extra": {"a": 1, "b": 2}}`},
+		{"null removes a member", `{"latitude": null}`,
+			`{"name": "Belmopan Primary", "mode": ["in-person", "online"], "extra": {"a": 1, "b": 2}}`},
+		{"null for a missing member", `{"email": null}`, entry},
+		{"arrays are replaced", `{"mode": ["online"]}`,
+			`{"name": "Belmopan Primary", "latitude": 17.25, "mode": ["online"], "extra": {"a": 1, "b": 2}}`},
+		{"objects are merged", `{"extra": {"a": null, "c": 3}}`,
+			`{"name": "Belmopan Primary", "latitude": 17.25, "mode": ["in-person", "online"], "extra": {"b": 2, "c": 3}}`},
+		{"a non-object replaces the document", `["x"]`, `["x"]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MergePatch([]byte(entry), []byte(tt.patch))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !equalJSON(t, got, tt.want) {
+				t.Errorf("got %s; want %s", got, tt.want)
+			}
+		})
+	}
+	if _, err := MergePatch([]byte(entry), []byte(`{`)); err == nil {
+		t.Error("an invalid patch was accepted")
+	}
+}
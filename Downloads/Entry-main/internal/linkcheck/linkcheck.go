@@ -0,0 +1,190 @@
+// Filename: internal/linkcheck/linkcheck.go
+
+// Package linkcheck finds out whether websites still answer. Requests to the
+// same host are spaced out so a directory with many schools on one host does
+// not hammer it
+package linkcheck
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// The User-Agent sent with every check
+const userAgent = "kriol-entry-linkcheck/1.0"
+
+// ErrPrivateAddress is returned for a website that resolves to a loopback,
+// private or link-local address. Entries are written by users, so the
+// checker must not be pointed at services inside our own network
+var ErrPrivateAddress = errors.New("the website resolves to a private address")
+
+// A Result is the outcome of checking one website. Status is the HTTP status
+// of the final response, or 0 if no response was received, in which case Err
+// says why. Redirect is the URL that was finally reached if it differs from
+// the one checked
+type Result struct {
+	CheckedAt time.Time
+	Status    int
+	Redirect  string
+	Err       string
+}
+
+// Broken() reports whether the website should be treated as dead
+func (r Result) Broken() bool {
+	return r.Status == 0 || r.Status >= 400
+}
+
+// A Checker checks websites with an HTTP client. The client's timeout and
+// redirect policy are used as they are, so tests can pass in the client of an
+// httptest server
+type Checker struct {
+	client    *http.Client
+	hostDelay time.Duration
+
+	mu sync.Mutex
+	// The earliest time the next request may be sent to each host
+	next map[string]time.Time
+}
+
+// NewClient() returns the client the checker uses outside of tests. It gives
+// up after timeout and refuses to connect to private addresses. The address
+// is checked as it is dialled, so redirects and DNS answers that change
+// between lookups are caught too
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, Control: RefusePrivate}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	// A proxy would make the connection for us and skip the check
+	transport.Proxy = nil
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+// RefusePrivate() stops a dialer connecting to anything but a public address.
+// It is a net.Dialer Control function, so the webhook sender can use it too
+func RefusePrivate(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !PublicIP(ip) {
+		return ErrPrivateAddress
+	}
+	return nil
+}
+
+// PublicIP() reports whether an address can be reached on the internet
+func PublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() || ip.IsUnspecified())
+}
+
+// New() returns a Checker that waits at least hostDelay between requests to
+// the same host. A nil client uses http.DefaultClient
+func New(client *http.Client, hostDelay time.Duration) *Checker {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Checker{
+		client:    client,
+		hostDelay: hostDelay,
+		next:      make(map[string]time.Time),
+	}
+}
+
+// Check() requests a website, first with HEAD and then with GET if the server
+// refuses HEAD or answers it with an error. Many servers do not implement HEAD
+// properly
+func (c *Checker) Check(ctx context.Context, website string) Result {
+	u, err := url.Parse(website)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Result{CheckedAt: time.Now(), Err: "not an http or https url"}
+	}
+
+	result := c.request(ctx, http.MethodHead, u)
+	if result.Broken() && ctx.Err() == nil {
+		result = c.request(ctx, http.MethodGet, u)
+	}
+	return result
+}
+
+// request() sends a single request once the host is free
+func (c *Checker) request(ctx context.Context, method string, u *url.URL) Result {
+	if err := c.wait(ctx, u.Hostname()); err != nil {
+		return Result{CheckedAt: time.Now(), Err: err.Error()}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return Result{CheckedAt: time.Now(), Err: err.Error()}
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := c.client.Do(req)
+	result := Result{CheckedAt: time.Now()}
+	if err != nil {
+		result.Err = describe(err)
+		return result
+	}
+	defer resp.Body.Close()
+	// Read a little of the body so the connection can be reused
+	io.CopyN(io.Discard, resp.Body, 4096)
+
+	result.Status = resp.StatusCode
+	if final := resp.Request.URL.String(); final != u.String() {
+		result.Redirect = final
+	}
+	return result
+}
+
+// wait() blocks until the next request to a host is allowed and reserves
+// the slot after it
+func (c *Checker) wait(ctx context.Context, host string) error {
+	host = strings.ToLower(host)
+	c.mu.Lock()
+	now := time.Now()
+	at := c.next[host]
+	if at.Before(now) {
+		at = now
+	}
+	c.next[host] = at.Add(c.hostDelay)
+	c.mu.Unlock()
+
+	delay := time.Until(at)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// describe() turns a client error into a short message for the entry
+func describe(err error) string {
+	var urlErr *url.Error
+	switch {
+	case errors.Is(err, ErrPrivateAddress):
+		return ErrPrivateAddress.Error()
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timed out"
+	case errors.As(err, &urlErr) && urlErr.Timeout():
+		return "timed out"
+	case errors.As(err, &urlErr):
+		return urlErr.Err.Error()
+	default:
+		return err.Error()
+	}
+}
@@ -0,0 +1,187 @@
+// Filename: internal/linkcheck/linkcheck_test.go
+
+package linkcheck
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCheckFallsBackToGet(t *testing.T) {
+	var mu sync.Mutex
+	var methods []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		methods = append(methods, r.Method)
+		mu.Unlock()
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Write([]byte("hello"))
+	}))
+	defer srv.Close()
+
+	result := New(srv.Client(), 0).Check(context.Background(), srv.URL)
+	if result.Status != http.StatusOK || result.Broken() {
+		t.Errorf("got %+v; want status 200", result)
+	}
+	if strings.Join(methods, ",") != "HEAD,GET" {
+		t.Errorf("got methods %v; want HEAD then GET", methods)
+	}
+}
+
+func TestCheckHeadOnly(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer srv.Close()
+
+	result := New(srv.Client(), 0).Check(context.Background(), srv.URL)
+	if result.Status != http.StatusOK {
+		t.Errorf("got status %d; want 200", result.Status)
+	}
+	if requests != 1 {
+		t.Errorf("got %d requests; want 1", requests)
+	}
+}
+
+func TestCheckBroken(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	result := New(srv.Client(), 0).Check(context.Background(), srv.URL)
+	if result.Status != http.StatusNotFound || !result.Broken() {
+		t.Errorf("got %+v; want a broken 404", result)
+	}
+}
+
+func TestCheckRedirect(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+		}
+	}))
+	defer srv.Close()
+
+	result := New(srv.Client(), 0).Check(context.Background(), srv.URL+"/old")
+	if result.Status != http.StatusOK {
+		t.Errorf("got status %d; want 200", result.Status)
+	}
+	if result.Redirect != srv.URL+"/new" {
+		t.Errorf("got redirect %q; want %q", result.Redirect, srv.URL+"/new")
+	}
+}
+
+func TestCheckTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	client := srv.Client()
+	client.Timeout = 50 * time.Millisecond
+	result := New(client, 0).Check(context.Background(), srv.URL)
+	if result.Status != 0 || result.Err != "timed out" {
+		t.Errorf("got %+v; want a timeout", result)
+	}
+}
+
+func TestCheckInvalidURL(t *testing.T) {
+	for _, website := range []string{"", "ftp://example.com", "http://", "not a url"} {
+		result := New(nil, 0).Check(context.Background(), website)
+		if result.Err == "" || !result.Broken() {
+			t.Errorf("%q: got %+v; want an error", website, result)
+		}
+	}
+}
+
+func TestCheckHostDelay(t *testing.T) {
+	var mu sync.Mutex
+	var seen []time.Time
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		seen = append(seen, time.Now())
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	const delay = 100 * time.Millisecond
+	checker := New(srv.Client(), delay)
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			checker.Check(context.Background(), srv.URL)
+		}()
+	}
+	wg.Wait()
+
+	if len(seen) != 3 {
+		t.Fatalf("got %d requests; want 3", len(seen))
+	}
+	for i := 1; i < len(seen); i++ {
+		if gap := seen[i].Sub(seen[i-1]); gap < delay-10*time.Millisecond {
+			t.Errorf("request %d came %v after the one before; want at least %v", i, gap, delay)
+		}
+	}
+}
+
+func TestCheckHostDelayCancelled(t *testing.T) {
+	checker := New(nil, time.Hour)
+	checker.next["example.com"] = time.Now().Add(time.Hour)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	result := checker.Check(ctx, "http://example.com")
+	if result.Err == "" {
+		t.Errorf("got %+v; want the wait to be cut short", result)
+	}
+}
+
+func TestNewClientRefusesPrivateAddresses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the checker reached a loopback address")
+	}))
+	defer srv.Close()
+
+	result := New(NewClient(time.Second), 0).Check(context.Background(), srv.URL)
+	if result.Status != 0 || result.Err != ErrPrivateAddress.Error() {
+		t.Errorf("got %+v; want %q", result, ErrPrivateAddress)
+	}
+}
+
+func TestPublicIP(t *testing.T) {
+	tests := []struct {
+		ip     string
+		public bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"0.0.0.0", false},
+		{"224.0.0.1", false},
+	}
+	for _, tt := range tests {
+		if got := PublicIP(net.ParseIP(tt.ip)); got != tt.public {
+			t.Errorf("PublicIP(%s) = %t; want %t", tt.ip, got, tt.public)
+		}
+	}
+}
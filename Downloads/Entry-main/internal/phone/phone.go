@@ -0,0 +1,161 @@
+// Filename: internal/phone/phone.go
+
+// Package phone parses phone numbers written in the many ways people write
+// them and turns them into E.164 and a consistent display format. Only the
+// countries the directory deals with are known, each with its own numbering
+// rules
+package phone
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrInvalid        = errors.New("not a valid phone number")
+	ErrUnknownCountry = errors.New("unsupported country")
+)
+
+// A Region holds the numbering rules of a country
+type Region struct {
+	Code        string
+	CallingCode string
+	// TrunkPrefix is dialled before national numbers inside the country and
+	// dropped from the international form
+	TrunkPrefix string
+	// National matches a valid national significant number
+	National *regexp.Regexp
+	// Groups is how the national number is split up for display
+	Groups []int
+	// Separator goes between the groups
+	Separator string
+}
+
+// The known regions keyed by ISO 3166 code
+var regions = map[string]*Region{
+	"BZ": {Code: "BZ", CallingCode: "501", National: regexp.MustCompile(`^[2-8][0-9]{6}$`), Groups: []int{3, 4}, Separator: "-"},
+	"US": {Code: "US", CallingCode: "1", National: regexp.MustCompile(`^[2-9][0-9]{2}[2-9][0-9]{6}$`), Groups: []int{3, 3, 4}, Separator: "-"},
+	"CA": {Code: "CA", CallingCode: "1", National: regexp.MustCompile(`^[2-9][0-9]{2}[2-9][0-9]{6}$`), Groups: []int{3, 3, 4}, Separator: "-"},
+	"MX": {Code: "MX", CallingCode: "52", National: regexp.MustCompile(`^[1-9][0-9]{9}$`), Groups: []int{2, 4, 4}, Separator: " "},
+	"GT": {Code: "GT", CallingCode: "502", National: regexp.MustCompile(`^[2-7][0-9]{7}$`), Groups: []int{4, 4}, Separator: " "},
+	"SV": {Code: "SV", CallingCode: "503", National: regexp.MustCompile(`^[267][0-9]{7}$`), Groups: []int{4, 4}, Separator: " "},
+	"HN": {Code: "HN", CallingCode: "504", National: regexp.MustCompile(`^[2-9][0-9]{7}$`), Groups: []int{4, 4}, Separator: "-"},
+	"GB": {Code: "GB", CallingCode: "44", TrunkPrefix: "0", National: regexp.MustCompile(`^[1-9][0-9]{9}$`), Groups: []int{4, 6}, Separator: " "},
+}
+
+// The region used for numbers written in international form, keyed by calling
+// code. Countries that share a calling code and format only need one entry
+var callingCodes = map[string]string{
+	"501": "BZ",
+	"1":   "US",
+	"52":  "MX",
+	"502": "GT",
+	"503": "SV",
+	"504": "HN",
+	"44":  "GB",
+}
+
+var (
+	// An extension at the end of the number, such as "ext. 12", "x12" or "#12"
+	extensionRX = regexp.MustCompile(`(?i)\s*(?:,|;)?\s*(?:ext\.?|extension|x|#)\s*([0-9]{1,6})$`)
+	// The characters people use to lay out a number
+	punctuationRX = regexp.MustCompile(`[\s().\-/]`)
+	digitsRX      = regexp.MustCompile(`^[0-9]+$`)
+)
+
+// KnownRegion() reports whether a region code is supported
+func KnownRegion(code string) bool {
+	_, ok := regions[strings.ToUpper(code)]
+	return ok
+}
+
+// A Number is a parsed phone number
+type Number struct {
+	Region    string
+	National  string
+	Extension string
+}
+
+// E164() returns the number in E.164 form. The extension is not part of it
+func (n Number) E164() string {
+	return "+" + regions[n.Region].CallingCode + n.National
+}
+
+// Format() returns the number in international form laid out the way the
+// country writes it, followed by the extension if there is one
+func (n Number) Format() string {
+	region := regions[n.Region]
+	var groups []string
+	rest := n.National
+	for _, size := range region.Groups {
+		if size >= len(rest) {
+			break
+		}
+		groups = append(groups, rest[:size])
+		rest = rest[size:]
+	}
+	groups = append(groups, rest)
+	formatted := "+" + region.CallingCode + " " + strings.Join(groups, region.Separator)
+	if n.Extension != "" {
+		formatted += " ext. " + n.Extension
+	}
+	return formatted
+}
+
+// Parse() reads a phone number. Numbers starting with + or 00 are read as
+// international, anything else as a national number of defaultRegion
+func Parse(raw, defaultRegion string) (Number, error) {
+	var n Number
+	raw = strings.TrimSpace(raw)
+
+	if m := extensionRX.FindStringSubmatchIndex(raw); m != nil {
+		n.Extension = raw[m[2]:m[3]]
+		raw = raw[:m[0]]
+	}
+	digits := punctuationRX.ReplaceAllString(raw, "")
+	international := false
+	switch {
+	case strings.HasPrefix(digits, "+"):
+		digits, international = digits[1:], true
+	case strings.HasPrefix(digits, "00"):
+		digits, international = digits[2:], true
+	}
+	if !digitsRX.MatchString(digits) {
+		return Number{}, ErrInvalid
+	}
+
+	if international {
+		// Calling codes are one to three digits and none is a prefix of another
+		for size := 1; size <= 3 && size < len(digits); size++ {
+			if code, ok := callingCodes[digits[:size]]; ok {
+				n.Region = code
+				n.National = digits[size:]
+				break
+			}
+		}
+		if n.Region == "" {
+			return Number{}, ErrUnknownCountry
+		}
+	} else {
+		region, ok := regions[strings.ToUpper(defaultRegion)]
+		if !ok {
+			return Number{}, ErrUnknownCountry
+		}
+		n.Region = region.Code
+		n.National = digits
+		// The calling code is often written without the +
+		if strings.HasPrefix(digits, region.CallingCode) && region.National.MatchString(digits[len(region.CallingCode):]) {
+			n.National = digits[len(region.CallingCode):]
+		}
+	}
+
+	region := regions[n.Region]
+	if region.TrunkPrefix != "" && !international {
+		n.National = strings.TrimPrefix(n.National, region.TrunkPrefix)
+	}
+	if !region.National.MatchString(n.National) {
+		return Number{}, ErrInvalid
+	}
+	return n, nil
+}
@@ -0,0 +1,209 @@
+// Filename: internal/phone/phone_test.go
+
+package phone
+
+import (
+	"errors"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name      string
+		raw       string
+		region    string
+		wantE164  string
+		wantShown string
+	}{
+		{"belize international", "+501 607-1123", "BZ", "+5016071123", "+501 607-1123"},
+		{"belize national", "607-1123", "BZ", "+5016071123", "+501 607-1123"},
+		{"belize without the +", "501-607-1123", "BZ", "+5016071123", "+501 607-1123"},
+		{"00 prefix", "00501 607 1123", "US", "+5016071123", "+501 607-1123"},
+		{"dots and brackets", "(501) 607.1123", "BZ", "+5016071123", "+501 607-1123"},
+		{"ext.", "+501 607-1123 ext. 12", "BZ", "+5016071123", "+501 607-1123 ext. 12"},
+		{"x", "607-1123 x5", "BZ", "+5016071123", "+501 607-1123 ext. 5"},
+		{"#", "607-1123#99", "BZ", "+5016071123", "+501 607-1123 ext. 99"},
+		{"extension after a comma", "607-1123, extension 7", "BZ", "+5016071123", "+501 607-1123 ext. 7"},
+		{"gb trunk prefix", "020 7946 0018", "GB", "+442079460018", "+44 2079 460018"},
+		{"gb international", "+44 20 7946 0018", "BZ", "+442079460018", "+44 2079 460018"},
+		{"us national", "(212) 555-0123", "US", "+12125550123", "+1 212-555-0123"},
+		{"us with the calling code", "1-212-555-0123", "US", "+12125550123", "+1 212-555-0123"},
+		{"ca national", "613-555-0123", "CA", "+16135550123", "+1 613-555-0123"},
+		{"ca international", "+1 613 555 0123", "BZ", "+16135550123", "+1 613-555-0123"},
+		{"mexico", "+52 55 1234 5678", "BZ", "+525512345678", "+52 55 1234 5678"},
+		{"guatemala", "+502 2345 6789", "BZ", "+50223456789", "+502 2345 6789"},
+		{"lower case region", "607-1123", "bz", "+5016071123", "+501 607-1123"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := Parse(tt.raw, tt.region)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := n.E164(); got != tt.wantE164 {
+				t.Errorf("got E.164 %q; want %q", got, tt.wantE164)
+			}
+			if got := n.Format(); got != tt.wantShown {
+				t.Errorf("got display form %q; want %q", got, tt.wantShown)
+			}
+		})
+	}
+}
+
+// The US and Canada share calling code 1. A number reads the same whichever
+// of them is the default, and international numbers are kept as US
+func TestParseSharedCallingCode(t *testing.T) {
+	us, err := Parse("613-555-0123", "US")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := Parse("613-555-0123", "CA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if us.E164() != ca.E164() || us.Format() != ca.Format() {
+		t.Errorf("US gave %s, CA gave %s", us.E164(), ca.E164())
+	}
+	n, err := Parse("+1 613-555-0123", "CA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Region != "US" {
+		t.Errorf("got region %s; want US", n.Region)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		raw    string
+		region string
+		want   error
+	}{
+		{"", "BZ", ErrInvalid},
+		{"phone me", "BZ", ErrInvalid},
+		{"123", "BZ", ErrInvalid},
+		// Belizean numbers do not start with 0, 1 or 9
+		{"907-1123", "BZ", ErrInvalid},
+		{"607-11234", "BZ", ErrInvalid},
+		{"+501 607-112", "BZ", ErrInvalid},
+		// US area codes and exchanges do not start with 0 or 1
+		{"112-555-0123", "US", ErrInvalid},
+		{"212-155-0123", "US", ErrInvalid},
+		{"+999 1234567", "BZ", ErrUnknownCountry},
+		{"607-1123", "ZZ", ErrUnknownCountry},
+		{"607-1123 ext. 1234567", "BZ", ErrInvalid},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.raw, tt.region)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("Parse(%q, %s) = %v; want %v", tt.raw, tt.region, err, tt.want)
+		}
+	}
+}
+
+func TestKnownRegion(t *testing.T) {
+	for _, code := range []string{"BZ", "bz", "US", "CA", "MX", "GT", "SV", "HN", "GB"} {
+		if !KnownRegion(code) {
+			t.Errorf("%s is not known", code)
+		}
+	}
+	if KnownRegion("ZZ") {
+		t.Error("ZZ is known")
+	}
+}
+
+// TestMigrationBackfill checks that the numbers 000017 fills in for the
+// existing entries are the ones Parse() gives them, so entries do not change
+// when they are next edited. The CASE branches are read from the migration
+// and run here in order
+func TestMigrationBackfill(t *testing.T) {
+	sql, err := os.ReadFile("../../migrations/000017_add_entry_phone_e164.up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	matches := regexp.MustCompile(`WHEN digits ~ '([^']+)' THEN ([^\n]+)`).FindAllStringSubmatch(string(sql), -1)
+	// How each branch builds the number, in the migration's order
+	build := []struct {
+		then string
+		fn   func(digits string) string
+	}{
+		{"'+' || digits", func(d string) string { return "+" + d }},
+		{"'+1' || right(digits, 10)", func(d string) string { return "+1" + d[len(d)-10:] }},
+		{"'+501' || digits", func(d string) string { return "+501" + d }},
+	}
+	if len(matches) != len(build) {
+		t.Fatalf("found %d backfill branches; want %d", len(matches), len(build))
+	}
+	var branches []*regexp.Regexp
+	for i, m := range matches {
+		if strings.TrimSpace(m[2]) != build[i].then {
+			t.Fatalf("branch %d builds %q; want %q", i, m[2], build[i].then)
+		}
+		branches = append(branches, regexp.MustCompile(m[1]))
+	}
+	backfill := func(phone string) (int, string) {
+		digits := regexp.MustCompile(`[^0-9]`).ReplaceAllString(phone, "")
+		for i, rx := range branches {
+			if rx.MatchString(digits) {
+				return i, build[i].fn(digits)
+			}
+		}
+		return -1, ""
+	}
+
+	// The display form the migration writes for each number
+	display := func(e164 string) string {
+		if strings.HasPrefix(e164, "+501") {
+			return "+501 " + e164[4:7] + "-" + e164[7:11]
+		}
+		return "+1 " + e164[2:5] + "-" + e164[5:8] + "-" + e164[8:12]
+	}
+
+	tests := []struct {
+		phone  string
+		branch int
+		// The country the migration takes the number to be from
+		region string
+	}{
+		{"501-607-1123", 0, "BZ"},
+		{"212-555-0123", 1, "US"},
+		{"1-212-555-0123", 1, "US"},
+		{"613-555-0123", 1, "US"},
+		{"607-1123", 2, "BZ"},
+		// Left for the next edit to normalize
+		{"123-456-7890", -1, "BZ"},
+		{"12345", -1, "BZ"},
+	}
+	for _, tt := range tests {
+		branch, e164 := backfill(tt.phone)
+		if branch != tt.branch {
+			t.Errorf("%q took branch %d; want %d", tt.phone, branch, tt.branch)
+			continue
+		}
+		n, err := Parse(tt.phone, tt.region)
+		if branch == -1 {
+			if err == nil {
+				t.Errorf("%q is left empty by the migration but Parse() gives %s", tt.phone, n.E164())
+			}
+			continue
+		}
+		if err != nil || n.E164() != e164 {
+			t.Errorf("%q: the migration gives %s, Parse() gives %s (%v)", tt.phone, e164, n.E164(), err)
+			continue
+		}
+		// The rewritten number is what Parse() displays and reads back the
+		// same under any default country
+		if got := display(e164); got != n.Format() {
+			t.Errorf("%q: the migration displays %q, Parse() displays %q", tt.phone, got, n.Format())
+		}
+		for _, region := range []string{"BZ", "US", "GB"} {
+			again, err := Parse(display(e164), region)
+			if err != nil || again.E164() != e164 {
+				t.Errorf("%q: %q does not read back under %s: %v", tt.phone, display(e164), region, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,135 @@
+// Filename: internal/webhook/webhook.go
+
+// Package webhook signs and sends webhook deliveries.
+//
+// Every request carries the event name, the delivery ID, a Unix timestamp and
+// a signature. The signature is the hex HMAC-SHA256 of the timestamp, a dot
+// and the body, keyed with the subscription's secret, so receivers can check
+// both who sent it and that it is recent
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"kriol.camerontillett.net/internal/linkcheck"
+)
+
+// The headers set on every delivery
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// The User-Agent sent with every delivery
+const userAgent = "kriol-entry-webhooks/1.0"
+
+// NewSecret() returns a random signing secret
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Sign() returns the signature header value for a body sent at a time
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify() checks a signature header in constant time. Receivers written in Go
+// can use it as is
+func Verify(secret string, timestamp int64, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// Backoff() returns how long to wait before the next attempt after a number
+// of failed ones: a minute, doubling each time, up to six hours
+func Backoff(attempts int) time.Duration {
+	delay := time.Minute
+	for i := 1; i < attempts && delay < 6*time.Hour; i++ {
+		delay *= 2
+	}
+	if delay > 6*time.Hour {
+		delay = 6 * time.Hour
+	}
+	return delay
+}
+
+// NewClient() returns the client the sender uses outside of tests. Webhook
+// URLs are written by users, so like the link checker it refuses to connect to
+// private addresses. Redirects are not followed: a 3xx answer is a failed
+// delivery, so a public URL cannot bounce the signed body somewhere else
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, Control: linkcheck.RefusePrivate}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	// A proxy would make the connection for us and skip the check
+	transport.Proxy = nil
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// A Sender posts deliveries with an HTTP client
+type Sender struct {
+	client *http.Client
+}
+
+// New() returns a Sender. A nil client uses http.DefaultClient
+func New(client *http.Client) *Sender {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Sender{client: client}
+}
+
+// Send() posts a signed body to a URL. It returns the response status, or 0
+// if there was no response. Any status outside 2xx is an error
+func (s *Sender) Send(ctx context.Context, url, secret, event string, deliveryID int64, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set(HeaderEvent, event)
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(deliveryID, 10))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(secret, timestamp, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.CopyN(io.Discard, resp.Body, 4096)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("received status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,127 @@
+// Filename: internal/webhook/webhook_test.go
+
+package webhook
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"kriol.camerontillett.net/internal/linkcheck"
+)
+
+func TestSignVerify(t *testing.T) {
+	body := []byte(`{"event":"entry.created"}`)
+	signature := Sign("secret", 1700000000, body)
+
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp int64
+		body      []byte
+		signature string
+		valid     bool
+	}{
+		{"matches", "secret", 1700000000, body, signature, true},
+		{"wrong secret", "other", 1700000000, body, signature, false},
+		{"wrong timestamp", "secret", 1700000001, body, signature, false},
+		{"changed body", "secret", 1700000000, []byte(`{"event":"entry.deleted"}`), signature, false},
+		{"missing prefix", "secret", 1700000000, body, signature[len("sha256="):], false},
+		{"empty", "secret", 1700000000, body, "", false},
+	}
+	for _, tt := range tests {
+		if got := Verify(tt.secret, tt.timestamp, tt.body, tt.signature); got != tt.valid {
+			t.Errorf("%s: got %t; want %t", tt.name, got, tt.valid)
+		}
+	}
+}
+
+func TestSignKnownValue(t *testing.T) {
+	// echo -n '1700000000.{}' | openssl dgst -sha256 -hmac secret
+	want := "sha256=b8569b78799ff9e3cbff0fc2d63a33a2b57f3282abd07c37ae5e8e7d79a5f163"
+	if got := Sign("secret", 1700000000, []byte("{}")); got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, time.Minute},
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{9, 256 * time.Minute},
+		{10, 6 * time.Hour},
+		{50, 6 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := Backoff(tt.attempts); got != tt.want {
+			t.Errorf("Backoff(%d) = %v; want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestSend(t *testing.T) {
+	body := []byte(`{"event":"entry.created"}`)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timestamp, _ := strconv.ParseInt(r.Header.Get(HeaderTimestamp), 10, 64)
+		if !Verify("secret", timestamp, body, r.Header.Get(HeaderSignature)) {
+			t.Error("the signature does not verify")
+		}
+		if r.Header.Get(HeaderEvent) != "entry.created" || r.Header.Get(HeaderDelivery) != "42" {
+			t.Errorf("got headers %v", r.Header)
+		}
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer srv.Close()
+
+	sender := New(srv.Client())
+	status, err := sender.Send(context.Background(), srv.URL, "secret", "entry.created", 42, body)
+	if status != http.StatusOK || err != nil {
+		t.Errorf("got %d, %v; want 200", status, err)
+	}
+	status, err = sender.Send(context.Background(), srv.URL+"/down", "secret", "entry.created", 42, body)
+	if status != http.StatusBadGateway || err == nil {
+		t.Errorf("got %d, %v; want 502 and an error", status, err)
+	}
+}
+
+func TestNewClientRefusesPrivateAddresses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the sender reached a loopback address")
+	}))
+	defer srv.Close()
+
+	status, err := New(NewClient(time.Second)).Send(context.Background(), srv.URL, "secret", "entry.created", 1, []byte("{}"))
+	if status != 0 || !errors.Is(err, linkcheck.ErrPrivateAddress) {
+		t.Errorf("got %d, %v; want %q", status, err, linkcheck.ErrPrivateAddress)
+	}
+}
+
+func TestNewClientDoesNotFollowRedirects(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/hook" {
+			t.Errorf("the sender followed a redirect to %s", r.URL.Path)
+		}
+		http.Redirect(w, r, "/elsewhere", http.StatusTemporaryRedirect)
+	}))
+	defer srv.Close()
+
+	// Keep the test server's transport so loopback is allowed, but use the
+	// redirect policy of the real client
+	client := srv.Client()
+	client.CheckRedirect = NewClient(time.Second).CheckRedirect
+	status, err := New(client).Send(context.Background(), srv.URL+"/hook", "secret", "entry.created", 1, []byte("{}"))
+	if status != http.StatusTemporaryRedirect || err == nil {
+		t.Errorf("got %d, %v; want 307 and an error", status, err)
+	}
+}
@@ -0,0 +1,3 @@
+-- Filename: migrations/000007_create_entry_revisions_table.down.sql
+
+DROP TABLE IF EXISTS entry_revisions;
@@ -0,0 +1,25 @@
+-- Filename: migrations/000007_create_entry_revisions_table.up.sql
+
+-- every version of an entry is kept here along with the user who made it
+CREATE TABLE IF NOT EXISTS entry_revisions (
+    id bigserial PRIMARY KEY,
+    entry_id bigint NOT NULL REFERENCES entries (id) ON DELETE CASCADE,
+    version integer NOT NULL,
+    name text NOT NULL,
+    level text NOT NULL,
+    contact text NOT NULL,
+    phone text NOT NULL,
+    email text NOT NULL,
+    website text NOT NULL,
+    address text NOT NULL,
+    mode text[] NOT NULL,
+    changed_by bigint REFERENCES users (id) ON DELETE SET NULL,
+    changed_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    UNIQUE (entry_id, version)
+);
+
+-- seed the history with the current state of the existing entries
+INSERT INTO entry_revisions (entry_id, version, name, level, contact, phone, email, website, address, mode, changed_at)
+SELECT id, version, name, level, contact, phone, email, website, address, mode, created_at
+FROM entries
+ON CONFLICT DO NOTHING;
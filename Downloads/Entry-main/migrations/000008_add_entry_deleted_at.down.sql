@@ -0,0 +1,4 @@
+-- Filename: migrations/000008_add_entry_deleted_at.down.sql
+
+DROP INDEX IF EXISTS entries_deleted_at_idx;
+ALTER TABLE entries DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,6 @@
+-- Filename: migrations/000008_add_entry_deleted_at.up.sql
+
+-- entries are soft deleted so they can be restored from the trash
+ALTER TABLE entries ADD COLUMN IF NOT EXISTS deleted_at timestamp(0) with time zone;
+
+CREATE INDEX IF NOT EXISTS entries_deleted_at_idx ON entries (deleted_at) WHERE deleted_at IS NOT NULL;
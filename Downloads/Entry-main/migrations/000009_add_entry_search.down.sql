@@ -0,0 +1,8 @@
+-- Filename: migrations/000009_add_entry_search.down.sql
+
+DROP INDEX IF EXISTS entries_search_simple_idx;
+DROP INDEX IF EXISTS entries_search_english_idx;
+DROP INDEX IF EXISTS entries_search_spanish_idx;
+ALTER TABLE entries DROP COLUMN IF EXISTS search_simple;
+ALTER TABLE entries DROP COLUMN IF EXISTS search_english;
+ALTER TABLE entries DROP COLUMN IF EXISTS search_spanish;
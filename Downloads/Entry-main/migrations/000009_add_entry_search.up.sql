@@ -0,0 +1,26 @@
+-- Filename: migrations/000009_add_entry_search.up.sql
+
+-- weighted search documents for each of the supported text search configurations
+-- name is weighted highest, then level, contact and address
+ALTER TABLE entries ADD COLUMN IF NOT EXISTS search_simple tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('simple', coalesce(name, '')), 'A') ||
+    setweight(to_tsvector('simple', coalesce(level, '')), 'B') ||
+    setweight(to_tsvector('simple', coalesce(contact, '')), 'C') ||
+    setweight(to_tsvector('simple', coalesce(address, '')), 'D')
+) STORED;
+ALTER TABLE entries ADD COLUMN IF NOT EXISTS search_english tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', coalesce(name, '')), 'A') ||
+    setweight(to_tsvector('english', coalesce(level, '')), 'B') ||
+    setweight(to_tsvector('english', coalesce(contact, '')), 'C') ||
+    setweight(to_tsvector('english', coalesce(address, '')), 'D')
+) STORED;
+ALTER TABLE entries ADD COLUMN IF NOT EXISTS search_spanish tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('spanish', coalesce(name, '')), 'A') ||
+    setweight(to_tsvector('spanish', coalesce(level, '')), 'B') ||
+    setweight(to_tsvector('spanish', coalesce(contact, '')), 'C') ||
+    setweight(to_tsvector('spanish', coalesce(address, '')), 'D')
+) STORED;
+
+CREATE INDEX IF NOT EXISTS entries_search_simple_idx ON entries USING GIN(search_simple);
+CREATE INDEX IF NOT EXISTS entries_search_english_idx ON entries USING GIN(search_english);
+CREATE INDEX IF NOT EXISTS entries_search_spanish_idx ON entries USING GIN(search_spanish);
@@ -0,0 +1,9 @@
+-- Filename: migrations/000010_add_entry_location.down.sql
+
+ALTER TABLE entry_revisions DROP COLUMN IF EXISTS longitude;
+ALTER TABLE entry_revisions DROP COLUMN IF EXISTS latitude;
+
+DROP INDEX IF EXISTS entries_location_idx;
+ALTER TABLE entries DROP CONSTRAINT IF EXISTS location_check;
+ALTER TABLE entries DROP COLUMN IF EXISTS longitude;
+ALTER TABLE entries DROP COLUMN IF EXISTS latitude;
@@ -0,0 +1,15 @@
+-- Filename: migrations/000010_add_entry_location.up.sql
+
+-- the location of an entry is optional but latitude and longitude go together
+ALTER TABLE entries ADD COLUMN IF NOT EXISTS latitude double precision;
+ALTER TABLE entries ADD COLUMN IF NOT EXISTS longitude double precision;
+ALTER TABLE entries ADD CONSTRAINT location_check CHECK (
+    (latitude IS NULL AND longitude IS NULL) OR
+    (latitude BETWEEN -90 AND 90 AND longitude BETWEEN -180 AND 180)
+);
+
+CREATE INDEX IF NOT EXISTS entries_location_idx ON entries (latitude, longitude) WHERE latitude IS NOT NULL;
+
+-- keep the location in the revision history as well
+ALTER TABLE entry_revisions ADD COLUMN IF NOT EXISTS latitude double precision;
+ALTER TABLE entry_revisions ADD COLUMN IF NOT EXISTS longitude double precision;
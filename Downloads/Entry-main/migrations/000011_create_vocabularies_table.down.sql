@@ -0,0 +1,5 @@
+-- Filename: migrations/000011_create_vocabularies_table.down.sql
+
+-- the entries keep their normalized values
+DELETE FROM permissions WHERE code = 'vocabularies:write';
+DROP TABLE IF EXISTS vocabularies;
@@ -0,0 +1,86 @@
+-- Filename: migrations/000011_create_vocabularies_table.up.sql
+
+-- the allowed levels and modes. entries store the code, the aliases are other
+-- spellings that get turned into the code when an entry is written
+CREATE TABLE IF NOT EXISTS vocabularies (
+    id bigserial PRIMARY KEY,
+    kind text NOT NULL CHECK (kind IN ('level', 'mode')),
+    code text NOT NULL,
+    label text NOT NULL,
+    aliases text[] NOT NULL DEFAULT '{}',
+    version integer NOT NULL DEFAULT 1,
+    UNIQUE (kind, code)
+);
+
+INSERT INTO permissions (code)
+VALUES ('vocabularies:write');
+
+-- build the vocabularies from the values already in use. spellings that only
+-- differ by case, spaces or punctuation become one term, labelled with the
+-- most common spelling and keeping the others as aliases
+INSERT INTO vocabularies (kind, code, label, aliases)
+SELECT kind,
+       trim(BOTH '-' FROM regexp_replace(lower(spellings[1]), '[^[:alnum:]]+', '-', 'g')),
+       spellings[1],
+       spellings
+FROM (
+    SELECT kind, array_agg(value ORDER BY uses DESC, value) AS spellings
+    FROM (
+        SELECT 'level' AS kind, level AS value, COUNT(*) AS uses
+        FROM entries
+        GROUP BY level
+        UNION ALL
+        SELECT 'mode', value, COUNT(*)
+        FROM entries, unnest(mode) AS value
+        GROUP BY value
+    ) AS used
+    WHERE regexp_replace(lower(value), '[^[:alnum:]]+', '', 'g') <> ''
+    GROUP BY kind, regexp_replace(lower(value), '[^[:alnum:]]+', '', 'g')
+) AS terms;
+
+-- a new database has no entries to build from, so start with the usual levels
+-- and modes. a term is skipped when one of its spellings is already in use
+INSERT INTO vocabularies (kind, code, label, aliases)
+SELECT kind, code, label, aliases
+FROM (
+    VALUES ('level', 'preschool', 'Preschool', '{Pre-school,Nursery}'::text[]),
+           ('level', 'primary', 'Primary', '{Primary School}'),
+           ('level', 'secondary', 'Secondary', '{Secondary School,High School}'),
+           ('level', 'sixth-form', 'Sixth Form', '{Junior College}'),
+           ('level', 'tertiary', 'Tertiary', '{University,College}'),
+           ('level', 'vocational', 'Vocational', '{Technical,TVET}'),
+           ('mode', 'face-to-face', 'Face to face', '{In person,In-person}'),
+           ('mode', 'online', 'Online', '{Distance,Remote}'),
+           ('mode', 'hybrid', 'Hybrid', '{Blended}')
+) AS seed(kind, code, label, aliases)
+WHERE NOT EXISTS (
+    SELECT 1
+    FROM vocabularies, unnest(vocabularies.aliases || vocabularies.code) AS used(spelling),
+         unnest(seed.aliases || seed.code) AS seeded(spelling)
+    WHERE vocabularies.kind = seed.kind
+    AND regexp_replace(lower(used.spelling), '[^[:alnum:]]+', '', 'g') = regexp_replace(lower(seeded.spelling), '[^[:alnum:]]+', '', 'g')
+)
+ON CONFLICT DO NOTHING;
+
+-- store the code on every entry
+UPDATE entries
+SET level = vocabularies.code
+FROM vocabularies
+WHERE vocabularies.kind = 'level'
+AND regexp_replace(lower(entries.level), '[^[:alnum:]]+', '', 'g') = regexp_replace(lower(vocabularies.code), '[^[:alnum:]]+', '', 'g')
+AND entries.level <> vocabularies.code;
+
+UPDATE entries
+SET mode = ARRAY(
+    SELECT vocabularies.code
+    FROM unnest(entries.mode) WITH ORDINALITY AS m(value, position)
+    INNER JOIN vocabularies
+    ON vocabularies.kind = 'mode'
+    AND regexp_replace(lower(m.value), '[^[:alnum:]]+', '', 'g') = regexp_replace(lower(vocabularies.code), '[^[:alnum:]]+', '', 'g')
+    GROUP BY vocabularies.code
+    ORDER BY min(m.position)
+)
+WHERE EXISTS (
+    SELECT 1 FROM unnest(entries.mode) AS value
+    WHERE regexp_replace(lower(value), '[^[:alnum:]]+', '', 'g') <> ''
+);
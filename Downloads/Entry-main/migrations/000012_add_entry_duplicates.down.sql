@@ -0,0 +1,8 @@
+-- Filename: migrations/000012_add_entry_duplicates.down.sql
+
+DROP TABLE IF EXISTS entry_redirects;
+
+DROP INDEX IF EXISTS entries_website_host_idx;
+DROP INDEX IF EXISTS entries_email_lower_idx;
+DROP INDEX IF EXISTS entries_phone_digits_idx;
+DROP INDEX IF EXISTS entries_name_trgm_idx;
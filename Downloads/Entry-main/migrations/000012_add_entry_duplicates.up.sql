@@ -0,0 +1,21 @@
+-- Filename: migrations/000012_add_entry_duplicates.up.sql
+
+-- trigram similarity is used to find entries with nearly the same name
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS entries_name_trgm_idx ON entries USING GIN (name gin_trgm_ops);
+
+-- the normalized phone, email and website used by duplicate detection
+CREATE INDEX IF NOT EXISTS entries_phone_digits_idx ON entries (regexp_replace(phone, '[^0-9]', '', 'g'));
+CREATE INDEX IF NOT EXISTS entries_email_lower_idx ON entries (lower(trim(email)));
+CREATE INDEX IF NOT EXISTS entries_website_host_idx ON entries (regexp_replace(regexp_replace(lower(trim(website)), '^https?://(www\.)?', ''), '/+$', ''));
+
+-- an entry that was merged into another keeps resolving to it. from_id is not
+-- a foreign key so the redirect outlives the merged entry being purged
+CREATE TABLE IF NOT EXISTS entry_redirects (
+    from_id bigint PRIMARY KEY,
+    to_id bigint NOT NULL REFERENCES entries (id) ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS entry_redirects_to_id_idx ON entry_redirects (to_id);
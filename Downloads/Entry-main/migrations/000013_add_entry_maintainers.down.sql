@@ -0,0 +1,6 @@
+-- Filename: migrations/000013_add_entry_maintainers.down.sql
+
+-- removing the permission also removes its grants
+DELETE FROM permissions WHERE code = 'entries:admin';
+DROP TABLE IF EXISTS entry_maintainers;
+ALTER TABLE entries DROP COLUMN IF EXISTS created_by;
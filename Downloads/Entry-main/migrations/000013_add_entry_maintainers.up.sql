@@ -0,0 +1,47 @@
+-- Filename: migrations/000013_add_entry_maintainers.up.sql
+
+-- who created each entry and which users may edit it
+ALTER TABLE entries ADD COLUMN IF NOT EXISTS created_by bigint REFERENCES users (id) ON DELETE SET NULL;
+
+CREATE TABLE IF NOT EXISTS entry_maintainers (
+    entry_id bigint NOT NULL REFERENCES entries (id) ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    added_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (entry_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS entry_maintainers_user_id_idx ON entry_maintainers (user_id);
+
+-- users with entries:admin may edit any entry
+INSERT INTO permissions (code)
+VALUES ('entries:admin');
+
+-- the first revision tells us who created the existing entries
+UPDATE entries
+SET created_by = entry_revisions.changed_by
+FROM entry_revisions
+WHERE entry_revisions.entry_id = entries.id
+AND entry_revisions.version = 1
+AND entries.created_by IS NULL;
+
+-- the creator and everyone who has edited an entry maintain it
+INSERT INTO entry_maintainers (entry_id, user_id, added_at)
+SELECT id, created_by, created_at
+FROM entries
+WHERE created_by IS NOT NULL
+ON CONFLICT DO NOTHING;
+
+INSERT INTO entry_maintainers (entry_id, user_id, added_at)
+SELECT entry_id, changed_by, MIN(changed_at)
+FROM entry_revisions
+WHERE changed_by IS NOT NULL
+GROUP BY entry_id, changed_by
+ON CONFLICT DO NOTHING;
+
+-- nobody is given entries:admin here. Entries that are left without a
+-- maintainer can only be edited by the admins, who are granted the permission
+-- by hand once the migration has run:
+--
+--   INSERT INTO users_permissions (user_id, permission_id)
+--   SELECT users.id, permissions.id FROM users, permissions
+--   WHERE users.email = '<admin email>' AND permissions.code = 'entries:admin';
@@ -0,0 +1,4 @@
+-- Filename: migrations/000014_create_submissions_table.down.sql
+
+DELETE FROM permissions WHERE code IN ('entries:submit', 'entries:review');
+DROP TABLE IF EXISTS submissions;
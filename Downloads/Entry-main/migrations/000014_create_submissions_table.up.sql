@@ -0,0 +1,30 @@
+-- Filename: migrations/000014_create_submissions_table.up.sql
+
+-- schools proposed by users without entries:write. they only become entries
+-- once a reviewer approves them
+CREATE TABLE IF NOT EXISTS submissions (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    submitted_by bigint NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name text NOT NULL,
+    level text NOT NULL,
+    contact text NOT NULL,
+    phone text NOT NULL,
+    email text NOT NULL,
+    website text NOT NULL,
+    address text NOT NULL,
+    mode text[] NOT NULL,
+    latitude double precision,
+    longitude double precision,
+    status text NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'rejected')),
+    reason text NOT NULL DEFAULT '',
+    reviewed_by bigint REFERENCES users (id) ON DELETE SET NULL,
+    reviewed_at timestamp(0) with time zone,
+    entry_id bigint REFERENCES entries (id) ON DELETE SET NULL,
+    version integer NOT NULL DEFAULT 1
+);
+
+CREATE INDEX IF NOT EXISTS submissions_status_idx ON submissions (status, created_at);
+
+INSERT INTO permissions (code)
+VALUES ('entries:submit'), ('entries:review');
@@ -0,0 +1,3 @@
+-- Filename: migrations/000015_create_suggestions_table.down.sql
+
+DROP TABLE IF EXISTS suggestions;
@@ -0,0 +1,18 @@
+-- Filename: migrations/000015_create_suggestions_table.up.sql
+
+-- corrections sent in by the public. fields only holds the values that would
+-- change, keyed by the entry's JSON field names
+CREATE TABLE IF NOT EXISTS suggestions (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    entry_id bigint NOT NULL REFERENCES entries (id) ON DELETE CASCADE,
+    entry_version integer NOT NULL,
+    fields jsonb NOT NULL,
+    note text NOT NULL DEFAULT '',
+    status text NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'applied', 'dismissed')),
+    reviewed_by bigint REFERENCES users (id) ON DELETE SET NULL,
+    reviewed_at timestamp(0) with time zone,
+    version integer NOT NULL DEFAULT 1
+);
+
+CREATE INDEX IF NOT EXISTS suggestions_status_idx ON suggestions (status, created_at);
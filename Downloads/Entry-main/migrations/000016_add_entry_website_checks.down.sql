@@ -0,0 +1,7 @@
+-- Filename: migrations/000016_add_entry_website_checks.down.sql
+
+DROP INDEX IF EXISTS entries_website_checked_at_idx;
+ALTER TABLE entries DROP COLUMN IF EXISTS website_error;
+ALTER TABLE entries DROP COLUMN IF EXISTS website_redirect;
+ALTER TABLE entries DROP COLUMN IF EXISTS website_status;
+ALTER TABLE entries DROP COLUMN IF EXISTS website_checked_at;
@@ -0,0 +1,12 @@
+-- Filename: migrations/000016_add_entry_website_checks.up.sql
+
+-- the result of the last website check. A check time with a zero status
+-- means the website could not be reached
+ALTER TABLE entries ADD COLUMN IF NOT EXISTS website_checked_at timestamp(0) with time zone;
+ALTER TABLE entries ADD COLUMN IF NOT EXISTS website_status integer NOT NULL DEFAULT 0;
+ALTER TABLE entries ADD COLUMN IF NOT EXISTS website_redirect text NOT NULL DEFAULT '';
+ALTER TABLE entries ADD COLUMN IF NOT EXISTS website_error text NOT NULL DEFAULT '';
+
+-- the checker works through the websites that have waited longest
+CREATE INDEX IF NOT EXISTS entries_website_checked_at_idx ON entries (website_checked_at NULLS FIRST, id)
+    WHERE deleted_at IS NULL;
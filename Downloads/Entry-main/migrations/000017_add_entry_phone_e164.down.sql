@@ -0,0 +1,7 @@
+-- Filename: migrations/000017_add_entry_phone_e164.down.sql
+
+DROP INDEX IF EXISTS entries_phone_e164_idx;
+CREATE INDEX IF NOT EXISTS entries_phone_digits_idx ON entries (regexp_replace(phone, '[^0-9]', '', 'g'));
+-- the numbers rewritten with their country code are left as they are. They
+-- are still valid numbers
+ALTER TABLE entries DROP COLUMN IF EXISTS phone_e164;
@@ -0,0 +1,32 @@
+-- Filename: migrations/000017_add_entry_phone_e164.up.sql
+
+-- the phone number in E.164 form. The display form stays in phone
+ALTER TABLE entries ADD COLUMN IF NOT EXISTS phone_e164 text NOT NULL DEFAULT '';
+
+-- fill in the existing numbers. They were stored as 3-3-4 digit numbers so
+-- ten digits starting with 501 are Belizean, other ten digit numbers are
+-- North American and seven digits are Belizean without the country code.
+-- The display form is rewritten with the country code so the numbers still
+-- read the same whatever the default country is. Anything else is left for
+-- the next edit to normalize
+UPDATE entries
+SET phone_e164 = d.e164,
+    phone = CASE
+        WHEN d.e164 LIKE '+501%' THEN '+501 ' || substr(d.e164, 5, 3) || '-' || substr(d.e164, 8, 4)
+        ELSE '+1 ' || substr(d.e164, 3, 3) || '-' || substr(d.e164, 6, 3) || '-' || substr(d.e164, 9, 4)
+    END
+FROM (
+    SELECT id, CASE
+        WHEN digits ~ '^501[2-8][0-9]{6}$' THEN '+' || digits
+        WHEN digits ~ '^1?[2-9][0-9]{2}[2-9][0-9]{6}$' THEN '+1' || right(digits, 10)
+        WHEN digits ~ '^[2-8][0-9]{6}$' THEN '+501' || digits
+        ELSE ''
+    END AS e164
+    FROM (SELECT id, regexp_replace(phone, '[^0-9]', '', 'g') AS digits FROM entries) AS p
+) AS d
+WHERE entries.id = d.id
+AND d.e164 <> '';
+
+-- duplicate detection and phone searches now match on the E.164 form
+DROP INDEX IF EXISTS entries_phone_digits_idx;
+CREATE INDEX IF NOT EXISTS entries_phone_e164_idx ON entries (phone_e164) WHERE phone_e164 <> '';
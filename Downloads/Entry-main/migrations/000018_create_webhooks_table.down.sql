@@ -0,0 +1,5 @@
+-- Filename: migrations/000018_create_webhooks_table.down.sql
+
+DELETE FROM permissions WHERE code = 'webhooks:manage';
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS webhooks;
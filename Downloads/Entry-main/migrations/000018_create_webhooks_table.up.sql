@@ -0,0 +1,37 @@
+-- Filename: migrations/000018_create_webhooks_table.up.sql
+
+-- subscriptions to entry and user events. The secret signs every delivery
+CREATE TABLE IF NOT EXISTS webhooks (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    created_by bigint REFERENCES users (id) ON DELETE SET NULL,
+    url text NOT NULL,
+    events text[] NOT NULL,
+    secret text NOT NULL,
+    active boolean NOT NULL DEFAULT true,
+    version integer NOT NULL DEFAULT 1
+);
+
+-- every event sent, or to be sent, to each webhook. Pending deliveries are
+-- retried until they succeed or run out of attempts
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    webhook_id bigint NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+    event text NOT NULL,
+    payload jsonb NOT NULL,
+    status text NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'succeeded', 'failed')),
+    attempts integer NOT NULL DEFAULT 0,
+    next_attempt_at timestamp(0) with time zone DEFAULT NOW(),
+    last_status integer NOT NULL DEFAULT 0,
+    last_error text NOT NULL DEFAULT '',
+    delivered_at timestamp(0) with time zone
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_webhook_id_idx ON webhook_deliveries (webhook_id, id);
+CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx ON webhook_deliveries (next_attempt_at)
+    WHERE status = 'pending';
+
+-- users with webhooks:manage may manage the subscriptions
+INSERT INTO permissions (code)
+VALUES ('webhooks:manage');
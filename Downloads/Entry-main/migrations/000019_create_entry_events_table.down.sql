@@ -0,0 +1,7 @@
+-- Filename: migrations/000019_create_entry_events_table.down.sql
+
+DROP TRIGGER IF EXISTS entries_record_event ON entries;
+DROP FUNCTION IF EXISTS release_entry_events();
+DROP FUNCTION IF EXISTS record_entry_event();
+DROP TABLE IF EXISTS entry_event_queue;
+DROP TABLE IF EXISTS entry_events;
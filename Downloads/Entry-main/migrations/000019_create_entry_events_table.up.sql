@@ -0,0 +1,97 @@
+-- Filename: migrations/000019_create_entry_events_table.up.sql
+
+-- a short history of changes to entries so a live feed can be resumed. The
+-- IDs follow the order the changes were committed in, so a feed that has seen
+-- an event has seen every event before it
+CREATE TABLE IF NOT EXISTS entry_events (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    entry_id bigint NOT NULL,
+    action text NOT NULL CHECK (action IN ('created', 'updated', 'deleted')),
+    version integer NOT NULL,
+    name text NOT NULL,
+    level text NOT NULL,
+    mode text[] NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS entry_events_created_at_idx ON entry_events (created_at);
+
+-- changes wait here with the transaction that made them until they can be
+-- numbered. A serial ID is taken when a row is written, not when it is
+-- committed, so numbering them straight away would let a slow transaction
+-- commit an event behind one that feeds have already passed
+CREATE TABLE IF NOT EXISTS entry_event_queue (
+    id bigserial PRIMARY KEY,
+    txid xid8 NOT NULL DEFAULT pg_current_xact_id(),
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    entry_id bigint NOT NULL,
+    action text NOT NULL,
+    version integer NOT NULL,
+    name text NOT NULL,
+    level text NOT NULL,
+    mode text[] NOT NULL
+);
+
+-- queue every change to an entry and wake the API servers. A restore from the
+-- trash counts as the entry being created again. Writes that do not change
+-- the version, such as website checks, are skipped
+CREATE OR REPLACE FUNCTION record_entry_event() RETURNS trigger AS $$
+DECLARE
+    event_action text;
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        event_action := 'created';
+    ELSIF NEW.deleted_at IS NOT NULL AND OLD.deleted_at IS NULL THEN
+        event_action := 'deleted';
+    ELSIF NEW.deleted_at IS NULL AND OLD.deleted_at IS NOT NULL THEN
+        event_action := 'created';
+    ELSIF NEW.deleted_at IS NULL AND NEW.version <> OLD.version THEN
+        event_action := 'updated';
+    ELSE
+        RETURN NULL;
+    END IF;
+
+    INSERT INTO entry_event_queue (entry_id, action, version, name, level, mode)
+    VALUES (NEW.id, event_action, NEW.version, NEW.name, NEW.level, NEW.mode);
+
+    PERFORM pg_notify('entry_events_queued', '');
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS entries_record_event ON entries;
+CREATE TRIGGER entries_record_event
+AFTER INSERT OR UPDATE ON entries
+FOR EACH ROW EXECUTE FUNCTION record_entry_event();
+
+-- number the queued events whose transactions, and every transaction older
+-- than them, have finished. Nothing can be queued behind them after that.
+-- The lock makes the API servers take turns so the numbers are committed in
+-- order. Each event is sent to the listening API servers as it is numbered
+CREATE OR REPLACE FUNCTION release_entry_events() RETURNS integer AS $$
+DECLARE
+    horizon xid8;
+    queued entry_event_queue;
+    event entry_events;
+    released integer := 0;
+BEGIN
+    PERFORM pg_advisory_xact_lock(hashtext('release_entry_events'));
+    horizon := pg_snapshot_xmin(pg_current_snapshot());
+
+    FOR queued IN
+        SELECT * FROM entry_event_queue
+        WHERE txid < horizon
+        ORDER BY txid, id
+    LOOP
+        INSERT INTO entry_events (created_at, entry_id, action, version, name, level, mode)
+        VALUES (queued.created_at, queued.entry_id, queued.action, queued.version,
+                queued.name, queued.level, queued.mode)
+        RETURNING * INTO event;
+
+        DELETE FROM entry_event_queue WHERE id = queued.id;
+        PERFORM pg_notify('entry_events', row_to_json(event)::text);
+        released := released + 1;
+    END LOOP;
+    RETURN released;
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,10 @@
+-- Filename: migrations/000020_add_entry_district.down.sql
+
+DROP INDEX IF EXISTS entries_district_idx;
+ALTER TABLE submissions DROP COLUMN IF EXISTS district;
+ALTER TABLE entry_revisions DROP COLUMN IF EXISTS district;
+ALTER TABLE entries DROP COLUMN IF EXISTS district;
+
+DELETE FROM vocabularies WHERE kind = 'district';
+ALTER TABLE vocabularies DROP CONSTRAINT IF EXISTS vocabularies_kind_check;
+ALTER TABLE vocabularies ADD CONSTRAINT vocabularies_kind_check CHECK (kind IN ('level', 'mode'));
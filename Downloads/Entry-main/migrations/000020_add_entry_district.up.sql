@@ -0,0 +1,44 @@
+-- Filename: migrations/000020_add_entry_district.up.sql
+
+-- the districts become a vocabulary like the levels and modes
+ALTER TABLE vocabularies DROP CONSTRAINT IF EXISTS vocabularies_kind_check;
+ALTER TABLE vocabularies ADD CONSTRAINT vocabularies_kind_check CHECK (kind IN ('level', 'mode', 'district'));
+
+INSERT INTO vocabularies (kind, code, label, aliases)
+VALUES ('district', 'belize', 'Belize', '{Belize District}'),
+       ('district', 'cayo', 'Cayo', '{Cayo District}'),
+       ('district', 'corozal', 'Corozal', '{Corozal District}'),
+       ('district', 'orange-walk', 'Orange Walk', '{Orange Walk District}'),
+       ('district', 'stann-creek', 'Stann Creek', '{Stann Creek District}'),
+       ('district', 'toledo', 'Toledo', '{Toledo District}')
+ON CONFLICT DO NOTHING;
+
+-- the district an entry is in. It is optional so existing entries stay valid.
+-- Revisions and submissions keep it along with the other fields
+ALTER TABLE entries ADD COLUMN IF NOT EXISTS district text NOT NULL DEFAULT '';
+ALTER TABLE entry_revisions ADD COLUMN IF NOT EXISTS district text NOT NULL DEFAULT '';
+ALTER TABLE submissions ADD COLUMN IF NOT EXISTS district text NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS entries_district_idx ON entries (district) WHERE deleted_at IS NULL;
+
+-- fill in the district for entries whose address names exactly one of them.
+-- "Belize" on its own is usually the country, so only Belize City and Belize
+-- District count. The version is left alone since nobody edited the entry
+UPDATE entries
+SET district = found.code
+FROM (
+    SELECT entries.id, min(d.code) AS code
+    FROM entries
+    INNER JOIN (
+        VALUES ('belize', '\mbelize\s+(city|district)\M'),
+               ('cayo', '\mcayo\M'),
+               ('corozal', '\mcorozal\M'),
+               ('orange-walk', '\morange\s+walk\M'),
+               ('stann-creek', '\mstann\s+creek\M'),
+               ('toledo', '\mtoledo\M')
+    ) AS d(code, pattern)
+    ON entries.address ~* d.pattern
+    GROUP BY entries.id
+    HAVING COUNT(*) = 1
+) AS found
+WHERE entries.id = found.id;
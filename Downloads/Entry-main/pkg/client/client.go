@@ -0,0 +1,144 @@
+// Filename: pkg/client/client.go
+
+// Package client is a typed Go client for the Entry API. It sends the bearer
+// token, unwraps the response envelopes and turns error responses into an
+// *Error that can be matched with errors.Is:
+//
+//	c := client.New("https://api.example.com")
+//	err := c.Authenticate(ctx, "alice@example.com", "pa55word")
+//	...
+//	entry, err := c.GetEntry(ctx, 42)
+//	if errors.Is(err, client.ErrNotFound) {
+//		...
+//	}
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// A Client calls the Entry API. It is safe to use from several goroutines
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+
+	mu    sync.RWMutex
+	token string
+}
+
+// An Option changes how a Client is set up
+type Option func(*Client)
+
+// WithHTTPClient makes the Client send its requests with hc rather than
+// http.DefaultClient
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = hc
+	}
+}
+
+// WithToken makes the Client send an authentication token it already has
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// New returns a Client for the API at baseURL, such as
+// "http://localhost:4000"
+func New(baseURL string, options ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: http.DefaultClient,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// SetToken changes the authentication token sent with each request. An empty
+// token sends requests anonymously
+func (c *Client) SetToken(token string) {
+	c.mu.Lock()
+	c.token = token
+	c.mu.Unlock()
+}
+
+// Token returns the authentication token the Client is sending
+func (c *Client) Token() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.token
+}
+
+// A RequestOption changes a single request
+type RequestOption func(*http.Request)
+
+// IfMatch only lets an update or delete through if the entry still has the
+// given ETag, as returned in Entry.ETag. Otherwise ErrPreconditionFailed is
+// returned
+func IfMatch(etag string) RequestOption {
+	return func(r *http.Request) {
+		r.Header.Set("If-Match", etag)
+	}
+}
+
+// do() sends a request and decodes the response body into dst. Error
+// responses are returned as an *Error
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, dst interface{}, options ...RequestOption) (*http.Response, error) {
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		js, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(js)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token := c.Token(); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for _, option := range options {
+		option(req)
+	}
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= http.StatusBadRequest {
+		return res, readError(res)
+	}
+	if dst == nil {
+		io.Copy(io.Discard, res.Body)
+		return res, nil
+	}
+	err = json.NewDecoder(res.Body).Decode(dst)
+	if err != nil {
+		return res, fmt.Errorf("client: decoding the %s %s response: %w", method, path, err)
+	}
+	return res, nil
+}
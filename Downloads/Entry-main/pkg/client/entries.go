@@ -0,0 +1,324 @@
+// Filename: pkg/client/entries.go
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// An Entry is a school
+type Entry struct {
+	ID        int64    `json:"id"`
+	Name      string   `json:"name"`
+	Level     string   `json:"level"`
+	Contact   string   `json:"contact"`
+	Phone     string   `json:"phone"`
+	PhoneE164 string   `json:"phone_e164,omitempty"`
+	Email     string   `json:"email,omitempty"`
+	Website   string   `json:"website,omitempty"`
+	Address   string   `json:"address"`
+	District  string   `json:"district,omitempty"`
+	Mode      []string `json:"mode"`
+	Version   int32    `json:"version"`
+	CreatedBy int64    `json:"created_by,omitempty"`
+	// The location is optional
+	Latitude  *float64   `json:"latitude,omitempty"`
+	Longitude *float64   `json:"longitude,omitempty"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// Filled in by the website checker. They change without the version
+	// changing, so only listings include them
+	WebsiteCheckedAt *time.Time `json:"website_checked_at,omitempty"`
+	WebsiteStatus    int        `json:"website_status,omitempty"`
+	WebsiteRedirect  string     `json:"website_redirect,omitempty"`
+	WebsiteError     string     `json:"website_error,omitempty"`
+	// Only set when listing with EntryFilter.Near
+	DistanceKm *float64 `json:"distance_km,omitempty"`
+	// Only set when searching with EntryFilter.Query. The highlights are HTML
+	// snippets with the matches wrapped in <mark> tags
+	Rank       float32           `json:"rank,omitempty"`
+	Highlights map[string]string `json:"highlights,omitempty"`
+
+	// The ETag the API sent with the entry. Pass it to IfMatch to make sure
+	// an update does not overwrite someone else's
+	ETag string `json:"-"`
+}
+
+// EntryInput holds the fields of a new entry. The level, mode and district may
+// be codes, labels or aliases from the API's vocabulary
+type EntryInput struct {
+	Name      string   `json:"name"`
+	Level     string   `json:"level"`
+	Contact   string   `json:"contact"`
+	Phone     string   `json:"phone"`
+	Email     string   `json:"email"`
+	Website   string   `json:"website"`
+	Address   string   `json:"address"`
+	District  string   `json:"district,omitempty"`
+	Mode      []string `json:"mode"`
+	Latitude  *float64 `json:"latitude,omitempty"`
+	Longitude *float64 `json:"longitude,omitempty"`
+}
+
+// EntryUpdate holds the fields to change in an entry. Fields left as nil are
+// not changed
+type EntryUpdate struct {
+	Name      *string  `json:"name,omitempty"`
+	Level     *string  `json:"level,omitempty"`
+	Contact   *string  `json:"contact,omitempty"`
+	Phone     *string  `json:"phone,omitempty"`
+	Email     *string  `json:"email,omitempty"`
+	Website   *string  `json:"website,omitempty"`
+	Address   *string  `json:"address,omitempty"`
+	District  *string  `json:"district,omitempty"`
+	Mode      []string `json:"mode,omitempty"`
+	Latitude  *float64 `json:"latitude,omitempty"`
+	Longitude *float64 `json:"longitude,omitempty"`
+}
+
+// A DuplicateCandidate is an existing entry that a new one looks like
+type DuplicateCandidate struct {
+	ID         int64    `json:"id"`
+	Name       string   `json:"name"`
+	Similarity float64  `json:"similarity"`
+	Matches    []string `json:"matches"`
+}
+
+// Metadata describes a page of a listing. Offset listings fill in the page
+// fields and keyset listings fill in the cursors
+type Metadata struct {
+	CurrentPage  int    `json:"current_page,omitempty"`
+	PageSize     int    `json:"page_size,omitempty"`
+	FirstPage    int    `json:"first_page,omitempty"`
+	LastPage     int    `json:"last_page,omitempty"`
+	TotalRecords int    `json:"total_records,omitempty"`
+	NextCursor   string `json:"next_cursor,omitempty"`
+	PrevCursor   string `json:"prev_cursor,omitempty"`
+}
+
+// A GeoPoint is a latitude and longitude in degrees
+type GeoPoint struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// A BoundingBox is the area between two corners
+type BoundingBox struct {
+	MinLongitude float64
+	MinLatitude  float64
+	MaxLongitude float64
+	MaxLatitude  float64
+}
+
+// EntryFilter picks out the entries a listing returns. Zero values are left
+// out of the request
+type EntryFilter struct {
+	Name          string
+	Level         string
+	Mode          []string
+	District      string
+	WebsiteStatus string
+	Phone         string
+	Near          *GeoPoint
+	RadiusKm      float64
+	BBox          *BoundingBox
+	// Query searches the entries. Lang is the search language
+	Query string
+	Lang  string
+	// Sort is a field name, with a leading "-" for descending order
+	Sort     string
+	Page     int
+	PageSize int
+}
+
+// values() writes the filter as query parameters
+func (f EntryFilter) values() url.Values {
+	qs := url.Values{}
+	set := func(key, value string) {
+		if value != "" {
+			qs.Set(key, value)
+		}
+	}
+	set("name", f.Name)
+	set("level", f.Level)
+	set("mode", strings.Join(f.Mode, ","))
+	set("district", f.District)
+	set("website_status", f.WebsiteStatus)
+	set("phone", f.Phone)
+	if f.Near != nil {
+		set("near", formatFloats(f.Near.Latitude, f.Near.Longitude))
+	}
+	if f.RadiusKm != 0 {
+		set("radius_km", formatFloats(f.RadiusKm))
+	}
+	if f.BBox != nil {
+		set("bbox", formatFloats(f.BBox.MinLongitude, f.BBox.MinLatitude, f.BBox.MaxLongitude, f.BBox.MaxLatitude))
+	}
+	set("q", f.Query)
+	set("lang", f.Lang)
+	set("sort", f.Sort)
+	if f.Page != 0 {
+		set("page", strconv.Itoa(f.Page))
+	}
+	if f.PageSize != 0 {
+		set("page_size", strconv.Itoa(f.PageSize))
+	}
+	return qs
+}
+
+func formatFloats(values ...float64) string {
+	parts := make([]string, len(values))
+	for i, value := range values {
+		parts[i] = strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	return strings.Join(parts, ",")
+}
+
+// An EntryPage is one page of a listing
+type EntryPage struct {
+	Entries  []*Entry `json:"entries"`
+	Metadata Metadata `json:"metadata"`
+}
+
+// ListEntries returns one page of the entries that match the filter
+func (c *Client) ListEntries(ctx context.Context, filter EntryFilter) (*EntryPage, error) {
+	var page EntryPage
+	_, err := c.do(ctx, http.MethodGet, "/v1/entries", filter.values(), nil, &page)
+	if err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// Entries returns an iterator over every entry that matches the filter. It
+// follows the API's cursors, so entries added while iterating are not
+// skipped or repeated. filter.Page is ignored
+func (c *Client) Entries(ctx context.Context, filter EntryFilter) *EntryIterator {
+	filter.Page = 0
+	cursor := ""
+	return &EntryIterator{ctx: ctx, more: true, fetch: func(ctx context.Context) ([]*Entry, bool, error) {
+		qs := filter.values()
+		// Sending a cursor, even an empty one, asks for keyset pagination
+		qs.Set("cursor", cursor)
+		var page EntryPage
+		_, err := c.do(ctx, http.MethodGet, "/v1/entries", qs, nil, &page)
+		if err != nil {
+			return nil, false, err
+		}
+		cursor = page.Metadata.NextCursor
+		return page.Entries, cursor != "", nil
+	}}
+}
+
+// MyEntries returns an iterator over the entries the authenticated user
+// maintains. Only Sort and PageSize are read from the filter
+func (c *Client) MyEntries(ctx context.Context, filter EntryFilter) *EntryIterator {
+	return c.pages(ctx, "/v1/users/me/entries", EntryFilter{Sort: filter.Sort, PageSize: filter.PageSize}.values())
+}
+
+// pages() returns an iterator that reads an offset listing a page at a time
+func (c *Client) pages(ctx context.Context, path string, qs url.Values) *EntryIterator {
+	page := 1
+	return &EntryIterator{ctx: ctx, more: true, fetch: func(ctx context.Context) ([]*Entry, bool, error) {
+		qs.Set("page", strconv.Itoa(page))
+		var result EntryPage
+		_, err := c.do(ctx, http.MethodGet, path, qs, nil, &result)
+		if err != nil {
+			return nil, false, err
+		}
+		page++
+		return result.Entries, result.Metadata.CurrentPage < result.Metadata.LastPage, nil
+	}}
+}
+
+// An EntryIterator reads a listing one entry at a time, fetching pages as
+// they are needed:
+//
+//	it := c.Entries(ctx, client.EntryFilter{Level: "primary"})
+//	for it.Next() {
+//		fmt.Println(it.Entry().Name)
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type EntryIterator struct {
+	ctx   context.Context
+	fetch func(ctx context.Context) ([]*Entry, bool, error)
+	page  []*Entry
+	entry *Entry
+	more  bool
+	err   error
+}
+
+// Next moves to the next entry. It returns false at the end of the listing or
+// when a page could not be fetched
+func (it *EntryIterator) Next() bool {
+	for len(it.page) == 0 {
+		if !it.more || it.err != nil {
+			it.entry = nil
+			return false
+		}
+		it.page, it.more, it.err = it.fetch(it.ctx)
+	}
+	it.entry, it.page = it.page[0], it.page[1:]
+	return true
+}
+
+// Entry returns the current entry
+func (it *EntryIterator) Entry() *Entry {
+	return it.entry
+}
+
+// Err returns the error that stopped the iterator, if any
+func (it *EntryIterator) Err() error {
+	return it.err
+}
+
+// GetEntry returns an entry
+func (c *Client) GetEntry(ctx context.Context, id int64) (*Entry, error) {
+	return c.entryRequest(ctx, http.MethodGet, fmt.Sprintf("/v1/entries/%d", id), nil, nil)
+}
+
+// CreateEntry adds an entry. If it looks like an existing entry an *Error
+// matching ErrConflict is returned with the Candidates filled in. Use
+// ForceCreateEntry to add it anyway
+func (c *Client) CreateEntry(ctx context.Context, input EntryInput) (*Entry, error) {
+	return c.entryRequest(ctx, http.MethodPost, "/v1/entries", nil, input)
+}
+
+// ForceCreateEntry adds an entry without checking for duplicates
+func (c *Client) ForceCreateEntry(ctx context.Context, input EntryInput) (*Entry, error) {
+	return c.entryRequest(ctx, http.MethodPost, "/v1/entries", url.Values{"force": {"true"}}, input)
+}
+
+// UpdateEntry changes the fields of an entry that are set in update
+func (c *Client) UpdateEntry(ctx context.Context, id int64, update EntryUpdate, options ...RequestOption) (*Entry, error) {
+	return c.entryRequest(ctx, http.MethodPatch, fmt.Sprintf("/v1/entries/%d", id), nil, update, options...)
+}
+
+// DeleteEntry moves an entry to the trash
+func (c *Client) DeleteEntry(ctx context.Context, id int64, options ...RequestOption) error {
+	_, err := c.do(ctx, http.MethodDelete, fmt.Sprintf("/v1/entries/%d", id), nil, nil, nil, options...)
+	return err
+}
+
+// entryRequest() sends a request that responds with {"entries": entry}
+func (c *Client) entryRequest(ctx context.Context, method, path string, query url.Values, body interface{}, options ...RequestOption) (*Entry, error) {
+	var result struct {
+		Entry *Entry `json:"entries"`
+	}
+	res, err := c.do(ctx, method, path, query, body, &result, options...)
+	if err != nil {
+		return nil, err
+	}
+	if result.Entry == nil {
+		return nil, fmt.Errorf("client: the %s %s response has no entry", method, path)
+	}
+	result.Entry.ETag = res.Header.Get("ETag")
+	return result.Entry, nil
+}
@@ -0,0 +1,94 @@
+// Filename: pkg/client/errors.go
+
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Each error response matches one of these with errors.Is
+var (
+	ErrUnauthorized       = errors.New("client: invalid or missing authentication")
+	ErrForbidden          = errors.New("client: not permitted")
+	ErrNotFound           = errors.New("client: not found")
+	ErrConflict           = errors.New("client: conflict")
+	ErrPreconditionFailed = errors.New("client: precondition failed")
+	ErrFailedValidation   = errors.New("client: failed validation")
+	ErrRateLimited        = errors.New("client: rate limit exceeded")
+)
+
+var statusErrors = map[int]error{
+	http.StatusUnauthorized:        ErrUnauthorized,
+	http.StatusForbidden:           ErrForbidden,
+	http.StatusNotFound:            ErrNotFound,
+	http.StatusConflict:            ErrConflict,
+	http.StatusPreconditionFailed:  ErrPreconditionFailed,
+	http.StatusUnprocessableEntity: ErrFailedValidation,
+	http.StatusTooManyRequests:     ErrRateLimited,
+}
+
+// An Error is an error response from the API
+type Error struct {
+	StatusCode int
+	// The message sent by the API. It is empty when Fields is set
+	Message string
+	// The validation errors keyed by field name, for a 422 response
+	Fields map[string]string
+	// The existing entries a new one looks like, when CreateEntry gets a 409
+	Candidates []DuplicateCandidate
+}
+
+func (e *Error) Error() string {
+	if len(e.Fields) == 0 {
+		return fmt.Sprintf("client: %d %s", e.StatusCode, e.Message)
+	}
+	names := make([]string, 0, len(e.Fields))
+	for name := range e.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	problems := make([]string, len(names))
+	for i, name := range names {
+		problems[i] = name + " " + e.Fields[name]
+	}
+	return fmt.Sprintf("client: %d %s", e.StatusCode, strings.Join(problems, ", "))
+}
+
+// Is lets errors.Is match an Error against ErrNotFound and the other status
+// errors
+func (e *Error) Is(target error) bool {
+	return statusErrors[e.StatusCode] == target
+}
+
+// readError() decodes an error response. The API sends {"error": ...} where
+// the value is a message, or a map of field names to messages when
+// validation fails
+func readError(res *http.Response) error {
+	apiErr := &Error{StatusCode: res.StatusCode}
+	var body struct {
+		Error      json.RawMessage      `json:"error"`
+		Candidates []DuplicateCandidate `json:"candidates"`
+	}
+	js, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if json.Unmarshal(js, &body) != nil || len(body.Error) == 0 {
+		apiErr.Message = strings.TrimSpace(string(js))
+		if apiErr.Message == "" {
+			apiErr.Message = http.StatusText(res.StatusCode)
+		}
+		return apiErr
+	}
+	if json.Unmarshal(body.Error, &apiErr.Fields) != nil {
+		json.Unmarshal(body.Error, &apiErr.Message)
+	}
+	apiErr.Candidates = body.Candidates
+	return apiErr
+}
@@ -0,0 +1,76 @@
+// Filename: pkg/client/users.go
+
+package client
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// A User is an account on the API
+type User struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	Activated bool      `json:"activated"`
+}
+
+// A Token is an authentication token and when it stops working
+type Token struct {
+	Token  string    `json:"token"`
+	Expiry time.Time `json:"expiry"`
+}
+
+// RegisterUser creates a user. The API emails them a token to pass to
+// ActivateUser
+func (c *Client) RegisterUser(ctx context.Context, name, email, password string) (*User, error) {
+	input := map[string]string{"name": name, "email": email, "password": password}
+	var result struct {
+		User *User `json:"user"`
+	}
+	_, err := c.do(ctx, http.MethodPost, "/v1/users", nil, input, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result.User, nil
+}
+
+// ActivateUser activates the user the activation token was sent to
+func (c *Client) ActivateUser(ctx context.Context, token string) (*User, error) {
+	var result struct {
+		User *User `json:"user"`
+	}
+	_, err := c.do(ctx, http.MethodPut, "/v1/users/activated", nil, map[string]string{"token": token}, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result.User, nil
+}
+
+// CreateAuthenticationToken exchanges an email address and password for an
+// authentication token. The Client keeps using its current token; see
+// Authenticate
+func (c *Client) CreateAuthenticationToken(ctx context.Context, email, password string) (*Token, error) {
+	input := map[string]string{"email": email, "password": password}
+	var result struct {
+		Token *Token `json:"authentication_token"`
+	}
+	_, err := c.do(ctx, http.MethodPost, "/v1/tokens/authentication", nil, input, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result.Token, nil
+}
+
+// Authenticate creates an authentication token and sends it with every
+// request from now on
+func (c *Client) Authenticate(ctx context.Context, email, password string) error {
+	token, err := c.CreateAuthenticationToken(ctx, email, password)
+	if err != nil {
+		return err
+	}
+	c.SetToken(token.Token)
+	return nil
+}